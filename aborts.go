@@ -0,0 +1,175 @@
+package stcpsce
+
+import (
+	"container/list"
+	"fmt"
+	"go/token"
+	"sort"
+	"strings"
+)
+
+// AbortPoint
+//
+// @description:	This is used to describe a statement aborting a transaction and the first write which may be made
+//before it.
+//
+type AbortPoint struct {
+	// Exit is the `return` statement or the call of `panic` aborting the transaction.
+	Exit *Ast
+	// After is the first write made before the abort on one of its paths, nil if it never follows a write.
+	After *KeyAccess
+}
+
+// AbortReport
+//
+// @description:	This is used to describe the aborts of a transaction. Chopping a transaction is only correct if a
+//later piece cannot roll back an earlier one, so a transaction which may abort after a write requires rollback-safe
+//chopping: every abort must be in the first piece.
+//
+type AbortReport struct {
+	Function string
+	// Aborts holds the abort points in the order of the source code.
+	Aborts []*AbortPoint
+	// RollbackSafe tells if the transaction requires rollback-safe chopping, the first piece then runs up to
+	// FirstPieceEnd, which is the last abort point.
+	RollbackSafe  bool
+	FirstPieceEnd *Ast
+}
+
+// @title:	findAbortExits
+//
+// @description:	This is used to find the statements of a function aborting the transaction: the `return` statements
+//of an aborting call and the calls of `panic`.
+//
+// @param: 	ast *Ast	The node which needs to be searched.
+//
+// @param: 	aborts map[string]bool	Set of the names of the functions which always return `shim.Error`.
+//
+// @return:	exits []*Ast	List of the statements.
+//
+func findAbortExits(ast *Ast, aborts map[string]bool) (exits []*Ast) {
+	exits = []*Ast{}
+	if strings.Contains(ast.Label, "*ast.FuncLit") {
+		return exits
+	} else if strings.Contains(ast.Label, "*ast.ReturnStmt") {
+		if isAbortReturn(ast, aborts) {
+			exits = append(exits, ast)
+		}
+		return exits
+	} else if expression := findChild(ast, "X"); strings.Contains(ast.Label, "*ast.ExprStmt") && expression != nil &&
+		isAbortCall(expression, aborts) {
+		return append(exits, ast)
+	}
+	for x := range ast.Children {
+		exits = append(exits, findAbortExits(ast.Children[x], aborts)...)
+	}
+	return exits
+}
+
+// @title:	analyzeAborts
+//
+// @description:	This is used to find the aborts of every transaction and whether each of them may follow a write,
+//from the paths of the transaction. When its paths are truncated, an abort follows every write before it in the source
+//code.
+//
+// @param: 	ast *Ast	The root node of the file.
+//
+// @param: 	functions []*FunctionPaths	List of the paths of the functions.
+//
+// @param: 	failures *list.List	List which the diagnostics of the functions failing to be analyzed are appended to, or
+//nil.
+//
+// @return:	reports []*AbortReport	List of the reports of the transactions in declaration order.
+//
+func analyzeAborts(ast *Ast, functions []*FunctionPaths, failures *list.List) (reports []*AbortReport) {
+	reports = []*AbortReport{}
+	aborts := findAbortFunctions(ast, failures)
+	declarations := map[string]*Ast{}
+	for _, declaration := range findFunctionDeclarations(ast) {
+		declarations[findFunctionName(declaration)] = declaration
+	}
+	for _, function := range functions {
+		if !function.Transaction {
+			continue
+		}
+		isolateFunction(declarations[function.Function], "aborts", failures, func() {
+			report := &AbortReport{Function: function.Function, Aborts: []*AbortPoint{}}
+			points := map[*Ast]*AbortPoint{}
+			if function.Truncated {
+				for _, exit := range findAbortExits(findFunctionBody(declarations[function.Function]), aborts) {
+					point := &AbortPoint{Exit: exit}
+					for _, access := range append(append([]*KeyAccess{}, function.Must...), function.May...) {
+						if access.Write && access.Site.Pos < exit.Pos &&
+							(point.After == nil || access.Site.Pos < point.After.Site.Pos) {
+							point.After = access
+						}
+					}
+					points[exit] = point
+				}
+			}
+			for _, path := range function.Paths {
+				if !path.Abort {
+					continue
+				}
+				point := points[path.Exit]
+				if point == nil {
+					point = &AbortPoint{Exit: path.Exit}
+					points[path.Exit] = point
+				}
+				for _, access := range path.Accesses {
+					if access.Write {
+						if point.After == nil || access.Site.Pos < point.After.Site.Pos {
+							point.After = access
+						}
+						break
+					}
+				}
+			}
+			for _, point := range points {
+				report.Aborts = append(report.Aborts, point)
+				if point.After != nil {
+					report.RollbackSafe = true
+				}
+			}
+			sort.Slice(report.Aborts, func(i, j int) bool {
+				return report.Aborts[i].Exit.Pos < report.Aborts[j].Exit.Pos
+			})
+			if report.RollbackSafe {
+				report.FirstPieceEnd = report.Aborts[len(report.Aborts)-1].Exit
+			}
+			reports = append(reports, report)
+		})
+	}
+	return reports
+}
+
+// @title:	printAborts
+//
+// @description:	This is used to print the aborts of every transaction, whether each of them may follow a write, and
+//which transactions require rollback-safe chopping.
+//
+// @param: 	reports []*AbortReport	List of the reports of the transactions.
+//
+// @param: 	fileSet *token.FileSet	The file set which the source code is parsed with.
+//
+func printAborts(reports []*AbortReport, fileSet *token.FileSet) {
+	fmt.Print("\n\nAborts:\n")
+	for _, report := range reports {
+		if report.RollbackSafe {
+			fmt.Printf("%s: may abort after a write, requires rollback-safe chopping with every abort in the first "+
+				"piece, up to line %d\n", report.Function, lineOf(fileSet, report.FirstPieceEnd.Pos))
+		} else if len(report.Aborts) != 0 {
+			fmt.Printf("%s: never aborts after a write\n", report.Function)
+		} else {
+			fmt.Printf("%s: never aborts\n", report.Function)
+		}
+		for _, point := range report.Aborts {
+			if point.After != nil {
+				fmt.Printf("\tline %d: after %s line %d\n", lineOf(fileSet, point.Exit.Pos), point.After.API,
+					lineOf(fileSet, point.After.Site.Pos))
+			} else {
+				fmt.Printf("\tline %d: before any write\n", lineOf(fileSet, point.Exit.Pos))
+			}
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package stcpsce
+
+import (
+	"testing"
+)
+
+func TestAnalyzeAborts(t *testing.T) {
+	analysis := analyzeTestSource(t, `package main
+
+import (
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+type SmartContract struct{}
+
+func errormsg(message string) pb.Response {
+	return shim.Error(message)
+}
+
+func (s *SmartContract) Check(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) == 0 {
+		return errormsg("no arguments")
+	}
+	stub.PutState(args[0], []byte("1"))
+	return shim.Success(nil)
+}
+
+func (s *SmartContract) Pay(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	stub.PutState(args[0], []byte("1"))
+	if len(args) == 1 {
+		return errormsg("no amount")
+	}
+	stub.PutState(args[1], []byte("1"))
+	return shim.Success(nil)
+}
+`)
+	reports := map[string]*AbortReport{}
+	for _, report := range analysis.Aborts {
+		reports[report.Function] = report
+	}
+	check := reports["Check"]
+	if check == nil || len(check.Aborts) != 1 || check.Aborts[0].After != nil || check.RollbackSafe {
+		t.Errorf("Check = %+v, want one abort before any write", check)
+	}
+	pay := reports["Pay"]
+	if pay == nil || len(pay.Aborts) != 1 || pay.Aborts[0].After == nil || !pay.RollbackSafe {
+		t.Fatalf("Pay = %+v, want one abort after a write", pay)
+	}
+	if line := lineOf(analysis.FileSet, pay.Aborts[0].After.Site.Pos); line != 23 {
+		t.Errorf("the abort of Pay follows the write at line %d, want 23", line)
+	}
+	if pay.FirstPieceEnd != pay.Aborts[0].Exit {
+		t.Errorf("the first piece of Pay does not end at its abort")
+	}
+}
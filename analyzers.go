@@ -0,0 +1,257 @@
+package stcpsce
+
+import (
+	"container/list"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"reflect"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// ReadWriteFact
+//
+// @description:	This is the fact exported for every function of a package reading or writing the state, with the
+//positions of its arguments which the keys depend on, as found in Phase 2. It lets a package calling the function see
+//its accesses.
+//
+type ReadWriteFact struct {
+	GetState []int
+	PutState []int
+}
+
+// AFact marks ReadWriteFact as a fact.
+func (*ReadWriteFact) AFact() {}
+
+func (fact *ReadWriteFact) String() string {
+	return fmt.Sprintf("GetState%v PutState%v", fact.GetState, fact.PutState)
+}
+
+// ReadWriteResult
+//
+// @description:	This is the result of the Phase 2 analyzer, the maps of `GetState` and `PutState` expressions of
+//the package.
+//
+type ReadWriteResult struct {
+	GetStateMap map[string][]int
+	PutStateMap map[string][]int
+}
+
+// ReadWriteAnalyzer runs Phase 2 on a package.
+var ReadWriteAnalyzer = &analysis.Analyzer{
+	Name: "readwrite",
+	Doc: "find the arguments of every function which the keys of its GetState and PutState calls depend on\n\n" +
+		"The positions are exported as facts, so the calls of the functions of imported packages are followed.",
+	Run:        runReadWriteAnalyzer,
+	ResultType: reflect.TypeOf((*ReadWriteResult)(nil)),
+	FactTypes:  []analysis.Fact{(*ReadWriteFact)(nil)},
+}
+
+// ChoppingAnalyzer runs Phase 1 on a package.
+var ChoppingAnalyzer = &analysis.Analyzer{
+	Name: "chopping",
+	Doc: "find the parallelizable statements of every function\n\n" +
+		"An assignment or an update is parallelizable when its operands do not depend on the state read by the " +
+		"conditions before it. The lines it derives from are reported with it.",
+	Run:      runChoppingAnalyzer,
+	Requires: []*analysis.Analyzer{ReadWriteAnalyzer},
+}
+
+// @title:	buildPackageAst
+//
+// @description:	This is used to build the nodes of the files of a package.
+//
+// @param: 	pass *analysis.Pass	The pass of the analyzer.
+//
+// @return:	files []*Ast	List of the root nodes of the files.
+//
+// @return:	declarations *Ast	The node holding the declarations of every file.
+//
+// @return:	err error	If the nodes can be built, return nil, otherwise return an error.
+//
+func buildPackageAst(pass *analysis.Pass) (files []*Ast, declarations *Ast, err error) {
+	files = []*Ast{}
+	declarations = &Ast{Label: "Decls : []ast.Decl", Attrs: map[string]string{}, Children: []*Ast{}}
+	for x := range pass.Files {
+		file, err := BuildAst("", pass.Files[x])
+		if err != nil {
+			return nil, nil, err
+		}
+		files = append(files, file)
+		decls := findChild(file, "Decls")
+		if decls == nil {
+			continue
+		}
+		// A function declared without a body, which is implemented in assembly, is skipped.
+		for y := range decls.Children {
+			if !strings.Contains(decls.Children[y].Label, "FuncDecl") || findFunctionBody(decls.Children[y]) != nil {
+				declarations.Children = append(declarations.Children, decls.Children[y])
+			}
+		}
+	}
+	return files, declarations, nil
+}
+
+// @title:	accessesLedger
+//
+// @description:	This is used to determine if a package may access the ledger, which is when it imports the shim of
+//the chaincodes or calls a function of another package with a fact. The other packages, like the standard library,
+//are not analyzed.
+//
+// @param: 	pass *analysis.Pass	The pass of the analyzer.
+//
+// @return:	bool		If the package may access the ledger, return true, otherwise return false.
+//
+func accessesLedger(pass *analysis.Pass) bool {
+	for _, imported := range pass.Pkg.Imports() {
+		if imported.Name() == "shim" || strings.HasSuffix(imported.Path(), "/shim") {
+			return true
+		}
+	}
+	return len(pass.AllObjectFacts()) != 0
+}
+
+// @title:	runReadWriteAnalyzer
+//
+// @description:	This is used to run Phase 2 on the files of a package. The maps are seeded with the facts of the
+//functions of other packages the files call, keyed by the name they are called with, and a fact is exported for every
+//function of the package accessing the state. The accesses are only kept in the facts and the result, the functions
+//failing to be analyzed are the only diagnostics.
+//
+// @param: 	pass *analysis.Pass	The pass of the analyzer.
+//
+// @return:	interface{}	The `*ReadWriteResult` of the package.
+//
+// @return:	error		If the files can be analyzed, return nil, otherwise return an error.
+//
+func runReadWriteAnalyzer(pass *analysis.Pass) (interface{}, error) {
+	result := &ReadWriteResult{GetStateMap: map[string][]int{}, PutStateMap: map[string][]int{}}
+	if !accessesLedger(pass) {
+		return result, nil
+	}
+	_, declarations, err := buildPackageAst(pass)
+	if err != nil {
+		return nil, err
+	}
+	for x := range pass.Files {
+		ast.Inspect(pass.Files[x], func(node ast.Node) bool {
+			selector, ok := node.(*ast.SelectorExpr)
+			if !ok {
+				return true
+			}
+			qualifier, ok := selector.X.(*ast.Ident)
+			function, isFunction := pass.TypesInfo.Uses[selector.Sel].(*types.Func)
+			fact := &ReadWriteFact{}
+			if ok && isFunction && function.Pkg() != pass.Pkg && pass.ImportObjectFact(function, fact) {
+				result.GetStateMap[qualifier.Name+"."+selector.Sel.Name] = fact.GetState
+				result.PutStateMap[qualifier.Name+"."+selector.Sel.Name] = fact.PutState
+			}
+			return true
+		})
+	}
+	failures := list.New()
+	updateReadWriteAPI(declarations, result.GetStateMap, result.PutStateMap, nil, failures)
+	for _, failure := range listDiagnostics(failures) {
+		pass.Reportf(token.Pos(failure.Pos), "%s", failure.Message)
+	}
+	for x := range pass.Files {
+		for _, declaration := range pass.Files[x].Decls {
+			function, ok := declaration.(*ast.FuncDecl)
+			if !ok {
+				continue
+			}
+			name := function.Name.Name
+			if len(result.GetStateMap[name]) == 0 && len(result.PutStateMap[name]) == 0 {
+				continue
+			}
+			if object := pass.TypesInfo.Defs[function.Name]; object != nil {
+				pass.ExportObjectFact(object, &ReadWriteFact{GetState: result.GetStateMap[name],
+					PutState: result.PutStateMap[name]})
+			}
+		}
+	}
+	return result, nil
+}
+
+// @title:	runChoppingAnalyzer
+//
+// @description:	This is used to run Phase 1 on the files of a package, reporting every parallelizable statement with
+//the lines it derives from. The functions found non-choppable by the analysis of concurrency and of the package-level
+//variables of their file are skipped like on the command line.
+//
+// @param: 	pass *analysis.Pass	The pass of the analyzer.
+//
+// @return:	interface{}	Nothing.
+//
+// @return:	error		If the files can be analyzed, return nil, otherwise return an error.
+//
+func runChoppingAnalyzer(pass *analysis.Pass) (interface{}, error) {
+	result := pass.ResultOf[ReadWriteAnalyzer].(*ReadWriteResult)
+	if !accessesLedger(pass) {
+		return nil, nil
+	}
+	files, _, err := buildPackageAst(pass)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		_, nonChoppable := analyzeConcurrency(file, result.PutStateMap, nil, nil)
+		mergeNonChoppable(nonChoppable, findPackageVariableDependents(analyzePackageVariables(file, nil)))
+		failures := list.New()
+		posList := analyzeFunctionDeclaration(file, nonChoppable, nil, nil, failures)
+		for _, failure := range listDiagnostics(failures) {
+			pass.Reportf(token.Pos(failure.Pos), "%s", failure.Message)
+		}
+		for pos := posList.Front(); pos != nil; pos = pos.Next() {
+			chain := pos.Value.([]*Ast)
+			if len(chain) == 0 {
+				continue
+			}
+			pass.Reportf(token.Pos(chain[0].Pos), "%s", describeChain(chain, pass.Fset))
+		}
+	}
+	return nil, nil
+}
+
+// @title:	describeChain
+//
+// @description:	This is used to describe a chain of Phase 1 by its parallelizable statement and the lines it derives
+//from.
+//
+// @param: 	chain []*Ast	The chain, the parallelizable statement first.
+//
+// @param: 	fileSet *token.FileSet	The file set which the source code is parsed with.
+//
+// @return:	string		The description.
+//
+func describeChain(chain []*Ast, fileSet *token.FileSet) string {
+	lines := []string{}
+	for x := 1; x < len(chain); x++ {
+		lines = append(lines, fmt.Sprint(lineOf(fileSet, chain[x].Pos)))
+	}
+	if len(lines) == 0 {
+		return "parallelizable statement"
+	}
+	return "parallelizable statement, derives from lines " + strings.Join(lines, ", ")
+}
+
+// @title:	describeReadWriteAPI
+//
+// @description:	This is used to describe the arguments of a function which the keys it reads and writes depend on, as
+//found in Phase 2.
+//
+// @param: 	name string	The name of the function.
+//
+// @param: 	GetStateMap map[string][]int	Map of `GetState` expressions.
+//
+// @param: 	PutStateMap map[string][]int	Map of `PutState` expressions.
+//
+// @return:	string		The description.
+//
+func describeReadWriteAPI(name string, GetStateMap map[string][]int, PutStateMap map[string][]int) string {
+	return fmt.Sprintf("%s reads keys from arguments %v and writes keys from arguments %v", name, GetStateMap[name],
+		PutStateMap[name])
+}
@@ -0,0 +1,15 @@
+package stcpsce
+
+import (
+	"testing"
+
+	"golang.org/x/tools/go/analysis/analysistest"
+)
+
+func TestReadWriteAnalyzer(t *testing.T) {
+	analysistest.Run(t, analysistest.TestData(), ReadWriteAnalyzer, "ledger", "bank")
+}
+
+func TestChoppingAnalyzer(t *testing.T) {
+	analysistest.Run(t, analysistest.TestData(), ChoppingAnalyzer, "chop")
+}
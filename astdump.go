@@ -0,0 +1,380 @@
+package stcpsce
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// astPositionAttrs holds the names of the `token.Pos` fields of the nodes of `go/ast`, which `BuildAst` stores as
+// attributes.
+var astPositionAttrs = map[string]bool{
+	"Arrow": true, "Assign": true, "Begin": true, "Case": true, "Closing": true, "Colon": true, "Defer": true,
+	"Ellipsis": true, "EndPos": true, "FileEnd": true, "FileStart": true, "For": true, "From": true, "Func": true,
+	"Go": true, "If": true, "Interface": true, "Lbrace": true, "Lbrack": true, "Lparen": true, "Map": true,
+	"NamePos": true, "OpPos": true, "Opening": true, "Package": true, "Range": true, "Rbrace": true, "Rbrack": true,
+	"Return": true, "Rparen": true, "Select": true, "Semicolon": true, "Slash": true, "Star": true, "Struct": true,
+	"Switch": true, "To": true, "TokPos": true, "ValuePos": true,
+}
+
+// AstDump
+//
+// @description:	This is used to write and read the AST of a source file as JSON. The lines of the file are kept with
+//it, so the positions can be restored without the source code.
+//
+type AstDump struct {
+	Filename string `json:"filename,omitempty"`
+	// Size is the size of the source code, and Lines holds the offsets its lines start at.
+	Size  int   `json:"size,omitempty"`
+	Lines []int `json:"lines,omitempty"`
+	// Positions is `line:col` or `raw`, a dump without it holding raw positions like `ast.json`.
+	Positions string       `json:"positions,omitempty"`
+	Ast       *AstDumpNode `json:"ast"`
+}
+
+// AstDumpNode
+//
+// @description:	This is used to write and read a node of the AST. A position is either a raw `token.Pos` of a file
+//starting at 1, or a `line:col` string, which is left out if the node has no position.
+//
+type AstDumpNode struct {
+	Label    string            `json:"label"`
+	Pos      interface{}       `json:"pos,omitempty"`
+	End      interface{}       `json:"end,omitempty"`
+	Attrs    map[string]string `json:"attrs,omitempty"`
+	Children []*AstDumpNode    `json:"children,omitempty"`
+}
+
+// DumpOptions holds the options of the JSON an AST is dumped to.
+type DumpOptions struct {
+	Compact      bool
+	RawPositions bool
+	// Prune leaves out the nodes with neither a position, an attribute nor a child, like empty lists, when they are
+	// the last children of their parent and the analyses do not require them, so the other children keep their
+	// indices.
+	Prune bool
+}
+
+// @title:	fileLines
+//
+// @description:	This is used to find the offsets the lines of a file start at.
+//
+// @param: 	file *token.File	The file.
+//
+// @return:	lines []int	List of offsets, one per line.
+//
+func fileLines(file *token.File) (lines []int) {
+	lines = []int{}
+	for line := 1; line <= file.LineCount(); line++ {
+		lines = append(lines, file.Offset(file.LineStart(line)))
+	}
+	return lines
+}
+
+// @title:	formatDumpPosition
+//
+// @description:	This is used to format a position of a node or an attribute for a dump.
+//
+// @param: 	pos int		The position.
+//
+// @param: 	file *token.File	The file of the position.
+//
+// @param: 	options *DumpOptions	The options.
+//
+// @return:	interface{}		The raw position as a number, or `line:col`, or nil if there is no position.
+//
+func formatDumpPosition(pos int, file *token.File, options *DumpOptions) interface{} {
+	if options.RawPositions {
+		if pos == 0 {
+			return 0
+		}
+		return pos - file.Base() + 1
+	}
+	if pos == 0 {
+		return nil
+	}
+	position := file.Position(token.Pos(pos))
+	return fmt.Sprintf("%d:%d", position.Line, position.Column)
+}
+
+// @title:	dumpAstNode
+//
+// @description:	This is used to convert a node and its children for a dump.
+//
+// @param: 	ast *Ast	The node.
+//
+// @param: 	file *token.File	The file of the node.
+//
+// @param: 	options *DumpOptions	The options.
+//
+// @return:	node *AstDumpNode	The node of the dump.
+//
+func dumpAstNode(ast *Ast, file *token.File, options *DumpOptions) (node *AstDumpNode) {
+	if ast == nil {
+		return nil
+	}
+	node = &AstDumpNode{Label: ast.Label, Pos: formatDumpPosition(ast.Pos, file, options),
+		End: formatDumpPosition(ast.End, file, options), Attrs: map[string]string{}, Children: []*AstDumpNode{}}
+	for name, value := range ast.Attrs {
+		if pos, err := strconv.Atoi(value); err == nil && pos != 0 && astPositionAttrs[name] {
+			value = fmt.Sprint(formatDumpPosition(pos, file, options))
+		}
+		node.Attrs[name] = value
+	}
+	for _, child := range ast.Children {
+		node.Children = append(node.Children, dumpAstNode(child, file, options))
+	}
+	// The analyses find most children by their index, so only the ones at the end can be left out.
+	for options.Prune && len(node.Children) != 0 {
+		last := ast.Children[len(node.Children)-1]
+		if last == nil || last.Pos != 0 || last.End != 0 || len(last.Attrs) != 0 ||
+			len(node.Children[len(node.Children)-1].Children) != 0 || isRequiredChild(astLabelKind(ast.Label), last.Label) {
+			break
+		}
+		node.Children = node.Children[:len(node.Children)-1]
+	}
+	return node
+}
+
+// @title:	isRequiredChild
+//
+// @description:	This is used to determine if the analyses require a child of a node, so a dump must keep it.
+//
+// @param: 	kind string	The kind of the node.
+//
+// @param: 	label string	The label of the child.
+//
+// @return:	bool		If the child is required, return true, otherwise return false.
+//
+func isRequiredChild(kind string, label string) bool {
+	for _, name := range astRequiredChildren[kind] {
+		if strings.HasPrefix(label, name+" :") {
+			return true
+		}
+	}
+	return false
+}
+
+// @title:	newAstDump
+//
+// @description:	This is used to prepare the dump of the AST of a file.
+//
+// @param: 	ast *Ast	The root node of the file.
+//
+// @param: 	fileSet *token.FileSet	The file set which the source code is parsed with.
+//
+// @param: 	options *DumpOptions	The options.
+//
+// @return:	dump *AstDump	The dump.
+//
+func newAstDump(ast *Ast, fileSet *token.FileSet, options *DumpOptions) (dump *AstDump) {
+	file := fileSet.File(token.Pos(ast.Pos))
+	dump = &AstDump{Filename: file.Name(), Size: file.Size(), Lines: fileLines(file), Positions: "line:col"}
+	if options.RawPositions {
+		dump.Positions = "raw"
+	}
+	dump.Ast = dumpAstNode(ast, file, options)
+	return dump
+}
+
+// @title:	writeAstDump
+//
+// @description:	This is used to write the dump of the AST of a file as JSON, without escaping the `&` and `<` of
+//the labels and the attributes.
+//
+// @param: 	output io.Writer	The output.
+//
+// @param: 	ast *Ast	The root node of the file.
+//
+// @param: 	fileSet *token.FileSet	The file set which the source code is parsed with.
+//
+// @param: 	options *DumpOptions	The options.
+//
+// @return:	err error	If the dump can be written, return nil, otherwise return an error.
+//
+func writeAstDump(output io.Writer, ast *Ast, fileSet *token.FileSet, options *DumpOptions) (err error) {
+	encoder := json.NewEncoder(output)
+	encoder.SetEscapeHTML(false)
+	if !options.Compact {
+		encoder.SetIndent("", "  ")
+	}
+	return encoder.Encode(newAstDump(ast, fileSet, options))
+}
+
+// @title:	restoreDumpPosition
+//
+// @description:	This is used to convert a position of a dump back to a position of the file.
+//
+// @param: 	value interface{}	The position as a number, a string of a number or `line:col`, or nil.
+//
+// @param: 	file *token.File	The file restored from the dump.
+//
+// @return:	pos int		The position, 0 if there is none.
+//
+// @return:	err error	If the position is in the file, return nil, otherwise return an error.
+//
+func restoreDumpPosition(value interface{}, file *token.File) (pos int, err error) {
+	switch v := value.(type) {
+	case nil:
+		return 0, nil
+	case float64:
+		if v != float64(int(v)) {
+			return 0, fmt.Errorf("position %v is not an integer", v)
+		}
+		pos = int(v)
+	case string:
+		fields := strings.Split(v, ":")
+		if len(fields) == 1 {
+			if pos, err = strconv.Atoi(v); err != nil {
+				return 0, fmt.Errorf("position %q is neither a number nor line:col", v)
+			}
+			break
+		}
+		line, lineErr := strconv.Atoi(fields[0])
+		column, columnErr := strconv.Atoi(fields[1])
+		if len(fields) != 2 || lineErr != nil || columnErr != nil || line < 1 || line > file.LineCount() ||
+			column < 1 {
+			return 0, fmt.Errorf("position %q is not a line:col of the file", v)
+		}
+		offset := file.Offset(file.LineStart(line)) + column - 1
+		if offset > file.Size() {
+			return 0, fmt.Errorf("position %q is after the end of the file", v)
+		}
+		return int(file.Pos(offset)), nil
+	default:
+		return 0, fmt.Errorf("position %v is neither a number nor line:col", v)
+	}
+	if pos != 0 && (pos < file.Base() || pos > file.Base()+file.Size()) {
+		return 0, fmt.Errorf("position %d is outside of the file", pos)
+	}
+	return pos, nil
+}
+
+// @title:	restoreAstNode
+//
+// @description:	This is used to convert a node of a dump and its children back to `Ast`.
+//
+// @param: 	node *AstDumpNode	The node of the dump.
+//
+// @param: 	file *token.File	The file restored from the dump.
+//
+// @return:	ast *Ast	The node, or nil if the node of the dump is null.
+//
+// @return:	err error	If every position is in the file, return nil, otherwise return an error naming the node.
+//
+func restoreAstNode(node *AstDumpNode, file *token.File) (ast *Ast, err error) {
+	if node == nil {
+		return nil, nil
+	}
+	ast = &Ast{Label: node.Label, Attrs: map[string]string{}, Children: []*Ast{}}
+	if ast.Pos, err = restoreDumpPosition(node.Pos, file); err != nil {
+		return nil, fmt.Errorf("%s: pos: %v", node.Label, err)
+	}
+	if ast.End, err = restoreDumpPosition(node.End, file); err != nil {
+		return nil, fmt.Errorf("%s: end: %v", node.Label, err)
+	}
+	for name, value := range node.Attrs {
+		if astPositionAttrs[name] && strings.Contains(value, ":") {
+			pos, err := restoreDumpPosition(value, file)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s: %v", node.Label, name, err)
+			}
+			value = strconv.Itoa(pos)
+		}
+		ast.Attrs[name] = value
+	}
+	for _, child := range node.Children {
+		restored, err := restoreAstNode(child, file)
+		if err != nil {
+			return nil, err
+		}
+		ast.Children = append(ast.Children, restored)
+	}
+	return ast, nil
+}
+
+// @title:	findDumpSize
+//
+// @description:	This is used to guess the size of the source code of a dump without it, from the last raw position of
+//its nodes.
+//
+// @param: 	node *AstDumpNode	The root node of the dump.
+//
+// @return:	size int	The size.
+//
+func findDumpSize(node *AstDumpNode) (size int) {
+	if node == nil {
+		return 0
+	}
+	for _, value := range []interface{}{node.Pos, node.End} {
+		if pos, ok := value.(float64); ok && int(pos)-1 > size {
+			size = int(pos) - 1
+		}
+	}
+	for _, child := range node.Children {
+		if childSize := findDumpSize(child); childSize > size {
+			size = childSize
+		}
+	}
+	return size
+}
+
+// @title:	loadAstDump
+//
+// @description:	This is used to read the AST of a file back from a dump, written by `dump-ast` or another tool, and
+//check it against the schema of `ast.schema.json` and `validateAst`. The file set is restored from the lines of the
+//dump, so the lines of the nodes are known without the source code. A dump without lines, like `ast.json`, has every
+//node on line 1.
+//
+// @param: 	filename string	The name of the dump, used for the file if the dump does not name it.
+//
+// @param: 	body []byte	The dump.
+//
+// @return:	ast *Ast	The root node of the file.
+//
+// @return:	fileSet *token.FileSet	The file set restored from the dump.
+//
+// @return:	err error	If the dump can be read, return nil, otherwise return an error.
+//
+func loadAstDump(filename string, body []byte) (ast *Ast, fileSet *token.FileSet, err error) {
+	dump := &AstDump{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(dump); err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	if dump.Ast == nil {
+		return nil, nil, fmt.Errorf("%s: the dump has no ast", filename)
+	}
+	if dump.Positions != "" && dump.Positions != "raw" && dump.Positions != "line:col" {
+		return nil, nil, fmt.Errorf("%s: positions %q are neither raw nor line:col", filename, dump.Positions)
+	}
+	if dump.Size < 0 {
+		return nil, nil, fmt.Errorf("%s: the size is negative", filename)
+	} else if dump.Size == 0 {
+		dump.Size = findDumpSize(dump.Ast)
+	}
+	name := filename
+	if dump.Filename != "" {
+		name = dump.Filename
+	}
+	fileSet = token.NewFileSet()
+	file := fileSet.AddFile(name, 1, dump.Size)
+	if len(dump.Lines) != 0 && !file.SetLines(dump.Lines) {
+		return nil, nil, fmt.Errorf("%s: the lines are not increasing offsets in the file", filename)
+	}
+	if ast, err = restoreAstNode(dump.Ast, file); err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	if astLabelKind(ast.Label) != "*ast.File" {
+		return nil, nil, fmt.Errorf("%s: the root node is %s instead of *ast.File", filename, ast.Label)
+	}
+	if err = validateAst(ast, fileSet); err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return ast, fileSet, nil
+}
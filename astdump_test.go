@@ -0,0 +1,119 @@
+package stcpsce
+
+import (
+	"go/token"
+	"strings"
+	"testing"
+)
+
+// dumpSource has the empty lists `-prune` may leave out: the arguments of a call, the parameters and results of a
+//function, the names of an embedded field, the results of a return, the elements of a literal and a default case.
+const dumpSource = `package main
+
+import "github.com/hyperledger/fabric/core/chaincode/shim"
+
+type SmartContract struct{}
+
+type Account struct {
+	shim.ChaincodeStubInterface
+	Balance int
+}
+
+func empty() {}
+
+func (s *SmartContract) Pay(stub shim.ChaincodeStubInterface, args []string) error {
+	account := &Account{}
+	empty()
+	switch args[0] {
+	default:
+		account.Balance++
+	}
+	stub.PutState(args[1], []byte{})
+	return nil
+}
+
+func (s *SmartContract) Query(stub shim.ChaincodeStubInterface, args []string) {
+	value, _ := stub.GetState(args[0])
+	_ = value
+	return
+}
+`
+
+func TestDumpRoundTrip(t *testing.T) {
+	analysis := analyzeTestSource(t, dumpSource)
+	want := &strings.Builder{}
+	if _, err := runPhase1Command(analysis, &CommandOptions{}, want); err != nil {
+		t.Fatalf("phase1: %v", err)
+	}
+	for _, compact := range []bool{false, true} {
+		for _, raw := range []bool{false, true} {
+			for _, prune := range []bool{false, true} {
+				options := &CommandOptions{Dump: DumpOptions{Compact: compact, RawPositions: raw, Prune: prune}}
+				dump := &strings.Builder{}
+				if _, err := runDumpAstCommand(analysis, options, dump); err != nil {
+					t.Fatalf("%+v: dump-ast: %v", options.Dump, err)
+				}
+				loaded, err := analyzeDump("test.json", []byte(dump.String()), nil, nil)
+				if err != nil {
+					t.Errorf("%+v: the dump is rejected: %v", options.Dump, err)
+					continue
+				}
+				got := &strings.Builder{}
+				if _, err = runPhase1Command(loaded, &CommandOptions{}, got); err != nil {
+					t.Fatalf("%+v: phase1: %v", options.Dump, err)
+				}
+				if got.String() != want.String() {
+					t.Errorf("%+v: phase1 of the dump = %q, want %q", options.Dump, got.String(), want.String())
+				}
+				if len(loaded.Accesses) != len(analysis.Accesses) {
+					t.Errorf("%+v: accesses = %d, want %d", options.Dump, len(loaded.Accesses), len(analysis.Accesses))
+				}
+				redump := &strings.Builder{}
+				if _, err = runDumpAstCommand(loaded, options, redump); err != nil {
+					t.Fatalf("%+v: dump-ast of the dump: %v", options.Dump, err)
+				}
+				if !prune && redump.String() != dump.String() {
+					t.Errorf("%+v: the dump of the dump differs", options.Dump)
+				}
+			}
+		}
+	}
+}
+
+func TestRestoreDumpPosition(t *testing.T) {
+	source := "package main\n\nfunc Pay() {}\n"
+	file := token.NewFileSet().AddFile("test.go", -1, len(source))
+	file.SetLinesForContent([]byte(source))
+	for _, test := range []struct {
+		value interface{}
+		pos   int
+		err   bool
+	}{
+		{nil, 0, false},
+		{float64(file.Base() + 3), file.Base() + 3, false},
+		{"3:6", file.Base() + 19, false},
+		{"3:14", file.Base() + 27, false},
+		{"3:16", 0, true},
+		{"0:1", 0, true},
+		{"5:1", 0, true},
+		{"1:0", 0, true},
+		{"1:2:3", 0, true},
+		{"pay", 0, true},
+		{1.5, 0, true},
+		{float64(file.Base() + len(source) + 1), 0, true},
+		{true, 0, true},
+	} {
+		pos, err := restoreDumpPosition(test.value, file)
+		if test.err && err == nil {
+			t.Errorf("%v is restored to %d, want an error", test.value, pos)
+		} else if !test.err && (err != nil || pos != test.pos) {
+			t.Errorf("%v is restored to %d, %v, want %d", test.value, pos, err, test.pos)
+		}
+	}
+	for _, options := range []*DumpOptions{{}, {RawPositions: true}} {
+		value := formatDumpPosition(file.Base()+19, file, options)
+		if options.RawPositions && value != 20 || !options.RawPositions && value != "3:6" {
+			t.Errorf("%+v: the position is formatted as %v", *options, value)
+		}
+	}
+}
@@ -0,0 +1,278 @@
+package stcpsce
+
+import (
+	"fmt"
+	"go/token"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// astRequiredChildren maps the kinds of nodes to the fields the analyses read from them, which a dump must keep.
+var astRequiredChildren = map[string][]string{
+	"*ast.File":         {"Decls"},
+	"*ast.FuncDecl":     {"Name", "Type"},
+	"*ast.FuncType":     {"Params"},
+	"*ast.FieldList":    {"List"},
+	"*ast.BlockStmt":    {"List"},
+	"*ast.AssignStmt":   {"Lhs", "Rhs"},
+	"*ast.CallExpr":     {"Fun", "Args"},
+	"*ast.SelectorExpr": {"X", "Sel"},
+	"*ast.IfStmt":       {"Cond", "Body"},
+	"*ast.ReturnStmt":   {"Results"},
+}
+
+// astRequiredAttrs maps the kinds of nodes to the attributes the analyses read from them.
+var astRequiredAttrs = map[string][]string{
+	"*ast.Ident":      {"Name"},
+	"*ast.BasicLit":   {"Kind", "Value"},
+	"*ast.AssignStmt": {"Tok"},
+}
+
+// astListLength matches the length at the end of the label of a slice or a map, like `[]ast.Decl(len = 26)`.
+var astListLength = regexp.MustCompile(`\(len = (\d+)\)$`)
+
+// @title:	astLabelKind
+//
+// @description:	This is used to find the kind of a node from its label, like `*ast.GenDecl` for
+//`0 : *ast.GenDecl (Tok: import)`.
+//
+// @param: 	label string	The label of the node.
+//
+// @return:	string		The type of the node.
+//
+func astLabelKind(label string) string {
+	if x := strings.Index(label, " : "); x >= 0 {
+		label = label[x+3:]
+	}
+	if x := strings.IndexAny(label, " ("); x >= 0 {
+		label = label[:x]
+	}
+	return label
+}
+
+// @title:	validateAst
+//
+// @description:	This is used to check a node read from a dump and its children against the schema of the AST the
+//analyses expect: every node has a label and a range which is not reversed, a slice or a map has as many children as
+//its label tells and the fields of `astRequiredChildren` and `astRequiredAttrs` are present. `-prune` keeps these fields.
+//
+// @param: 	ast *Ast	The node.
+//
+// @param: 	fileSet *token.FileSet	The file set restored from the dump.
+//
+// @return:	err error	If the node matches the schema, return nil, otherwise return an error naming the node.
+//
+func validateAst(ast *Ast, fileSet *token.FileSet) (err error) {
+	where := func(format string, args ...interface{}) error {
+		if ast.Pos == 0 {
+			return fmt.Errorf("%s: %s", ast.Label, fmt.Sprintf(format, args...))
+		}
+		return fmt.Errorf("line %d: %s: %s", lineOf(fileSet, ast.Pos), ast.Label, fmt.Sprintf(format, args...))
+	}
+	if ast.Label == "" {
+		return where("the node has no label")
+	}
+	if ast.Pos != 0 && ast.End != 0 && ast.End < ast.Pos {
+		return where("the node ends before it starts")
+	}
+	for x := range ast.Children {
+		if ast.Children[x] == nil {
+			return where("child %d is null", x)
+		}
+	}
+	kind := astLabelKind(ast.Label)
+	if match := astListLength.FindStringSubmatch(ast.Label); match != nil {
+		if length, _ := strconv.Atoi(match[1]); length != len(ast.Children) {
+			return where("the node has %d children instead of %d", len(ast.Children), length)
+		}
+	}
+	for _, name := range astRequiredChildren[kind] {
+		if findChild(ast, name) == nil {
+			return where("the node has no %s child", name)
+		}
+	}
+	for _, name := range astRequiredAttrs[kind] {
+		if _, ok := ast.Attrs[name]; !ok {
+			return where("the node has no %s attribute", name)
+		}
+	}
+	for _, child := range ast.Children {
+		if err = validateAst(child, fileSet); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// @title:	formatAstList
+//
+// @description:	This is used to format the elements of a slice field of a node.
+//
+// @param: 	ast *Ast	The node.
+//
+// @param: 	name string	The name of the field.
+//
+// @return:	string		The formatted elements separated by commas.
+//
+func formatAstList(ast *Ast, name string) string {
+	list := findChild(ast, name)
+	if list == nil {
+		return ""
+	}
+	elements := []string{}
+	for _, child := range list.Children {
+		elements = append(elements, formatAst(child))
+	}
+	return strings.Join(elements, ", ")
+}
+
+// @title:	formatAst
+//
+// @description:	This is used to format a node as Go source code, for an AST read from a dump without the source
+//code. The expressions and the simple statements are formatted in full, the bodies of the others are left as `{...}`,
+//and a node of another kind as `...`.
+//
+// @param: 	ast *Ast	The node.
+//
+// @return:	string		The source code of the node.
+//
+func formatAst(ast *Ast) string {
+	if ast == nil {
+		return ""
+	}
+	child := func(name string) string {
+		return formatAst(findChild(ast, name))
+	}
+	prefix := func(text string, name string) string {
+		if formatted := child(name); formatted != "" {
+			return text + formatted
+		}
+		return ""
+	}
+	suffix := func(name string, text string) string {
+		if formatted := child(name); formatted != "" {
+			return formatted + text
+		}
+		return ""
+	}
+	switch astLabelKind(ast.Label) {
+	case "*ast.Ident":
+		return ast.Attrs["Name"]
+	case "*ast.BasicLit":
+		return ast.Attrs["Value"]
+	case "*ast.SelectorExpr":
+		return child("X") + "." + child("Sel")
+	case "*ast.CallExpr":
+		ellipsis := ""
+		if ast.Attrs["Ellipsis"] != "" && ast.Attrs["Ellipsis"] != "0" {
+			ellipsis = "..."
+		}
+		return child("Fun") + "(" + formatAstList(ast, "Args") + ellipsis + ")"
+	case "*ast.IndexExpr":
+		return child("X") + "[" + child("Index") + "]"
+	case "*ast.IndexListExpr":
+		return child("X") + "[" + formatAstList(ast, "Indices") + "]"
+	case "*ast.SliceExpr":
+		text := child("X") + "[" + child("Low") + ":" + child("High")
+		if ast.Attrs["Slice3"] == "true" {
+			text += ":" + child("Max")
+		}
+		return text + "]"
+	case "*ast.StarExpr":
+		return "*" + child("X")
+	case "*ast.UnaryExpr":
+		return ast.Attrs["Op"] + child("X")
+	case "*ast.BinaryExpr":
+		return child("X") + " " + ast.Attrs["Op"] + " " + child("Y")
+	case "*ast.ParenExpr":
+		return "(" + child("X") + ")"
+	case "*ast.KeyValueExpr":
+		return child("Key") + ": " + child("Value")
+	case "*ast.CompositeLit":
+		return child("Type") + "{" + formatAstList(ast, "Elts") + "}"
+	case "*ast.TypeAssertExpr":
+		if findChild(ast, "Type") == nil {
+			return child("X") + ".(type)"
+		}
+		return child("X") + ".(" + child("Type") + ")"
+	case "*ast.ArrayType":
+		return "[" + child("Len") + "]" + child("Elt")
+	case "*ast.MapType":
+		return "map[" + child("Key") + "]" + child("Value")
+	case "*ast.ChanType":
+		return "chan " + child("Value")
+	case "*ast.Ellipsis":
+		return "..." + child("Elt")
+	case "*ast.StructType":
+		return "struct{...}"
+	case "*ast.InterfaceType":
+		return "interface{...}"
+	case "*ast.Field":
+		return strings.TrimSpace(formatAstList(ast, "Names") + " " + child("Type"))
+	case "*ast.FieldList":
+		return formatAstList(ast, "List")
+	case "*ast.FuncType":
+		results := child("Results")
+		if results != "" && (strings.Contains(results, " ") || strings.Contains(results, ",")) {
+			results = "(" + results + ")"
+		}
+		return strings.TrimSpace("func(" + child("Params") + ") " + results)
+	case "*ast.FuncLit":
+		return child("Type") + " {...}"
+	case "*ast.ExprStmt":
+		return child("X")
+	case "*ast.AssignStmt":
+		return formatAstList(ast, "Lhs") + " " + ast.Attrs["Tok"] + " " + formatAstList(ast, "Rhs")
+	case "*ast.IncDecStmt":
+		return child("X") + ast.Attrs["Tok"]
+	case "*ast.SendStmt":
+		return child("Chan") + " <- " + child("Value")
+	case "*ast.ReturnStmt":
+		return strings.TrimSpace("return " + formatAstList(ast, "Results"))
+	case "*ast.GoStmt":
+		return "go " + child("Call")
+	case "*ast.DeferStmt":
+		return "defer " + child("Call")
+	case "*ast.BranchStmt":
+		return ast.Attrs["Tok"] + prefix(" ", "Label")
+	case "*ast.DeclStmt":
+		return child("Decl")
+	case "*ast.GenDecl":
+		specs := findChild(ast, "Specs")
+		if specs != nil && len(specs.Children) == 1 {
+			return ast.Attrs["Tok"] + " " + formatAst(specs.Children[0])
+		}
+		return ast.Attrs["Tok"] + " (...)"
+	case "*ast.ValueSpec":
+		text := formatAstList(ast, "Names") + prefix(" ", "Type")
+		if values := formatAstList(ast, "Values"); values != "" {
+			text += " = " + values
+		}
+		return text
+	case "*ast.TypeSpec":
+		return child("Name") + " " + child("Type")
+	case "*ast.BlockStmt":
+		return "{...}"
+	case "*ast.IfStmt":
+		return "if " + suffix("Init", "; ") + child("Cond") + " {...}" + prefix(" else ", "Else")
+	case "*ast.ForStmt":
+		if findChild(ast, "Init") == nil && findChild(ast, "Post") == nil {
+			return "for " + suffix("Cond", " ") + "{...}"
+		}
+		return "for " + child("Init") + "; " + child("Cond") + "; " + child("Post") + " {...}"
+	case "*ast.RangeStmt":
+		keys := child("Key") + prefix(", ", "Value")
+		if keys == "" {
+			return "for range " + child("X") + " {...}"
+		}
+		return "for " + keys + " " + ast.Attrs["Tok"] + " range " + child("X") + " {...}"
+	case "*ast.SwitchStmt":
+		return "switch " + suffix("Init", "; ") + suffix("Tag", " ") + "{...}"
+	case "*ast.TypeSwitchStmt":
+		return "switch " + suffix("Init", "; ") + child("Assign") + " {...}"
+	case "*ast.SelectStmt":
+		return "select {...}"
+	}
+	return "..."
+}
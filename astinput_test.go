@@ -0,0 +1,59 @@
+package stcpsce
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateDump(t *testing.T) {
+	analysis, err := parseSource("test.go", "package main\n\nfunc Pay(note string) {\n\tmemo := note\n\t_ = memo\n}\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := &strings.Builder{}
+	if _, err = runDumpAstCommand(analysis, &CommandOptions{Dump: DumpOptions{Compact: true, Prune: true}},
+		output); err != nil {
+		t.Fatal(err)
+	}
+	dump := output.String()
+	if _, err = analyzeDump("test.json", []byte(dump), nil, nil); err != nil {
+		t.Fatalf("the dump is rejected: %v", err)
+	}
+	for _, test := range []struct {
+		old, new string
+		err      string
+	}{
+		{`"label":"*ast.File (Name: main)"`, `"label":"*ast.Package"`,
+			"the root node is *ast.Package instead of *ast.File"},
+		{`"label":"Name : *ast.Ident (Name: main)"`, `"label":""`, "line 1: : the node has no label"},
+		{`"pos":"3:1","end":"6:2"`, `"pos":"6:2","end":"3:1"`,
+			"line 6: 0 : *ast.FuncDecl (Name: Pay): the node ends before it starts"},
+		{`"Decls : []ast.Decl(len = 1)"`, `"Decls : []ast.Decl(len = 2)"`,
+			"Decls : []ast.Decl(len = 2): the node has 1 children instead of 2"},
+		{`{"label":"Type : *ast.FuncType"`, `{"label":"Kind : *ast.FuncType"`,
+			"line 3: 0 : *ast.FuncDecl (Name: Pay): the node has no Type child"},
+		{`"attrs":{"Name":"note","NamePos":"3:10"}`, `"attrs":{"NamePos":"3:10"}`,
+			"line 3: 0 : *ast.Ident (Name: note): the node has no Name attribute"},
+	} {
+		if !strings.Contains(dump, test.old) {
+			t.Fatalf("the dump lacks %s", test.old)
+		}
+		_, err = analyzeDump("test.json", []byte(strings.Replace(dump, test.old, test.new, 1)), nil, nil)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: err = %v, want %q", test.new, err, test.err)
+		}
+	}
+}
+
+func TestAstLabelKind(t *testing.T) {
+	for label, want := range map[string]string{
+		"0 : *ast.GenDecl (Tok: import)": "*ast.GenDecl",
+		"Decls : []ast.Decl(len = 26)":   "[]ast.Decl",
+		"*ast.File (Name: main)":         "*ast.File",
+		"X : *ast.Ident":                 "*ast.Ident",
+	} {
+		if got := astLabelKind(label); got != want {
+			t.Errorf("astLabelKind(%q) = %q, want %q", label, got, want)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package stcpsce
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Chaincode
+//
+// @description:	This is used to hold a chaincode called by `InvokeChaincode`, analyzed from its source code.
+//
+type Chaincode struct {
+	Name  string
+	scope *foldScope
+	// dispatch maps the names of the functions `Invoke` dispatches on to the methods it calls.
+	dispatch map[string]*Ast
+}
+
+// chaincodeResolver loads the chaincodes named in the configuration once, when they are called.
+type chaincodeResolver struct {
+	// paths maps the names of the chaincodes to the directories or files of their source code.
+	paths  map[string]string
+	loaded map[string]*Chaincode
+	// errors maps the names of the chaincodes which cannot be loaded to the reasons.
+	errors map[string]error
+}
+
+// @title:	loadChaincodeConfig
+//
+// @description:	This is used to read the configuration of the called chaincodes, a JSON object mapping the name of
+//every chaincode to the directory or the file of its source code. Relative paths are relative to the configuration.
+//
+// @param: 	filename string	The name of the configuration file.
+//
+// @return:	resolver *chaincodeResolver	The resolver of the chaincodes.
+//
+// @return:	err error	If the configuration can be read, return nil, otherwise return an error.
+//
+func loadChaincodeConfig(filename string) (resolver *chaincodeResolver, err error) {
+	body, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	resolver = &chaincodeResolver{paths: map[string]string{}, loaded: map[string]*Chaincode{}, errors: map[string]error{}}
+	if err = json.Unmarshal(body, &resolver.paths); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	for name, path := range resolver.paths {
+		if !filepath.IsAbs(path) {
+			resolver.paths[name] = filepath.Join(filepath.Dir(filename), path)
+		}
+	}
+	return resolver, nil
+}
+
+// @title:	findDispatch
+//
+// @description:	This is used to find which method `Invoke` calls for which function name, from the `case` clauses
+//and the `if function == "name"` conditions holding a string literal. The first method called in the branch is taken.
+//
+// @param: 	ast *Ast	The `FuncDecl` node of `Invoke`.
+//
+// @param: 	methods map[string]*Ast	Map of the names of the methods to their `FuncDecl` nodes.
+//
+// @return:	dispatch map[string]*Ast	Map of the function names to the methods.
+//
+func findDispatch(ast *Ast, methods map[string]*Ast) (dispatch map[string]*Ast) {
+	dispatch = map[string]*Ast{}
+	var findMethod func(node *Ast) *Ast
+	findMethod = func(node *Ast) *Ast {
+		if strings.Contains(node.Label, "CallExpr") && strings.Contains(node.Children[0].Label, "SelectorExpr") &&
+			methods[node.Children[0].Children[1].Attrs["Name"]] != nil {
+			return methods[node.Children[0].Children[1].Attrs["Name"]]
+		}
+		for x := range node.Children {
+			if method := findMethod(node.Children[x]); method != nil {
+				return method
+			}
+		}
+		return nil
+	}
+	var walk func(node *Ast)
+	walk = func(node *Ast) {
+		names := []string{}
+		var body *Ast
+		if strings.Contains(node.Label, "CaseClause") && findChild(node, "List") != nil {
+			for _, expression := range findChild(node, "List").Children {
+				if strings.Contains(expression.Label, "BasicLit") && expression.Attrs["Kind"] == "STRING" {
+					names = append(names, expression.Attrs["Value"])
+				}
+			}
+			body = findChild(node, "Body")
+		} else if strings.Contains(node.Label, "IfStmt") && strings.Contains(findChild(node, "Cond").Label, "BinaryExpr") &&
+			findChild(node, "Cond").Attrs["Op"] == "==" {
+			for _, operand := range findChild(node, "Cond").Children {
+				if strings.Contains(operand.Label, "BasicLit") && operand.Attrs["Kind"] == "STRING" {
+					names = append(names, operand.Attrs["Value"])
+				}
+			}
+			body = findChild(node, "Body")
+		}
+		if body != nil {
+			if method := findMethod(body); method != nil {
+				for x := range names {
+					if name, err := strconv.Unquote(names[x]); err == nil {
+						dispatch[name] = method
+					}
+				}
+			}
+		}
+		for x := range node.Children {
+			walk(node.Children[x])
+		}
+	}
+	if body := findFunctionBody(ast); body != nil {
+		walk(body)
+	}
+	return dispatch
+}
+
+// @title:	loadChaincode
+//
+// @description:	This is used to parse and prepare a configured chaincode the first time it is called.
+//
+// @param: 	resolver *chaincodeResolver	The resolver of the chaincodes.
+//
+// @param: 	name string	The name of the chaincode.
+//
+// @param: 	spec *APISpec	The APIs added by a spec file, or nil.
+//
+// @return:	chaincode *Chaincode	The chaincode.
+//
+// @return:	err error	If the chaincode can be loaded, return nil, otherwise return an error.
+//
+func loadChaincode(resolver *chaincodeResolver, name string, spec *APISpec) (chaincode *Chaincode, err error) {
+	if chaincode = resolver.loaded[name]; chaincode != nil {
+		return chaincode, nil
+	} else if err = resolver.errors[name]; err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			resolver.errors[name] = err
+		}
+	}()
+	path, ok := resolver.paths[name]
+	if !ok {
+		return nil, fmt.Errorf("chaincode %q is not configured", name)
+	}
+	filenames := []string{path}
+	if info, err := os.Stat(path); err != nil {
+		return nil, err
+	} else if info.IsDir() {
+		filenames, _ = filepath.Glob(filepath.Join(path, "*.go"))
+		sort.Strings(filenames)
+	}
+	fileSet := token.NewFileSet()
+	sources := map[string]string{}
+	asts := []*Ast{}
+	packageVariables := []*PackageVariable{}
+	for _, filename := range filenames {
+		if strings.HasSuffix(filename, "_test.go") {
+			continue
+		}
+		body, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		f, err := parser.ParseFile(fileSet, filename, body, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		a, err := BuildAst("", f)
+		if err != nil {
+			return nil, err
+		}
+		sources[filename] = string(body)
+		asts = append(asts, a)
+		packageVariables = append(packageVariables, analyzePackageVariables(a, nil)...)
+	}
+	chaincode = &Chaincode{Name: name, scope: newFoldScope(asts, packageVariables, fileSet, sources, resolver, spec),
+		dispatch: map[string]*Ast{}}
+	// The chaincode is registered before its dispatch is found, so a chaincode calling itself is not loaded twice.
+	resolver.loaded[name] = chaincode
+	methods := map[string]*Ast{}
+	for _, a := range asts {
+		functions := findFunctionDeclarations(a)
+		for x := range functions {
+			if isMethodDeclaration(functions[x]) {
+				methods[findFunctionName(functions[x])] = functions[x]
+			}
+		}
+	}
+	if methods["Invoke"] == nil {
+		delete(resolver.loaded, name)
+		return nil, fmt.Errorf("chaincode %q has no Invoke method", name)
+	}
+	chaincode.dispatch = findDispatch(methods["Invoke"], methods)
+	return chaincode, nil
+}
+
+// @title:	invokeChaincode
+//
+// @description:	This is used to merge the accesses of a chaincode called by `InvokeChaincode` into the frame. The
+//called method is found from the first forwarded argument, the other ones are passed as its `args`, so the keys
+//depend on the positions of the forwarded arguments. If the function name is not constant, the accesses of every
+//method `Invoke` dispatches to are merged. A chaincode which cannot be resolved may access any of its keys.
+//
+// @param: 	ast *Ast	The `CallExpr` node.
+//
+// @param: 	argumentNodes []*Ast	List of the arguments of the call.
+//
+// @param: 	arguments []interface{}	The values of the arguments.
+//
+// @param: 	frame *foldFrame	The frame of the function.
+//
+// @param: 	scope *foldScope	The shared scope.
+//
+func invokeChaincode(ast *Ast, argumentNodes []*Ast, arguments []interface{}, frame *foldFrame, scope *foldScope) {
+	nameTemplate := foldKey(argumentNodes[0], frame, scope)
+	name, constant := keyTemplateConstant(nameTemplate)
+	var chaincode *Chaincode
+	if constant && scope.chaincodes != nil {
+		chaincode, _ = loadChaincode(scope.chaincodes, name, scope.spec)
+	}
+	if chaincode == nil {
+		if !constant {
+			name = describeKeyTemplate(nameTemplate)
+		}
+		frame.accesses = append(frame.accesses, &KeyAccess{Site: ast, Via: []string{}, API: "InvokeChaincode",
+			Write: true, Key: newHoleTemplate("*", -1), Chaincode: name})
+		return
+	}
+	forwarded, _ := arguments[1].(foldSlice)
+	functions := []string{}
+	if len(forwarded) != 0 {
+		if template, ok := forwarded[0].(*KeyTemplate); ok {
+			if function, ok := keyTemplateConstant(template); ok && chaincode.dispatch[function] != nil {
+				functions = append(functions, function)
+			}
+		}
+	}
+	if len(functions) == 0 {
+		for function := range chaincode.dispatch {
+			functions = append(functions, function)
+		}
+		sort.Strings(functions)
+	}
+	parameters := []interface{}{newHoleTemplate("stub", -1), newHoleTemplate(foldText(scope, argumentNodes[1])+"[1:]", -1)}
+	// The arguments of the called function are unknown when none are forwarded, even the name of the function.
+	if len(forwarded) > 0 {
+		parameters[1] = forwarded[1:]
+	}
+	for _, function := range functions {
+		method := chaincode.dispatch[function]
+		_, accesses := interpretFunction(method, parameters, chaincode.scope)
+		for x := range accesses {
+			owner := accesses[x].Chaincode
+			if owner == "" {
+				owner = name
+			}
+			frame.accesses = append(frame.accesses, &KeyAccess{Site: ast, Via: append([]string{name + "." +
+				findFunctionName(method)}, accesses[x].Via...), API: accesses[x].API, Write: accesses[x].Write,
+				Key: accesses[x].Key, Partial: accesses[x].Partial, Chaincode: owner, Collection: accesses[x].Collection,
+				End: accesses[x].End})
+		}
+	}
+}
+
+// @title:	printChaincodeErrors
+//
+// @description:	This is used to print why the called chaincodes could not be loaded.
+//
+// @param: 	resolver *chaincodeResolver	The resolver of the chaincodes, or nil.
+//
+func printChaincodeErrors(resolver *chaincodeResolver) {
+	if resolver == nil || len(resolver.errors) == 0 {
+		return
+	}
+	names := []string{}
+	for name := range resolver.errors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Print("\n\nUnresolved chaincodes:\n")
+	for x := range names {
+		fmt.Printf("%s: %v\n", names[x], resolver.errors[names[x]])
+	}
+}
@@ -0,0 +1,110 @@
+package stcpsce
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const calleeSource = `package main
+
+import (
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+type Other struct{}
+
+func (t *Other) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
+	function, args := stub.GetFunctionAndParameters()
+	if function == "get" {
+		return t.get(stub, args)
+	}
+	return shim.Error("unknown")
+}
+
+func (t *Other) get(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	value, _ := stub.GetState("balance_" + args[0])
+	return shim.Success(value)
+}
+`
+
+// @title:	newTestResolver
+//
+// @description:	This is used to write the callee of a test to a temporary directory and resolve it as `other`.
+//
+// @param: 	t *testing.T	The test.
+//
+// @return:	resolver *chaincodeResolver	The resolver.
+//
+// @return:	directory string	The directory, which the test removes.
+//
+func newTestResolver(t *testing.T) (resolver *chaincodeResolver, directory string) {
+	t.Helper()
+	directory, err := ioutil.TempDir("", "chaincodes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(directory, "other.go"), []byte(calleeSource), 0666); err != nil {
+		os.RemoveAll(directory)
+		t.Fatal(err)
+	}
+	return &chaincodeResolver{paths: map[string]string{"other": directory}, loaded: map[string]*Chaincode{},
+		errors: map[string]error{}}, directory
+}
+
+func TestInvokeChaincode(t *testing.T) {
+	resolver, directory := newTestResolver(t)
+	defer os.RemoveAll(directory)
+	analysis, err := analyzeSource("test.go", `package main
+
+import "github.com/hyperledger/fabric/core/chaincode/shim"
+
+type SmartContract struct{}
+
+func (s *SmartContract) Call(stub shim.ChaincodeStubInterface) {
+	stub.InvokeChaincode("other", [][]byte{[]byte("get"), []byte("alice")}, "")
+}
+`, resolver, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(analysis.Accesses) != 1 {
+		t.Fatalf("accesses = %d, want the GetState of other.get", len(analysis.Accesses))
+	}
+	if got := formatKeyAccess(analysis.Accesses[0], formatKeyTemplate); got != `[other] "balance_alice"` {
+		t.Errorf("key = %s, want the forwarded argument folded", got)
+	}
+}
+
+func TestInvokeChaincodeWithoutArguments(t *testing.T) {
+	resolver, directory := newTestResolver(t)
+	defer os.RemoveAll(directory)
+	analysis, err := analyzeSource("test.go", `package main
+
+import "github.com/hyperledger/fabric/core/chaincode/shim"
+
+type SmartContract struct{}
+
+func (s *SmartContract) Call(stub shim.ChaincodeStubInterface) {
+	stub.InvokeChaincode("other", [][]byte{}, "")
+}
+`, resolver, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(analysis.Failures) != 0 {
+		t.Fatalf("failure: %s", analysis.Failures[0].Message)
+	}
+	if len(analysis.Accesses) != 1 {
+		t.Fatalf("accesses = %d, want the GetState of other.get", len(analysis.Accesses))
+	}
+	access := analysis.Accesses[0]
+	if access.API != "GetState" || access.Chaincode != "other" || len(access.Via) != 1 || access.Via[0] != "other.get" {
+		t.Errorf("access = %s of %s via %v", access.API, access.Chaincode, access.Via)
+	}
+	if _, constant := keyTemplateConstant(access.Key); constant {
+		t.Errorf("the key of an argument which is not forwarded is constant")
+	}
+}
@@ -0,0 +1,880 @@
+package stcpsce
+
+import (
+	"container/list"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// The exit codes of the commands.
+const (
+	exitClean    = 0
+	exitFindings = 1
+	exitUsage    = 2
+)
+
+// Analysis
+//
+// @description:	This is used to hold a parsed source file and the results of Phase 1 and Phase 2 shared by the
+//commands.
+//
+type Analysis struct {
+	Filename string
+	Source   string
+	FileSet  *token.FileSet
+	Ast      *Ast
+	// Skipped holds the declarations left out of the analysis because of syntax errors.
+	Skipped []*SkippedDeclaration
+	// GetStateMap and PutStateMap are the maps of `GetState` and `PutState` expressions of Phase 2.
+	GetStateMap map[string][]int
+	PutStateMap map[string][]int
+	// Diagnostics holds the findings of the analysis of concurrency.
+	Diagnostics      []*Diagnostic
+	NonChoppable     map[string]bool
+	PackageVariables []*PackageVariable
+	// Chains holds the chains of Phase 1, the parallelizable statement first.
+	Chains [][]*Ast
+	// Accesses holds the key templates of the accesses of every function.
+	Accesses []*KeyAccess
+	// Nondeterminism holds the findings of the analysis of nondeterminism.
+	Nondeterminism []*Diagnostic
+	Summaries      []*AccessSummary
+	Paths          []*FunctionPaths
+	Aborts         []*AbortReport
+	Conflicts      []*ConflictEdge
+	// Failures holds the diagnostics of the functions failing to be analyzed.
+	Failures []*Diagnostic
+}
+
+// CommandOptions
+//
+// @description:	This is used to hold the flags shared by the commands.
+//
+type CommandOptions struct {
+	// Format is `text` or `json`.
+	Format string
+	// Include and Exclude are comma-separated patterns of `path.Match` selecting the functions reported, every
+	// function is included when Include is empty.
+	Include string
+	Exclude string
+	// Spec is the JSON file adding APIs reading and writing the ledger, empty if none is added.
+	Spec string
+	// APIs holds the APIs read from Spec, nil if none is added.
+	APIs       *APISpec
+	Chaincodes string
+	// Dump holds the flags of `dump-ast`.
+	Dump DumpOptions
+}
+
+// Command describes a subcommand of the program.
+type Command struct {
+	Name        string
+	Description string
+	// Run prints the results of the command and tells if it has findings.
+	Run func(analysis *Analysis, options *CommandOptions, output io.Writer) (findings bool, err error)
+	// ParseOnly is set for a command which only reads the AST, the analyses are not run for it.
+	ParseOnly bool
+}
+
+// commands lists the subcommands in the order they are shown in the usage.
+var commands = []*Command{
+	{"phase1", "print the chains of parallelizable statements of every function", runPhase1Command, false},
+	{"phase2", "print the arguments which the keys read and written by every function depend on", runPhase2Command,
+		false},
+	{"conflicts", "print the conflict graph of the transactions", runConflictsCommand, false},
+	{"chop", "print the pieces every transaction is chopped into", runChopCommand, false},
+	{"dump-ast", "print the AST of the source code, or of an AST dump, as JSON", runDumpAstCommand, true},
+	{"simulate", "schedule the transactions in rounds of transactions which do not conflict", runSimulateCommand,
+		false},
+}
+
+// APISpec
+//
+// @description:	This is used to read the APIs added by a spec file. Every API maps to the positions of the arguments
+//selecting the entry it accesses, the key last, like `{"read": {"GetAsset": [0]}, "write": {"PutAsset": [0]}}`.
+//
+type APISpec struct {
+	Read  map[string][]int `json:"read"`
+	Write map[string][]int `json:"write"`
+}
+
+// @title:	loadAPISpec
+//
+// @description:	This is used to read a spec file adding APIs to the ones of the stub, for both Phase 2 and the key
+//templates. The spec is passed to the analyses, the APIs of the stub are left as they are.
+//
+// @param: 	filename string	The name of the spec file.
+//
+// @return:	spec *APISpec	The APIs added.
+//
+// @return:	err error	If the spec file can be read, return nil, otherwise return an error.
+//
+func loadAPISpec(filename string) (spec *APISpec, err error) {
+	body, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	spec = &APISpec{}
+	if err = json.Unmarshal(body, spec); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	for _, apis := range []map[string][]int{spec.Read, spec.Write} {
+		for name, positions := range apis {
+			if len(positions) == 0 {
+				return nil, fmt.Errorf("%s: %s has no argument position", filename, name)
+			}
+		}
+	}
+	return spec, nil
+}
+
+// @title:	entryPositions
+//
+// @description:	This is used to find the positions of the arguments of an API selecting the entry it reads or
+//writes, from the spec and then from the APIs of the stub. A nil spec only has the APIs of the stub.
+//
+// @param: 	api string	The name of the API.
+//
+// @param: 	isGet bool	If the API is searched among the ones reading the ledger, then `isGet` is true, otherwise
+//`isGet` is false.
+//
+// @return:	[]int		List of positions, empty if the API does not read or write the ledger.
+//
+func (spec *APISpec) entryPositions(api string, isGet bool) []int {
+	if spec != nil && isGet && len(spec.Read[api]) != 0 {
+		return spec.Read[api]
+	} else if spec != nil && !isGet && len(spec.Write[api]) != 0 {
+		return spec.Write[api]
+	} else if isGet {
+		return readAPIPositions[api]
+	}
+	return writeAPIPositions[api]
+}
+
+// @title:	keyPosition
+//
+// @description:	This is used to find the position of the key in the arguments of an API accessing a key, which is
+//the last position of an API of the spec.
+//
+// @param: 	api string	The name of the API.
+//
+// @return:	position int	The position of the key.
+//
+// @return:	ok bool		If the API accesses a key, return true, otherwise return false.
+//
+func (spec *APISpec) keyPosition(api string) (position int, ok bool) {
+	if spec != nil {
+		for _, apis := range []map[string][]int{spec.Read, spec.Write} {
+			if positions := apis[api]; len(positions) != 0 {
+				return positions[len(positions)-1], true
+			}
+		}
+	}
+	position, ok = keyAccessAPIs[api]
+	return position, ok
+}
+
+// @title:	writes
+//
+// @description:	This is used to determine if an API writes the key it accesses.
+//
+// @param: 	api string	The name of the API.
+//
+// @return:	bool		If the API writes the ledger, return true, otherwise return false.
+//
+func (spec *APISpec) writes(api string) bool {
+	return keyWritingAPIs[api] || spec != nil && len(spec.Write[api]) != 0
+}
+
+// @title:	parseSource
+//
+// @description:	This is used to parse a source file into its AST without analyzing it.
+//
+// @param: 	filename string	The name of the file.
+//
+// @param: 	source string	The source code.
+//
+// @return:	analysis *Analysis	The AST and the declarations left out, or nil if nothing can be parsed.
+//
+// @return:	err error	If the source code can be parsed, return nil, otherwise return the `scanner.ErrorList` of
+//the syntax errors. The declarations the parser recovers from them are skipped.
+//
+func parseSource(filename string, source string) (analysis *Analysis, err error) {
+	fileSet := token.NewFileSet()
+	f, syntaxErr := parser.ParseFile(fileSet, filename, source, parser.ParseComments|parser.AllErrors)
+	syntaxErr = removeDuplicateErrors(syntaxErr)
+	if f == nil || !f.Package.IsValid() {
+		return nil, syntaxErr
+	}
+	skipped := []*SkippedDeclaration{}
+	if syntaxErr != nil {
+		skipped = pruneMalformedDeclarations(f, fileSet, syntaxErr)
+	}
+	a, err := BuildAst("", f)
+	if err != nil {
+		return nil, err
+	}
+	return &Analysis{Filename: filename, Source: source, FileSet: fileSet, Ast: a, Skipped: skipped}, syntaxErr
+}
+
+// @title:	analyzeSource
+//
+// @description:	This is used to parse a source file and run Phase 1 and Phase 2 with the analyses they depend on.
+//
+// @param: 	filename string	The name of the file.
+//
+// @param: 	source string	The source code.
+//
+// @param: 	chaincodes *chaincodeResolver	The resolver of the chaincodes called by `InvokeChaincode`, or nil.
+//
+// @param: 	spec *APISpec	The APIs added by a spec file, or nil.
+//
+// @return:	analysis *Analysis	The results, or nil if nothing can be parsed.
+//
+// @return:	err error	If the source code can be parsed, return nil, otherwise return the `scanner.ErrorList` of
+//the syntax errors. The declarations the parser recovers from them are skipped and the others are still analyzed.
+//
+func analyzeSource(filename string, source string, chaincodes *chaincodeResolver, spec *APISpec) (analysis *Analysis,
+	err error) {
+	parsed, err := parseSource(filename, source)
+	if parsed == nil {
+		return nil, err
+	}
+	return analyzeAst(filename, source, parsed.FileSet, parsed.Ast, parsed.Skipped, chaincodes, spec), err
+}
+
+// @title:	analyzeDump
+//
+// @description:	This is used to read the AST of a file from a dump instead of parsing the source code, and run Phase 1
+//and Phase 2 on it with the analyses they depend on.
+//
+// @param: 	filename string	The name of the dump.
+//
+// @param: 	body []byte	The dump.
+//
+// @param: 	chaincodes *chaincodeResolver	The resolver of the chaincodes called by `InvokeChaincode`, or nil.
+//
+// @param: 	spec *APISpec	The APIs added by a spec file, or nil.
+//
+// @return:	analysis *Analysis	The results, without the source code.
+//
+// @return:	err error	If the dump can be read and matches the schema, return nil, otherwise return an error.
+//
+func analyzeDump(filename string, body []byte, chaincodes *chaincodeResolver, spec *APISpec) (analysis *Analysis,
+	err error) {
+	a, fileSet, err := loadAstDump(filename, body)
+	if err != nil {
+		return nil, err
+	}
+	return analyzeAst(fileSet.File(token.Pos(a.Pos)).Name(), "", fileSet, a, nil, chaincodes, spec), nil
+}
+
+// @title:	analyzeAst
+//
+// @description:	This is used to run Phase 1 and Phase 2 with the analyses they depend on, on the AST of a file.
+//
+// @param: 	filename string	The name of the file.
+//
+// @param: 	source string	The source code, or an empty string for an AST read from a dump.
+//
+// @param: 	fileSet *token.FileSet	The file set of the AST.
+//
+// @param: 	a *Ast		The root node of the file.
+//
+// @param: 	skipped []*SkippedDeclaration	List of the declarations left out because of syntax errors, or nil.
+//
+// @param: 	chaincodes *chaincodeResolver	The resolver of the chaincodes called by `InvokeChaincode`, or nil.
+//
+// @param: 	spec *APISpec	The APIs added by a spec file, or nil.
+//
+// @return:	analysis *Analysis	The results.
+//
+func analyzeAst(filename string, source string, fileSet *token.FileSet, a *Ast, skipped []*SkippedDeclaration,
+	chaincodes *chaincodeResolver, spec *APISpec) (analysis *Analysis) {
+	analysis = &Analysis{Filename: filename, Source: source, FileSet: fileSet, Ast: a, Skipped: skipped,
+		Chains: [][]*Ast{}}
+	failures := list.New()
+	analysis.GetStateMap, analysis.PutStateMap = analyzeReadWriteAPI(findChild(a, "Decls"), spec, failures)
+	analysis.Diagnostics, analysis.NonChoppable = analyzeConcurrency(a, analysis.PutStateMap, spec, failures)
+	analysis.PackageVariables = analyzePackageVariables(a, failures)
+	mergeNonChoppable(analysis.NonChoppable, findPackageVariableDependents(analysis.PackageVariables))
+	posList := analyzeFunctionDeclaration(a, analysis.NonChoppable, nil, nil, failures)
+	for pos := posList.Front(); pos != nil; pos = pos.Next() {
+		if len(pos.Value.([]*Ast)) != 0 {
+			analysis.Chains = append(analysis.Chains, pos.Value.([]*Ast))
+		}
+	}
+	analysis.Accesses = analyzeKeyTemplates(a, analysis.PackageVariables, fileSet, filename, source, chaincodes,
+		spec, failures)
+	analysis.Nondeterminism = analyzeNondeterminism(a, analysis.PutStateMap, spec, fileSet, failures)
+	analysis.Summaries = summarizeAccesses(a, analysis.GetStateMap, analysis.PutStateMap, spec,
+		analysis.Accesses, failures)
+	analysis.Paths = analyzeAccessPaths(a, analysis.Accesses, failures)
+	analysis.Aborts = analyzeAborts(a, analysis.Paths, failures)
+	analysis.Conflicts = analyzeConflicts(a, analysis.Accesses, analysis.Paths, failures)
+	analysis.Failures = listDiagnostics(failures)
+	return analysis
+}
+
+// @title:	findEnclosingFunction
+//
+// @description:	This is used to find the name of the function declaring a node.
+//
+// @param: 	ast *Ast	The root node of the file.
+//
+// @param: 	node *Ast	The node.
+//
+// @return:	string		The name of the function, or an empty string if the node is outside of every function.
+//
+func findEnclosingFunction(ast *Ast, node *Ast) string {
+	functions := findFunctionDeclarations(ast)
+	for x := range functions {
+		if node.Pos >= functions[x].Pos && node.End <= functions[x].End {
+			return findFunctionName(functions[x])
+		}
+	}
+	return ""
+}
+
+// @title:	matchesFunction
+//
+// @description:	This is used to determine if a function matches one of comma-separated patterns.
+//
+// @param: 	patterns string	The patterns.
+//
+// @param: 	name string	The name of the function.
+//
+// @return:	bool		If the function matches a pattern, return true, otherwise return false.
+//
+func matchesFunction(patterns string, name string) bool {
+	for _, pattern := range strings.Split(patterns, ",") {
+		if matched, _ := path.Match(strings.TrimSpace(pattern), name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// @title:	selectsFunction
+//
+// @description:	This is used to determine if the filters of the options report a function.
+//
+// @param: 	options *CommandOptions	The options.
+//
+// @param: 	name string	The name of the function.
+//
+// @return:	bool		If the function is reported, return true, otherwise return false.
+//
+func selectsFunction(options *CommandOptions, name string) bool {
+	if options.Exclude != "" && matchesFunction(options.Exclude, name) {
+		return false
+	}
+	return options.Include == "" || matchesFunction(options.Include, name)
+}
+
+// @title:	writeJSON
+//
+// @description:	This is used to write a value as indented JSON.
+//
+// @param: 	output io.Writer	The output.
+//
+// @param: 	value interface{}	The value.
+//
+// @return:	err error	If the value can be written, return nil, otherwise return an error.
+//
+func writeJSON(output io.Writer, value interface{}) (err error) {
+	body, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = output.Write(append(body, '\n'))
+	return err
+}
+
+// @title:	chainLines
+//
+// @description:	This is used to find the lines of the statements of a chain.
+//
+// @param: 	chain []*Ast	The chain.
+//
+// @param: 	fileSet *token.FileSet	The file set which the source code is parsed with.
+//
+// @return:	lines []int	List of lines in the order of the chain.
+//
+func chainLines(chain []*Ast, fileSet *token.FileSet) (lines []int) {
+	lines = []int{}
+	for x := range chain {
+		lines = append(lines, lineOf(fileSet, chain[x].Pos))
+	}
+	return lines
+}
+
+// @title:	runPhase1Command
+//
+// @description:	This is used to print the chain of every selected function. A chain is a finding.
+//
+// @param: 	analysis *Analysis	The results of the analyses.
+//
+// @param: 	options *CommandOptions	The options.
+//
+// @param: 	output io.Writer	The output.
+//
+// @return:	findings bool	If a chain is printed, return true, otherwise return false.
+//
+// @return:	err error	If the chains can be printed, return nil, otherwise return an error.
+//
+func runPhase1Command(analysis *Analysis, options *CommandOptions, output io.Writer) (findings bool, err error) {
+	type chainResult struct {
+		Function string `json:"function"`
+		Lines    []int  `json:"lines"`
+	}
+	results := []chainResult{}
+	for _, chain := range analysis.Chains {
+		name := findEnclosingFunction(analysis.Ast, chain[0])
+		if selectsFunction(options, name) {
+			results = append(results, chainResult{Function: name, Lines: chainLines(chain, analysis.FileSet)})
+		}
+	}
+	if options.Format == "json" {
+		return len(results) != 0, writeJSON(output, results)
+	}
+	for _, result := range results {
+		lines := []string{}
+		for x := range result.Lines {
+			lines = append(lines, fmt.Sprint(result.Lines[x]))
+		}
+		if _, err = fmt.Fprintf(output, "%s: [%s]\n", result.Function, strings.Join(lines, ", ")); err != nil {
+			return false, err
+		}
+	}
+	return len(results) != 0, nil
+}
+
+// @title:	runPhase2Command
+//
+// @description:	This is used to print the maps of `GetState` and `PutState` expressions of the selected functions. The
+//maps describe the functions, like an AST dump, so the command has no finding.
+//
+// @param: 	analysis *Analysis	The results of the analyses.
+//
+// @param: 	options *CommandOptions	The options.
+//
+// @param: 	output io.Writer	The output.
+//
+// @return:	findings bool	Always false.
+//
+// @return:	err error	If the maps can be printed, return nil, otherwise return an error.
+//
+func runPhase2Command(analysis *Analysis, options *CommandOptions, output io.Writer) (findings bool, err error) {
+	GetStateMap, PutStateMap := map[string][]int{}, map[string][]int{}
+	for name := range analysis.GetStateMap {
+		if selectsFunction(options, name) {
+			GetStateMap[name], PutStateMap[name] = analysis.GetStateMap[name], analysis.PutStateMap[name]
+		}
+	}
+	if options.Format == "json" {
+		return false, writeJSON(output, map[string]map[string][]int{"GetState": GetStateMap,
+			"PutState": PutStateMap})
+	}
+	_, err = fmt.Fprintf(output, "GetState:\n%v\nPutState:\n%v\n", GetStateMap, PutStateMap)
+	return false, err
+}
+
+// @title:	selectConflictEdges
+//
+// @description:	This is used to select the edges of the conflict graph with a selected transaction and no excluded
+//one.
+//
+// @param: 	edges []*ConflictEdge	List of edges.
+//
+// @param: 	options *CommandOptions	The options.
+//
+// @return:	selected []*ConflictEdge	List of the selected edges.
+//
+func selectConflictEdges(edges []*ConflictEdge, options *CommandOptions) (selected []*ConflictEdge) {
+	selected = []*ConflictEdge{}
+	for _, edge := range edges {
+		if options.Exclude != "" && (matchesFunction(options.Exclude, edge.From) ||
+			matchesFunction(options.Exclude, edge.To)) {
+			continue
+		}
+		if selectsFunction(options, edge.From) || selectsFunction(options, edge.To) {
+			selected = append(selected, edge)
+		}
+	}
+	return selected
+}
+
+// @title:	runConflictsCommand
+//
+// @description:	This is used to print the selected edges of the conflict graph. An edge is a finding.
+//
+// @param: 	analysis *Analysis	The results of the analyses.
+//
+// @param: 	options *CommandOptions	The options.
+//
+// @param: 	output io.Writer	The output.
+//
+// @return:	findings bool	If an edge is printed, return true, otherwise return false.
+//
+// @return:	err error	If the edges can be printed, return nil, otherwise return an error.
+//
+func runConflictsCommand(analysis *Analysis, options *CommandOptions, output io.Writer) (findings bool, err error) {
+	type accessResult struct {
+		API  string `json:"api"`
+		Line int    `json:"line"`
+		Key  string `json:"key"`
+	}
+	type conflictResult struct {
+		Kind string `json:"kind"`
+		// May tells that the conflicts of the kind all come from may-writes.
+		May  bool         `json:"may"`
+		From accessResult `json:"from"`
+		To   accessResult `json:"to"`
+	}
+	type edgeResult struct {
+		From      string           `json:"from"`
+		To        string           `json:"to"`
+		Conflicts []conflictResult `json:"conflicts"`
+	}
+	edges := selectConflictEdges(analysis.Conflicts, options)
+	if options.Format != "json" {
+		for _, edge := range edges {
+			kinds := []string{}
+			for y := range edge.Kinds {
+				kind := edge.Kinds[y]
+				if edge.May[y] {
+					kind = "may " + kind
+				}
+				kinds = append(kinds, fmt.Sprintf("%s (line %d, line %d)", kind, lineOf(analysis.FileSet,
+					edge.Evidence[y][0].Site.Pos), lineOf(analysis.FileSet, edge.Evidence[y][1].Site.Pos)))
+			}
+			if _, err = fmt.Fprintf(output, "%s -- %s: %s\n", edge.From, edge.To, strings.Join(kinds, ", ")); err != nil {
+				return false, err
+			}
+		}
+		return len(edges) != 0, nil
+	}
+	results := []edgeResult{}
+	for _, edge := range edges {
+		result := edgeResult{From: edge.From, To: edge.To, Conflicts: []conflictResult{}}
+		for y := range edge.Kinds {
+			accesses := [2]accessResult{}
+			for z, access := range edge.Evidence[y] {
+				accesses[z] = accessResult{API: access.API, Line: lineOf(analysis.FileSet, access.Site.Pos),
+					Key: formatKeyAccess(access, formatKeyTemplate)}
+			}
+			result.Conflicts = append(result.Conflicts, conflictResult{Kind: edge.Kinds[y], May: edge.May[y],
+				From: accesses[0], To: accesses[1]})
+		}
+		results = append(results, result)
+	}
+	return len(results) != 0, writeJSON(output, results)
+}
+
+// @title:	runChopCommand
+//
+// @description:	This is used to print how every selected transaction is chopped: the statements of its chain run in
+//a parallel piece, and a transaction which may abort after a write keeps every abort in its first piece. A
+//transaction with a parallel piece is a finding.
+//
+// @param: 	analysis *Analysis	The results of the analyses.
+//
+// @param: 	options *CommandOptions	The options.
+//
+// @param: 	output io.Writer	The output.
+//
+// @return:	findings bool	If a transaction has a parallel piece, return true, otherwise return false.
+//
+// @return:	err error	If the pieces can be printed, return nil, otherwise return an error.
+//
+func runChopCommand(analysis *Analysis, options *CommandOptions, output io.Writer) (findings bool, err error) {
+	type chopResult struct {
+		Function     string `json:"function"`
+		NonChoppable bool   `json:"nonChoppable"`
+		// Parallel holds the lines of the parallel piece.
+		Parallel     []int `json:"parallel"`
+		RollbackSafe bool  `json:"rollbackSafe"`
+		// FirstPieceEnd is the line the first piece runs up to, 0 unless the chopping must be rollback-safe.
+		FirstPieceEnd int `json:"firstPieceEnd,omitempty"`
+	}
+	chains := map[string][]*Ast{}
+	for _, chain := range analysis.Chains {
+		chains[findEnclosingFunction(analysis.Ast, chain[0])] = chain
+	}
+	aborts := map[string]*AbortReport{}
+	for _, report := range analysis.Aborts {
+		aborts[report.Function] = report
+	}
+	results := []chopResult{}
+	for _, name := range findTransactions(analysis.Ast) {
+		if !selectsFunction(options, name) {
+			continue
+		}
+		result := chopResult{Function: name, NonChoppable: analysis.NonChoppable[name], Parallel: []int{}}
+		if chains[name] != nil {
+			result.Parallel = chainLines(chains[name], analysis.FileSet)
+			sort.Ints(result.Parallel)
+			findings = true
+		}
+		if report := aborts[name]; report != nil && report.RollbackSafe {
+			result.RollbackSafe = true
+			result.FirstPieceEnd = lineOf(analysis.FileSet, report.FirstPieceEnd.Pos)
+		}
+		results = append(results, result)
+	}
+	if options.Format == "json" {
+		return findings, writeJSON(output, results)
+	}
+	for _, result := range results {
+		text := "not chopped"
+		if result.NonChoppable {
+			text = "non-choppable"
+		} else if len(result.Parallel) != 0 {
+			lines := []string{}
+			for x := range result.Parallel {
+				lines = append(lines, fmt.Sprint(result.Parallel[x]))
+			}
+			text = "parallel piece lines " + strings.Join(lines, ", ")
+		}
+		if result.RollbackSafe {
+			text += fmt.Sprintf("; rollback-safe, first piece up to line %d", result.FirstPieceEnd)
+		}
+		if _, err = fmt.Fprintf(output, "%s: %s\n", result.Function, text); err != nil {
+			return false, err
+		}
+	}
+	return findings, nil
+}
+
+// @title:	runDumpAstCommand
+//
+// @description:	This is used to print the AST of the source code as a dump which `loadAstDump` reads back. The
+//filters do not apply and there is never a finding.
+//
+// @param: 	analysis *Analysis	The results of the analyses.
+//
+// @param: 	options *CommandOptions	The options.
+//
+// @param: 	output io.Writer	The output.
+//
+// @return:	findings bool	Always false.
+//
+// @return:	err error	If the AST can be printed, return nil, otherwise return an error.
+//
+func runDumpAstCommand(analysis *Analysis, options *CommandOptions, output io.Writer) (findings bool, err error) {
+	return false, writeAstDump(output, analysis.Ast, analysis.FileSet, &options.Dump)
+}
+
+// @title:	runSimulateCommand
+//
+// @description:	This is used to schedule the selected transactions in rounds, every transaction in the first round
+//where it conflicts with no other one, as a block of one instance of every transaction would run. A transaction
+//conflicting with itself can only run once per round. A conflict is a finding.
+//
+// @param: 	analysis *Analysis	The results of the analyses.
+//
+// @param: 	options *CommandOptions	The options.
+//
+// @param: 	output io.Writer	The output.
+//
+// @return:	findings bool	If two transactions conflict, return true, otherwise return false.
+//
+// @return:	err error	If the rounds can be printed, return nil, otherwise return an error.
+//
+func runSimulateCommand(analysis *Analysis, options *CommandOptions, output io.Writer) (findings bool, err error) {
+	conflicting := map[[2]string]bool{}
+	selfConflicting := map[string]bool{}
+	for _, edge := range analysis.Conflicts {
+		conflicting[[2]string{edge.From, edge.To}], conflicting[[2]string{edge.To, edge.From}] = true, true
+		if edge.From == edge.To {
+			selfConflicting[edge.From] = true
+		}
+	}
+	rounds := [][]string{}
+	for _, name := range findTransactions(analysis.Ast) {
+		if !selectsFunction(options, name) {
+			continue
+		}
+		placed := false
+		for x := range rounds {
+			free := true
+			for _, other := range rounds[x] {
+				if conflicting[[2]string{name, other}] {
+					free = false
+					findings = true
+				}
+			}
+			if free {
+				rounds[x] = append(rounds[x], name)
+				placed = true
+				break
+			}
+		}
+		if !placed {
+			rounds = append(rounds, []string{name})
+		}
+	}
+	if options.Format == "json" {
+		return findings, writeJSON(output, map[string]interface{}{"rounds": rounds,
+			"selfConflicting": selfConflicting})
+	}
+	for x := range rounds {
+		names := []string{}
+		for _, name := range rounds[x] {
+			if selfConflicting[name] {
+				name += " (serial)"
+			}
+			names = append(names, name)
+		}
+		if _, err = fmt.Fprintf(output, "round %d: %s\n", x+1, strings.Join(names, ", ")); err != nil {
+			return false, err
+		}
+	}
+	return findings, nil
+}
+
+// @title:	printUsage
+//
+// @description:	This is used to print the usage of the program with its commands.
+//
+// @param: 	output io.Writer	The output.
+//
+func printUsage(output io.Writer) {
+	fmt.Fprintln(output, "Usage: goast-viewer <command> [-format text|json] [-include functions] "+
+		"[-exclude functions] [-spec api.json] [-chaincodes config.json] input.go|ast.json")
+	fmt.Fprintln(output, "       goast-viewer dump-ast [-compact] [-raw-positions] [-prune] input.go|ast.json")
+	fmt.Fprintln(output, "       goast-viewer lsp")
+	fmt.Fprintln(output, "       goast-viewer [-explain] [-guards] [-conflicts] [-summary] [-paths] [-aborts] "+
+		"[-spec api.json] [-chaincodes config.json] [-sarif out.sarif] [-html out/] [-dot out/] [-delta out.go] "+
+		"input.go|ast.json")
+	fmt.Fprintln(output, "\nCommands:")
+	for _, command := range commands {
+		fmt.Fprintf(output, "  %-10s %s\n", command.Name, command.Description)
+	}
+	fmt.Fprintln(output, "  lsp        serve the Language Server Protocol over stdio")
+	fmt.Fprintln(output, "\nAn input ending with .json is read as an AST dump instead of Go source code.")
+	fmt.Fprintln(output, "\nExit codes: 0 without findings, 1 with findings, 2 on a usage or parse error. phase2 "+
+		"and dump-ast have no finding.")
+}
+
+// @title:	findCommand
+//
+// @description:	This is used to find a command by its name.
+//
+// @param: 	name string	The name of the command.
+//
+// @return:	*Command	The command, or nil if there is none.
+//
+func findCommand(name string) *Command {
+	for _, command := range commands {
+		if command.Name == name {
+			return command
+		}
+	}
+	return nil
+}
+
+// @title:	runCommand
+//
+// @description:	This is used to run a command with its arguments.
+//
+// @param: 	command *Command	The command.
+//
+// @param: 	args []string	The arguments after the name of the command.
+//
+// @return:	int		The exit code.
+//
+func runCommand(command *Command, args []string) int {
+	options := &CommandOptions{}
+	flags := flag.NewFlagSet(command.Name, flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	flags.StringVar(&options.Format, "format", "text", "print the results as `text` or json")
+	flags.StringVar(&options.Include, "include", "", "report only the functions matching the comma-separated `patterns`")
+	flags.StringVar(&options.Exclude, "exclude", "", "never report the functions matching the comma-separated `patterns`")
+	flags.StringVar(&options.Spec, "spec", "", "add the APIs reading and writing the ledger of the JSON `file`")
+	flags.StringVar(&options.Chaincodes, "chaincodes", "", "resolve InvokeChaincode with the JSON `file` mapping chaincode names to source directories")
+	if command.Name == "dump-ast" {
+		flags.BoolVar(&options.Dump.Compact, "compact", false, "print the JSON on one line instead of indented")
+		flags.BoolVar(&options.Dump.RawPositions, "raw-positions", false, "print the positions as raw token.Pos instead of line:col")
+		flags.BoolVar(&options.Dump.Prune, "prune", false, "leave out the trailing nodes with neither a position, an attribute nor a child")
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() != 1 || (options.Format != "text" && options.Format != "json") {
+		printUsage(os.Stderr)
+		return exitUsage
+	}
+	if options.Spec != "" {
+		var err error
+		if options.APIs, err = loadAPISpec(options.Spec); err != nil {
+			fmt.Fprintln(os.Stderr, "Error", err)
+			return exitUsage
+		}
+	}
+	var chaincodes *chaincodeResolver
+	if options.Chaincodes != "" {
+		var err error
+		if chaincodes, err = loadChaincodeConfig(options.Chaincodes); err != nil {
+			fmt.Fprintln(os.Stderr, "Error", err)
+			return exitUsage
+		}
+	}
+	source, err := ioutil.ReadFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error", err)
+		return exitUsage
+	}
+	var analysis *Analysis
+	var syntaxErr error
+	if filepath.Ext(flags.Arg(0)) == ".json" && command.ParseOnly {
+		a, fileSet, err := loadAstDump(flags.Arg(0), source)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error", err)
+			return exitUsage
+		}
+		analysis = &Analysis{Filename: fileSet.File(token.Pos(a.Pos)).Name(), FileSet: fileSet, Ast: a}
+	} else if filepath.Ext(flags.Arg(0)) == ".json" {
+		if analysis, err = analyzeDump(flags.Arg(0), source, chaincodes, options.APIs); err != nil {
+			fmt.Fprintln(os.Stderr, "Error", err)
+			return exitUsage
+		}
+	} else if command.ParseOnly {
+		analysis, syntaxErr = parseSource(flags.Arg(0), string(source))
+	} else {
+		analysis, syntaxErr = analyzeSource(flags.Arg(0), string(source), chaincodes, options.APIs)
+	}
+	if syntaxErr != nil {
+		printSyntaxErrors(syntaxErr, os.Stderr)
+	}
+	if analysis == nil {
+		return exitUsage
+	}
+	printSkippedDeclarations(analysis.Skipped, analysis.FileSet, os.Stderr)
+	for _, failure := range analysis.Failures {
+		fmt.Fprintf(os.Stderr, "%s line %d: %s\n", failure.Function, lineOf(analysis.FileSet, failure.Pos),
+			failure.Message)
+	}
+	findings, err := command.Run(analysis, options, os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error", err)
+		return exitUsage
+	}
+	if syntaxErr != nil {
+		return exitUsage
+	} else if findings {
+		return exitFindings
+	}
+	return exitClean
+}
@@ -0,0 +1,153 @@
+package stcpsce
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// @title:	runTestCommand
+//
+// @description:	This is used to run a command of a test, its output written to a file and its errors discarded.
+//
+// @param: 	t *testing.T	The test.
+//
+// @param: 	name string	The name of the command.
+//
+// @param: 	args ...string	The arguments after the name of the command.
+//
+// @return:	int		The exit code.
+//
+// @return:	string		The output of the command.
+//
+func runTestCommand(t *testing.T, name string, args ...string) (int, string) {
+	t.Helper()
+	output, err := ioutil.TempFile("", "output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(output.Name())
+	defer output.Close()
+	discard, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer discard.Close()
+	stdout, stderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = output, discard
+	code := runCommand(findCommand(name), args)
+	os.Stdout, os.Stderr = stdout, stderr
+	body, err := ioutil.ReadFile(output.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code, string(body)
+}
+
+func TestRunCommandExitCodes(t *testing.T) {
+	directory, err := ioutil.TempDir("", "cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+	files := map[string]string{
+		"chain.go": `package main
+
+func Pay(note string, total string) {
+	memo := note
+	total = memo
+}
+`,
+		"clean.go": `package main
+
+func Pay() {
+}
+`,
+		"broken.go": `package main
+
+func Pay( {
+}
+`,
+		"broken.json": `{"label": "*ast.File"}`,
+		"state.go": `package main
+
+func Load(stub shim.ChaincodeStubInterface, key string) {
+	stub.GetState(key)
+}
+`,
+	}
+	for name, body := range files {
+		if err = ioutil.WriteFile(filepath.Join(directory, name), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, dump := runTestCommand(t, "dump-ast", filepath.Join(directory, "chain.go"))
+	if err = ioutil.WriteFile(filepath.Join(directory, "chain.json"), []byte(dump), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		name string
+		args []string
+		code int
+	}{
+		{"phase1", []string{"chain.go"}, exitFindings},
+		{"phase1", []string{"chain.json"}, exitFindings},
+		{"phase1", []string{"-exclude", "Pay", "chain.go"}, exitClean},
+		{"phase1", []string{"clean.go"}, exitClean},
+		{"phase1", []string{"broken.go"}, exitUsage},
+		{"phase1", []string{"broken.json"}, exitUsage},
+		{"phase1", []string{"missing.go"}, exitUsage},
+		{"phase1", []string{"-format", "xml", "chain.go"}, exitUsage},
+		{"phase1", []string{"-unknown", "chain.go"}, exitUsage},
+		{"phase1", []string{"chain.go", "clean.go"}, exitUsage},
+		{"phase2", []string{"state.go"}, exitClean},
+		{"dump-ast", []string{"chain.go"}, exitClean},
+		{"dump-ast", []string{"chain.json"}, exitClean},
+		{"dump-ast", []string{"broken.go"}, exitUsage},
+	} {
+		args := append([]string{}, test.args...)
+		if last := len(args) - 1; last >= 0 && filepath.Ext(args[last]) != "" {
+			args[last] = filepath.Join(directory, args[last])
+		}
+		if code, _ := runTestCommand(t, test.name, args...); code != test.code {
+			t.Errorf("%s %v exits with %d, want %d", test.name, test.args, code, test.code)
+		}
+	}
+}
+
+func TestRunCommandSpec(t *testing.T) {
+	directory, err := ioutil.TempDir("", "cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+	files := map[string]string{
+		"asset.go": `package main
+
+func Save(stub shim.ChaincodeStubInterface, key string) {
+	stub.PutAsset(key, []byte("1"))
+}
+`,
+		"api.json": `{"write": {"PutAsset": [0]}}`,
+	}
+	for name, body := range files {
+		if err = ioutil.WriteFile(filepath.Join(directory, name), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	source := filepath.Join(directory, "asset.go")
+	// The spec only applies to the command it is given to, a later command sees the APIs of the stub alone.
+	for _, test := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-spec", filepath.Join(directory, "api.json"), source}, "PutState:\nmap[Save:[1]]\n"},
+		{[]string{source}, "PutState:\nmap[Save:[]]\n"},
+	} {
+		if _, output := runTestCommand(t, "phase2", test.args...); !strings.HasSuffix(output, test.want) {
+			t.Errorf("phase2 %v prints %q, want the suffix %q", test.args, output, test.want)
+		}
+	}
+}
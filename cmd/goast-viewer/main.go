@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	stcpsce "github.com/yuroyoro/goast-viewer"
+	"golang.org/x/tools/go/analysis/unitchecker"
+)
+
+// @title:	isVetToolInvocation
+//
+// @description:	This is used to determine if the program is run by `go vet -vettool`. `go vet` asks for the version
+//or the flags of the tool alone, or passes the JSON configuration of a package in a `.cfg` file after the flags of the
+//analyzers, so a command or an input file is never taken for it.
+//
+// @param: 	args []string	The arguments of the program, without its name.
+//
+// @return:	bool		If the program is run by `go vet`, return true, otherwise return false.
+//
+func isVetToolInvocation(args []string) bool {
+	if len(args) == 1 && (args[0] == "-V=full" || args[0] == "-flags") {
+		return true
+	}
+	if len(args) == 0 || !strings.HasSuffix(args[len(args)-1], ".cfg") {
+		return false
+	}
+	for _, arg := range args[:len(args)-1] {
+		if !strings.HasPrefix(arg, "-") {
+			return false
+		}
+	}
+	body, err := ioutil.ReadFile(args[len(args)-1])
+	if err != nil {
+		return false
+	}
+	config := &unitchecker.Config{}
+	return json.Unmarshal(body, config) == nil && config.ImportPath != ""
+}
+
+// @title:	main
+//
+// @description:	This is the main function, it runs the analyzers for `go vet` and the program otherwise.
+//
+func main() {
+	if isVetToolInvocation(os.Args[1:]) {
+		unitchecker.Main(stcpsce.ReadWriteAnalyzer, stcpsce.ChoppingAnalyzer)
+	}
+	stcpsce.Main()
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsVetToolInvocation(t *testing.T) {
+	directory, err := ioutil.TempDir("", "vet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+	files := map[string]string{
+		"vet.cfg":    `{"ID": "example.com/cc", "ImportPath": "example.com/cc", "GoFiles": ["main.go"]}`,
+		"source.cfg": "package main\n",
+	}
+	for name, body := range files {
+		if err = ioutil.WriteFile(filepath.Join(directory, name), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	vet, source := filepath.Join(directory, "vet.cfg"), filepath.Join(directory, "source.cfg")
+	for _, test := range []struct {
+		args []string
+		want bool
+	}{
+		{[]string{"-V=full"}, true},
+		{[]string{"-flags"}, true},
+		{[]string{vet}, true},
+		{[]string{"-chopping", "-readwrite", vet}, true},
+		{[]string{}, false},
+		{[]string{"-flags", "input.go"}, false},
+		{[]string{source}, false},
+		{[]string{"phase1", vet}, false},
+		{[]string{"-explain", filepath.Join(directory, "missing.cfg")}, false},
+	} {
+		if got := isVetToolInvocation(test.args); got != test.want {
+			t.Errorf("isVetToolInvocation(%v) = %v, want %v", test.args, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package stcpsce
+
+import (
+	"container/list"
+	"fmt"
+	"strings"
+)
+
+// @title:	findDefinedLabels
+//
+// @description:	This is used to find the labels defined in a node by `:=`, `var` or a `range` clause with `:=`.
+//
+// @param: 	ast *Ast	The node which needs to be searched.
+//
+// @return:	labels *list.List	List of defined labels.
+//
+func findDefinedLabels(ast *Ast) (labels *list.List) {
+	labels = list.New()
+	if left, _, kind := splitStatement(ast); kind == statementDefinition {
+		labels.PushBackList(addLabelsInLeftValue(left))
+	} else if strings.Contains(ast.Label, "RangeStmt") && ast.Attrs["Tok"] == ":=" {
+		for x := range ast.Children {
+			if strings.HasPrefix(ast.Children[x].Label, "Key") || strings.HasPrefix(ast.Children[x].Label, "Value") {
+				labels.PushBack(ast.Children[x])
+			}
+		}
+	}
+	for x := range ast.Children {
+		labels.PushBackList(findDefinedLabels(ast.Children[x]))
+	}
+	return labels
+}
+
+// @title:	findCapturedWrites
+//
+// @description:	This is used to find the statements of a closure which assign variables captured from the function
+//around it, that is variables which are neither parameters of the closure nor defined in it.
+//
+// @param: 	ast *Ast	The `FuncLit` node.
+//
+// @return:	statements []*Ast	List of statements assigning captured variables.
+//
+// @return:	captured []*Ast		List of the captured variables, one for each statement.
+//
+func findCapturedWrites(ast *Ast) (statements []*Ast, captured []*Ast) {
+	locals := findDefinedLabels(findFunctionBody(ast))
+	arguments := findFunctionArguments(ast)
+	for x := range arguments {
+		locals.PushBack(arguments[x])
+	}
+	var walk func(node *Ast)
+	walk = func(node *Ast) {
+		if left, _, kind := splitStatement(node); kind == statementAssignment || kind == statementUpdate {
+			for x := range left.Children {
+				root := findRootLabel(left.Children[x])
+				if root == nil || root.Attrs["Name"] == "_" {
+					continue
+				}
+				local := false
+				for e := locals.Front(); e != nil; e = e.Next() {
+					if astNodeEqual(root, e.Value.(*Ast)) {
+						local = true
+					}
+				}
+				if !local {
+					statements = append(statements, node)
+					captured = append(captured, root)
+					return
+				}
+			}
+		}
+		for x := range node.Children {
+			walk(node.Children[x])
+		}
+	}
+	walk(findFunctionBody(ast))
+	return statements, captured
+}
+
+// @title:	findClosureExchangeableSentences
+//
+// @description:	This is used to find the exchangeable sentences in a closure. The body of a closure runs when it is
+//called rather than where it is written, so it is analyzed as a function of its own and an assignment of a captured
+//variable is rejected: it changes the function around it at an unknown point.
+//
+// @param: 	ast *Ast	The `FuncLit` node.
+//
+// @param: 	verdicts *list.List	List which the verdicts of the candidate statements are appended to, or nil.
+//
+// @return:	pos []*Ast	List of exchangeable sentences in the closure.
+//
+func findClosureExchangeableSentences(ast *Ast, verdicts *list.List) (pos []*Ast) {
+	pos = []*Ast{}
+	closureVerdicts := list.New()
+	kernels := findExchangeableSentences(findFunctionBody(ast), findFunctionArguments(ast), closureVerdicts)
+	statements, captured := findCapturedWrites(ast)
+	for x := range kernels {
+		rejected := false
+		for y := range statements {
+			if statements[y] == kernels[x] {
+				rejected = true
+				for e := closureVerdicts.Front(); e != nil; e = e.Next() {
+					if e.Value.(*Verdict).Statement == kernels[x] {
+						e.Value.(*Verdict).Accepted = false
+						e.Value.(*Verdict).Kind = verdictCaptured
+						e.Value.(*Verdict).Evidence = captured[y]
+					}
+				}
+			}
+		}
+		if !rejected {
+			pos = append(pos, kernels[x])
+		}
+	}
+	if verdicts != nil {
+		verdicts.PushBackList(closureVerdicts)
+	}
+	return pos
+}
+
+// @title:	findDetachedExchangeableSentences
+//
+// @description:	This is used to reject every candidate statement under a `defer` or `go` statement. A deferred call
+//runs when the function returns, in the reverse order of the `defer` statements, and a goroutine runs concurrently,
+//so none of them can be exchanged with the statements around them.
+//
+// @param: 	ast *Ast	The `DeferStmt` or `GoStmt` node.
+//
+// @param: 	functionArguments []*Ast	List of arguments of the function.
+//
+// @param: 	verdicts *list.List	List which the verdicts of the candidate statements are appended to, or nil.
+//
+func findDetachedExchangeableSentences(ast *Ast, functionArguments []*Ast, verdicts *list.List) {
+	detachedVerdicts := list.New()
+	for x := range ast.Children {
+		findExchangeableSentences(ast.Children[x], functionArguments, detachedVerdicts)
+	}
+	kind := verdictDeferred
+	if strings.Contains(ast.Label, "GoStmt") {
+		kind = verdictGoroutine
+	}
+	for e := detachedVerdicts.Front(); e != nil; e = e.Next() {
+		if e.Value.(*Verdict).Accepted {
+			e.Value.(*Verdict).Accepted = false
+			e.Value.(*Verdict).Kind = kind
+			e.Value.(*Verdict).Evidence = ast
+		}
+	}
+	if verdicts != nil {
+		verdicts.PushBackList(detachedVerdicts)
+	}
+}
+
+// @title:	findNestedClosures
+//
+// @description:	This is used to find the exchangeable sentences of the closures, deferred calls and goroutines
+//nested in a statement, which `findExchangeableSentences` does not walk into.
+//
+// @param: 	ast *Ast	The statement.
+//
+// @param: 	functionArguments []*Ast	List of arguments of the function.
+//
+// @param: 	verdicts *list.List	List which the verdicts of the candidate statements are appended to, or nil.
+//
+// @return:	pos []*Ast	List of exchangeable sentences in the closures.
+//
+func findNestedClosures(ast *Ast, functionArguments []*Ast, verdicts *list.List) (pos []*Ast) {
+	pos = []*Ast{}
+	for x := range ast.Children {
+		child := ast.Children[x]
+		if strings.Contains(child.Label, "FuncLit") {
+			pos = append(pos, findClosureExchangeableSentences(child, verdicts)...)
+		} else if strings.Contains(child.Label, "DeferStmt") || strings.Contains(child.Label, "GoStmt") {
+			findDetachedExchangeableSentences(child, functionArguments, verdicts)
+		} else {
+			pos = append(pos, findNestedClosures(child, functionArguments, verdicts)...)
+		}
+	}
+	return pos
+}
+
+// @title:	findStateWrites
+//
+// @description:	This is used to find the calls writing to the ledger in a node.
+//
+// @param: 	ast *Ast	The node which needs to be searched.
+//
+// @param: 	PutStateMap map[string][]int	Map of `PutState` expressions in the function.
+//
+// @param: 	spec *APISpec	The APIs added by a spec file, or nil.
+//
+// @return:	calls []*Ast	List of `CallExpr` nodes writing to the ledger.
+//
+func findStateWrites(ast *Ast, PutStateMap map[string][]int, spec *APISpec) (calls []*Ast) {
+	calls = []*Ast{}
+	if strings.Contains(ast.Label, "CallExpr") && isStateWritingCall(ast, PutStateMap, spec) {
+		calls = append(calls, ast)
+	}
+	for x := range ast.Children {
+		calls = append(calls, findStateWrites(ast.Children[x], PutStateMap, spec)...)
+	}
+	return calls
+}
+
+// @title:	analyzeConcurrency
+//
+// @description:	This is used to find goroutines, deferred calls and closures in every function.
+// A function spawning a goroutine or deferring a call around state writes is non-choppable: the goroutine accesses
+// the ledger in no particular order and the deferred call runs after every piece.
+// A closure assigning a captured variable is only reported.
+//
+// @param: 	ast *Ast	The root node of the file.
+//
+// @param: 	PutStateMap map[string][]int	Map of `PutState` expressions in the function.
+//
+// @param: 	spec *APISpec	The APIs added by a spec file, or nil.
+//
+// @param: 	failures *list.List	List which the diagnostics of the functions failing to be analyzed are appended to, or
+//nil.
+//
+// @return:	diagnostics []*Diagnostic	List of findings.
+//
+// @return:	nonChoppable map[string]bool	Set of the names of non-choppable functions.
+//
+func analyzeConcurrency(ast *Ast, PutStateMap map[string][]int, spec *APISpec, failures *list.List) (
+	diagnostics []*Diagnostic, nonChoppable map[string]bool) {
+	diagnostics = []*Diagnostic{}
+	nonChoppable = map[string]bool{}
+	functions := findFunctionDeclarations(ast)
+	for x := range functions {
+		name := findFunctionName(functions[x])
+		body := findFunctionBody(functions[x])
+		if body == nil {
+			continue
+		}
+		// The findings of a function are kept only if it does not fail.
+		functionDiagnostics := []*Diagnostic{}
+		choppable := true
+		isolateFunction(functions[x], "concurrency", failures, func() {
+			writes := findStateWrites(body, PutStateMap, spec)
+			var walk func(node *Ast)
+			walk = func(node *Ast) {
+				if strings.Contains(node.Label, "GoStmt") {
+					functionDiagnostics = append(functionDiagnostics, &Diagnostic{Rule: "goroutine", Function: name,
+						Pos: node.Pos, End: node.End, Message: fmt.Sprintf("`go` spawns a goroutine whose ledger "+
+							"accesses are not ordered with the transaction, %s is non-choppable", name)})
+					choppable = false
+				} else if strings.Contains(node.Label, "DeferStmt") {
+					if len(findStateWrites(node, PutStateMap, spec)) != 0 {
+						functionDiagnostics = append(functionDiagnostics, &Diagnostic{Rule: "defer-state-write",
+							Function: name, Pos: node.Pos, End: node.End, Message: fmt.Sprintf("`defer` writes state "+
+								"when the function returns, after every piece, %s is non-choppable", name)})
+						choppable = false
+					} else if len(writes) != 0 {
+						functionDiagnostics = append(functionDiagnostics, &Diagnostic{Rule: "defer-around-write",
+							Function: name, Pos: node.Pos, End: node.End, Message: fmt.Sprintf("`defer` runs after "+
+								"%d state write(s) of the function, %s is non-choppable", len(writes), name)})
+						choppable = false
+					}
+				} else if strings.Contains(node.Label, "FuncLit") {
+					statements, captured := findCapturedWrites(node)
+					for y := range statements {
+						functionDiagnostics = append(functionDiagnostics, &Diagnostic{Rule: "closure-captured-write",
+							Function: name, Pos: statements[y].Pos, End: statements[y].End, Message: fmt.Sprintf(
+								"closure assigns captured variable `%s`, which changes %s whenever the closure is "+
+									"called", captured[y].Attrs["Name"], name)})
+					}
+				}
+				for y := range node.Children {
+					walk(node.Children[y])
+				}
+			}
+			walk(body)
+			diagnostics = append(diagnostics, functionDiagnostics...)
+			if !choppable {
+				nonChoppable[name] = true
+			}
+		})
+	}
+	return diagnostics, nonChoppable
+}
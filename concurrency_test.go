@@ -0,0 +1,70 @@
+package stcpsce
+
+import (
+	"container/list"
+	"testing"
+)
+
+const concurrencySource = `package main
+
+import "github.com/hyperledger/fabric/core/chaincode/shim"
+
+type SmartContract struct{}
+
+func (s *SmartContract) Spawn(stub shim.ChaincodeStubInterface, args []string) {
+	go stub.PutState(args[0], []byte("1"))
+}
+
+func (s *SmartContract) Defer(stub shim.ChaincodeStubInterface, args []string) {
+	defer stub.PutState(args[0], []byte("1"))
+}
+
+func (s *SmartContract) Capture(stub shim.ChaincodeStubInterface, args []string) {
+	count := 0
+	add := func() {
+		count++
+	}
+	add()
+	stub.PutState(args[0], []byte{byte(count)})
+}
+`
+
+func TestAnalyzeConcurrency(t *testing.T) {
+	analysis := analyzeTestSource(t, concurrencySource)
+	diagnostics, nonChoppable := analyzeConcurrency(analysis.Ast, analysis.PutStateMap, nil, nil)
+	rules := map[string]string{}
+	for _, diagnostic := range diagnostics {
+		rules[diagnostic.Function] = diagnostic.Rule
+	}
+	want := map[string]string{"Spawn": "goroutine", "Defer": "defer-state-write", "Capture": "closure-captured-write"}
+	for function := range want {
+		if rules[function] != want[function] {
+			t.Errorf("rule of %s = %q, want %q", function, rules[function], want[function])
+		}
+	}
+	if !nonChoppable["Spawn"] || !nonChoppable["Defer"] || nonChoppable["Capture"] {
+		t.Errorf("non-choppable = %v, want Spawn and Defer", nonChoppable)
+	}
+}
+
+func TestClosureVerdicts(t *testing.T) {
+	analysis := analyzeTestSource(t, concurrencySource)
+	function := findTestFunction(t, analysis.Ast, "Capture")
+	verdicts := list.New()
+	pos := findExchangeableSentences(findFunctionBody(function), findFunctionArguments(function), verdicts)
+	for x := range pos {
+		if lineOf(analysis.FileSet, pos[x].Pos) == 18 {
+			t.Errorf("the closure statement is a candidate of Capture")
+		}
+	}
+	found := false
+	for e := verdicts.Front(); e != nil; e = e.Next() {
+		verdict := e.Value.(*Verdict)
+		if lineOf(analysis.FileSet, verdict.Statement.Pos) == 18 {
+			found = !verdict.Accepted && verdict.Kind == verdictCaptured
+		}
+	}
+	if !found {
+		t.Errorf("`count++` in the closure is not rejected as a captured write")
+	}
+}
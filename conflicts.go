@@ -0,0 +1,230 @@
+package stcpsce
+
+import (
+	"container/list"
+	"fmt"
+	"go/token"
+	"strings"
+)
+
+// ConflictEdge
+//
+// @description:	This is used to describe an edge of the conflict graph, two transactions which may access the same
+//key while one of them writes it. A transaction conflicts with itself when it runs twice concurrently.
+//
+type ConflictEdge struct {
+	From string
+	To   string
+	// Kinds lists the kinds of the conflicts, like `read-write`, in the order they are found.
+	Kinds []string
+	// Evidence holds the accesses of the first conflict of each kind, the one of `From` first, preferring a conflict
+	// whose writes are on every committing path.
+	Evidence [][2]*KeyAccess
+	// May tells for each kind if its conflicts all come from may-writes, which are only on some committing paths.
+	May []bool
+}
+
+// @title:	findTransactions
+//
+// @description:	This is used to find the transactions of the chaincode, which are the methods other than `Init` and
+//`Invoke`.
+//
+// @param: 	ast *Ast	The root node of the file.
+//
+// @return:	transactions []string	List of the names of the transactions in declaration order.
+//
+func findTransactions(ast *Ast) (transactions []string) {
+	transactions = []string{}
+	functions := findFunctionDeclarations(ast)
+	for x := range functions {
+		name := findFunctionName(functions[x])
+		if isMethodDeclaration(functions[x]) && name != "Init" && name != "Invoke" {
+			transactions = append(transactions, name)
+		}
+	}
+	return transactions
+}
+
+// @title:	keyTemplateHasPrefix
+//
+// @description:	This is used to determine if the keys of a template may start with the keys of a prefix.
+//
+// @param: 	template *KeyTemplate	The template.
+//
+// @param: 	prefix *KeyTemplate	The template of the prefix.
+//
+// @return:	bool		If it is not proven that no key starts with the prefix, return true, otherwise return false.
+//
+func keyTemplateHasPrefix(template *KeyTemplate, prefix *KeyTemplate) bool {
+	cells, prefixCells := keyTemplateCells(template, false), keyTemplateCells(prefix, false)
+	if length := keyTemplateLength(template); length >= 0 && length < len(prefixCells) {
+		return false
+	}
+	for x := 0; x < len(cells) && x < len(prefixCells); x++ {
+		if cells[x] >= 0 && prefixCells[x] >= 0 && cells[x] != prefixCells[x] {
+			return false
+		}
+	}
+	return true
+}
+
+// @title:	keyTemplateInRange
+//
+// @description:	This is used to determine if the keys of a template may fall within a range.
+//
+// @param: 	template *KeyTemplate	The template.
+//
+// @param: 	start *KeyTemplate	The template of the first key of the range.
+//
+// @param: 	end *KeyTemplate	The template of the key after the range, empty if the range has no end.
+//
+// @return:	bool		If it is not proven that the keys are out of the range, return true, otherwise return false.
+//
+func keyTemplateInRange(template *KeyTemplate, start *KeyTemplate, end *KeyTemplate) bool {
+	if order, known := compareKeyTemplates(template, start); known && order < 0 {
+		return false
+	}
+	if bound, ok := keyTemplateConstant(end); ok && bound == "" {
+		return true
+	} else if order, known := compareKeyTemplates(template, end); known && order >= 0 {
+		return false
+	}
+	return true
+}
+
+// @title:	findConflictKind
+//
+// @description:	This is used to determine if two accesses may conflict. Accesses to different private data collections,
+//or to a collection and the world state, never conflict. A range read conflicts with a write whose key
+//may fall within the range, which is a phantom: the key may not exist when the range is read. A partial composite key
+//read conflicts with a write whose key may start with its prefix, other accesses conflict if their keys are not
+//proven disjoint.
+//
+// @param: 	a *KeyAccess	An access.
+//
+// @param: 	b *KeyAccess	Another access.
+//
+// @return:	string		The kind of the conflict, or an empty string if there is none.
+//
+func findConflictKind(a *KeyAccess, b *KeyAccess) string {
+	if (!a.Write && !b.Write) || !sameKeyNamespace(a, b) {
+		return ""
+	} else if a.Write && b.Write {
+		if !keyTemplatesDisjoint(a.Key, b.Key) {
+			return "write-write"
+		}
+		return ""
+	}
+	read, write := a, b
+	if a.Write {
+		read, write = b, a
+	}
+	if read.End != nil {
+		if keyTemplateInRange(write.Key, read.Key, read.End) {
+			return "phantom"
+		}
+		return ""
+	} else if read.Partial {
+		if keyTemplateHasPrefix(write.Key, read.Key) {
+			return "partial-read-write"
+		}
+		return ""
+	} else if !keyTemplatesDisjoint(read.Key, write.Key) {
+		return "read-write"
+	}
+	return ""
+}
+
+// @title:	analyzeConflicts
+//
+// @description:	This is used to build the conflict graph of the transactions from the key templates of their
+//accesses. A conflict involving a write which is only on some committing paths of its transaction is a may conflict.
+//
+// @param: 	ast *Ast	The root node of the file.
+//
+// @param: 	accesses []*KeyAccess	List of accesses of every function.
+//
+// @param: 	paths []*FunctionPaths	List of the paths of every function, their may accesses tell the may-writes.
+//
+// @param: 	failures *list.List	List which the diagnostics of the functions failing to be analyzed are appended to, or
+//nil.
+//
+// @return:	edges []*ConflictEdge	List of edges.
+//
+func analyzeConflicts(ast *Ast, accesses []*KeyAccess, paths []*FunctionPaths, failures *list.List) (
+	edges []*ConflictEdge) {
+	edges = []*ConflictEdge{}
+	transactions := findTransactions(ast)
+	declarations := map[string]*Ast{}
+	for _, declaration := range findFunctionDeclarations(ast) {
+		declarations[findFunctionName(declaration)] = declaration
+	}
+	accessesOf := map[string][]*KeyAccess{}
+	for x := range accesses {
+		accessesOf[accesses[x].Function] = append(accessesOf[accesses[x].Function], accesses[x])
+	}
+	mayWrites := map[*KeyAccess]bool{}
+	for _, function := range paths {
+		for _, access := range function.May {
+			mayWrites[access] = access.Write
+		}
+	}
+	for x := range transactions {
+		// The edges from a transaction are kept only if it does not fail.
+		transactionEdges := []*ConflictEdge{}
+		isolateFunction(declarations[transactions[x]], "conflicts", failures, func() {
+			for y := x; y < len(transactions); y++ {
+				edge := &ConflictEdge{From: transactions[x], To: transactions[y], Kinds: []string{},
+					Evidence: [][2]*KeyAccess{}, May: []bool{}}
+				found := map[string]int{}
+				for _, a := range accessesOf[transactions[x]] {
+					for _, b := range accessesOf[transactions[y]] {
+						kind := findConflictKind(a, b)
+						if kind == "" {
+							continue
+						}
+						may := mayWrites[a] || mayWrites[b]
+						if index, ok := found[kind]; !ok {
+							found[kind] = len(edge.Kinds)
+							edge.Kinds = append(edge.Kinds, kind)
+							edge.Evidence = append(edge.Evidence, [2]*KeyAccess{a, b})
+							edge.May = append(edge.May, may)
+						} else if edge.May[index] && !may {
+							edge.Evidence[index], edge.May[index] = [2]*KeyAccess{a, b}, false
+						}
+					}
+				}
+				if len(edge.Kinds) != 0 {
+					transactionEdges = append(transactionEdges, edge)
+				}
+			}
+			edges = append(edges, transactionEdges...)
+		})
+	}
+	return edges
+}
+
+// @title:	printConflicts
+//
+// @description:	This is used to print the edges of the conflict graph with the lines of the accesses of the first
+//conflict of each kind, a kind coming only from may-writes is marked `may`.
+//
+// @param: 	edges []*ConflictEdge	List of edges.
+//
+// @param: 	fileSet *token.FileSet	The file set which the source code is parsed with.
+//
+func printConflicts(edges []*ConflictEdge, fileSet *token.FileSet) {
+	fmt.Print("\n\nConflicts:\n")
+	for x := range edges {
+		kinds := []string{}
+		for y := range edges[x].Kinds {
+			kind := edges[x].Kinds[y]
+			if edges[x].May[y] {
+				kind = "may " + kind
+			}
+			kinds = append(kinds, fmt.Sprintf("%s (line %d, line %d)", kind,
+				lineOf(fileSet, edges[x].Evidence[y][0].Site.Pos), lineOf(fileSet, edges[x].Evidence[y][1].Site.Pos)))
+		}
+		fmt.Printf("%s -- %s: %s\n", edges[x].From, edges[x].To, strings.Join(kinds, ", "))
+	}
+}
@@ -0,0 +1,162 @@
+package stcpsce
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// @title:	conflictEdges
+//
+// @description:	This is used to build the conflict graph of the source code of a test and format its edges, one
+//of them per line, like `A-B: read-write`. A kind coming only from may-writes is written like `may read-write`.
+//
+// @param: 	t *testing.T	The test.
+//
+// @param: 	source string	The source code.
+//
+// @return:	string		The formatted edges.
+//
+func conflictEdges(t *testing.T, source string) string {
+	t.Helper()
+	analysis := analyzeTestSource(t, source)
+	edges := []string{}
+	for _, edge := range analyzeConflicts(analysis.Ast, analysis.Accesses, analysis.Paths, nil) {
+		kinds := []string{}
+		for x := range edge.Kinds {
+			if edge.May[x] {
+				kinds = append(kinds, "may "+edge.Kinds[x])
+			} else {
+				kinds = append(kinds, edge.Kinds[x])
+			}
+		}
+		edges = append(edges, edge.From+"-"+edge.To+": "+strings.Join(kinds, ", "))
+	}
+	return strings.Join(edges, "\n")
+}
+
+func TestCompositeKeyConflicts(t *testing.T) {
+	got := conflictEdges(t, `package main
+
+import "github.com/hyperledger/fabric/core/chaincode/shim"
+
+type SmartContract struct{}
+
+func (s *SmartContract) Order(stub shim.ChaincodeStubInterface, args []string) {
+	key, _ := stub.CreateCompositeKey("order", []string{args[0], args[1]})
+	stub.PutState(key, []byte("1"))
+}
+
+func (s *SmartContract) Orders(stub shim.ChaincodeStubInterface, args []string) {
+	stub.GetStateByPartialCompositeKey("order", []string{args[0]})
+}
+
+func (s *SmartContract) Users(stub shim.ChaincodeStubInterface, args []string) {
+	stub.GetStateByPartialCompositeKey("user", []string{args[0]})
+}
+`)
+	want := "Order-Order: write-write\nOrder-Orders: partial-read-write"
+	if got != want {
+		t.Errorf("edges =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestPhantomConflicts(t *testing.T) {
+	got := conflictEdges(t, `package main
+
+import "github.com/hyperledger/fabric/core/chaincode/shim"
+
+type SmartContract struct{}
+
+func (s *SmartContract) Open(stub shim.ChaincodeStubInterface, args []string) {
+	stub.PutState("account_"+args[0], []byte("1"))
+}
+
+func (s *SmartContract) Log(stub shim.ChaincodeStubInterface, args []string) {
+	stub.PutState("log_"+args[0], []byte("1"))
+}
+
+func (s *SmartContract) Scan(stub shim.ChaincodeStubInterface, args []string) {
+	stub.GetStateByRange("account_", "accounu")
+}
+`)
+	want := "Open-Open: write-write\nOpen-Scan: phantom\nLog-Log: write-write"
+	if got != want {
+		t.Errorf("edges =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestPrivateDataConflicts(t *testing.T) {
+	source := `package main
+
+import "github.com/hyperledger/fabric/core/chaincode/shim"
+
+type SmartContract struct{}
+
+func (s *SmartContract) Hide(stub shim.ChaincodeStubInterface, args []string) {
+	stub.PutPrivateData("secrets", args[0], []byte("1"))
+}
+
+func (s *SmartContract) Peek(stub shim.ChaincodeStubInterface, args []string) {
+	stub.GetPrivateData("secrets", args[0])
+}
+
+func (s *SmartContract) Show(stub shim.ChaincodeStubInterface, args []string) {
+	stub.GetPrivateData("public", args[0])
+	stub.GetState(args[0])
+}
+`
+	analysis := analyzeTestSource(t, source)
+	if len(analysis.Accesses) != 4 {
+		t.Fatalf("accesses = %d, want 4", len(analysis.Accesses))
+	}
+	if got := formatKeyAccess(analysis.Accesses[0], formatKeyTemplate); got != `"secrets": {args[0]}` {
+		t.Errorf("key = %s, want the collection and the key", got)
+	}
+	want := "Hide-Hide: write-write\nHide-Peek: read-write"
+	if got := conflictEdges(t, source); got != want {
+		t.Errorf("edges =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestMayWriteConflicts(t *testing.T) {
+	source, err := ioutil.ReadFile("input.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The check of TransactSavings aborts, so its save is on every committing path. Once the check commits, the save
+	// is a may-write.
+	abort := `return errormsg("Insufficient funds in source savings account")`
+	if !strings.Contains(string(source), abort) {
+		t.Fatalf("input.txt lacks %s", abort)
+	}
+	for _, test := range []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"must", string(source), "TransactSavings-TransactSavings: read-write, write-write"},
+		{"may", strings.Replace(string(source), abort, "return shim.Success(nil)", 1),
+			"TransactSavings-TransactSavings: may read-write, may write-write"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			edges := strings.Split(conflictEdges(t, test.source), "\n")
+			found := false
+			for _, edge := range edges {
+				if strings.HasPrefix(edge, "TransactSavings-TransactSavings:") {
+					found = true
+					if edge != test.want {
+						t.Errorf("edge = %s, want %s", edge, test.want)
+					}
+				} else if strings.HasPrefix(edge, "TransactSavings-") && strings.Contains(edge, "may") !=
+					(test.name == "may") {
+					t.Errorf("edge = %s, want the conflicts with the save of TransactSavings to be %s", edge,
+						test.name)
+				}
+			}
+			if !found {
+				t.Errorf("edges =\n%s\nwant %s", strings.Join(edges, "\n"), test.want)
+			}
+		})
+	}
+}
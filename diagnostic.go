@@ -0,0 +1,40 @@
+package stcpsce
+
+import (
+	"fmt"
+	"go/token"
+)
+
+// Diagnostic
+//
+// @description:	This is used to describe a finding of an analysis at a position of the source code.
+//
+type Diagnostic struct {
+	// Rule identifies the check which produces the finding, like `goroutine`.
+	Rule     string
+	Function string
+	Pos      int
+	End      int
+	Message  string
+}
+
+// @title:	printDiagnostics
+//
+// @description:	This is used to print a section of diagnostics. Nothing is printed if there is no diagnostic.
+//
+// @param: 	title string	The title of the section.
+//
+// @param: 	diagnostics []*Diagnostic	List of diagnostics.
+//
+// @param: 	fileSet *token.FileSet	The file set which the source code is parsed with.
+//
+func printDiagnostics(title string, diagnostics []*Diagnostic, fileSet *token.FileSet) {
+	if len(diagnostics) == 0 {
+		return
+	}
+	fmt.Printf("\n\n%s:\n", title)
+	for x := range diagnostics {
+		fmt.Printf("%s line %d: [%s] %s\n", diagnostics[x].Function, lineOf(fileSet, diagnostics[x].Pos),
+			diagnostics[x].Rule, diagnostics[x].Message)
+	}
+}
@@ -0,0 +1,150 @@
+package stcpsce
+
+import (
+	"bytes"
+	"container/list"
+	"fmt"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Dependency
+//
+// @description:	This is used to describe an edge of a chain of Phase 1: a statement defines a label which a later
+//statement of the chain reads.
+//
+type Dependency struct {
+	From  *Ast
+	To    *Ast
+	Label *Ast
+}
+
+// ChainGraph
+//
+// @description:	This is used to hold the statements of the chains of a function found by `expendKernels` and the
+//label dependencies between them.
+//
+type ChainGraph struct {
+	Function     string
+	Statements   []*Ast
+	Dependencies []*Dependency
+}
+
+// @title:	addLabelReaders
+//
+// @description:	This is used to record that a statement reads the labels of a list from an element on. A label equal
+//to one before it in the list is recorded for the first one, which is the one `trimList` keeps.
+//
+// @param: 	labels *list.List	List of labels.
+//
+// @param: 	start *list.Element	The first element of the labels read by the statement.
+//
+// @param: 	statement *Ast	The statement.
+//
+// @param: 	readers map[*Ast][]*Ast	Map of labels to the statements reading them.
+//
+func addLabelReaders(labels *list.List, start *list.Element, statement *Ast, readers map[*Ast][]*Ast) {
+	for e := start; e != nil; e = e.Next() {
+		first := labels.Front()
+		for !astNodeEqual(first.Value.(*Ast), e.Value.(*Ast)) {
+			first = first.Next()
+		}
+		label := first.Value.(*Ast)
+		if known := readers[label]; len(known) == 0 || known[len(known)-1] != statement {
+			readers[label] = append(known, statement)
+		}
+	}
+}
+
+// @title:	addDependencies
+//
+// @description:	This is used to add the edges from a statement defining a label to the statements reading it. Nothing
+//is added to a nil graph.
+//
+// @param: 	statement *Ast	The statement defining the label.
+//
+// @param: 	label *Ast	The label.
+//
+// @param: 	readers []*Ast	List of the statements reading the label.
+//
+func (graph *ChainGraph) addDependencies(statement *Ast, label *Ast, readers []*Ast) {
+	if graph == nil {
+		return
+	}
+	for x := range readers {
+		graph.Dependencies = append(graph.Dependencies, &Dependency{From: statement, To: readers[x], Label: label})
+	}
+}
+
+// @title:	formatDotGraph
+//
+// @description:	This is used to format a chain graph in the DOT language of Graphviz. The nodes are the statements,
+//labelled with their lines and source code, and the edges the labels they define for each other.
+//
+// @param: 	graph *ChainGraph	The graph.
+//
+// @param: 	fileSet *token.FileSet	The file set which the source code is parsed with.
+//
+// @param: 	source string	The source code.
+//
+// @return:	string		The graph in DOT.
+//
+func formatDotGraph(graph *ChainGraph, fileSet *token.FileSet, source string) string {
+	buffer := &bytes.Buffer{}
+	fmt.Fprintf(buffer, "digraph %s {\n\tnode [shape=box, fontname=\"monospace\"];\n", strconv.Quote(graph.Function))
+	seen := map[*Ast]bool{}
+	for _, statement := range graph.Statements {
+		if seen[statement] {
+			continue
+		}
+		seen[statement] = true
+		text := strings.Join(strings.Fields(sourceText(fileSet, source, statement)), " ")
+		fmt.Fprintf(buffer, "\tL%d [label=%s];\n", statement.Pos, strconv.Quote(fmt.Sprintf("%d: %s",
+			lineOf(fileSet, statement.Pos), text)))
+	}
+	edges := map[string]bool{}
+	for _, dependency := range graph.Dependencies {
+		edge := fmt.Sprintf("\tL%d -> L%d [label=%s];\n", dependency.From.Pos, dependency.To.Pos,
+			strconv.Quote(sourceText(fileSet, source, dependency.Label)))
+		if !edges[edge] {
+			edges[edge] = true
+			buffer.WriteString(edge)
+		}
+	}
+	buffer.WriteString("}\n")
+	return buffer.String()
+}
+
+// @title:	writeDotGraphs
+//
+// @description:	This is used to write the chain graph of every function to `<function>.dot` in a directory, which is
+//created if needed.
+//
+// @param: 	directory string	The directory.
+//
+// @param: 	graphs *list.List	List of chain graphs.
+//
+// @param: 	fileSet *token.FileSet	The file set which the source code is parsed with.
+//
+// @param: 	source string	The source code.
+//
+// @return:	err error	If the files can be written, return nil, otherwise return an error.
+//
+func writeDotGraphs(directory string, graphs *list.List, fileSet *token.FileSet, source string) (err error) {
+	if err = os.MkdirAll(directory, 0777); err != nil {
+		return err
+	}
+	for e := graphs.Front(); e != nil; e = e.Next() {
+		graph := e.Value.(*ChainGraph)
+		err = ioutil.WriteFile(filepath.Join(directory, graph.Function+".dot"), []byte(formatDotGraph(graph, fileSet,
+			source)), 0666)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package stcpsce
+
+import (
+	"container/list"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteDotGraphs(t *testing.T) {
+	analysis := analyzeTestSource(t, `package main
+
+func Pay(note string, total string) {
+	memo := note
+	total = memo
+}
+`)
+	graphs := list.New()
+	analyzeFunctionDeclaration(analysis.Ast, map[string]bool{}, nil, graphs, nil)
+	directory, err := ioutil.TempDir("", "dot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+	if err = writeDotGraphs(filepath.Join(directory, "dot"), graphs, analysis.FileSet, analysis.Source); err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadFile(filepath.Join(directory, "dot", "Pay.dot"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`digraph "Pay" {`,
+		`[label="4: memo := note"];`,
+		`[label="5: total = memo"];`,
+		`L54 -> L68 [label="memo"];`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("the graph lacks %q:\n%s", want, body)
+		}
+	}
+}
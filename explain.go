@@ -0,0 +1,150 @@
+package stcpsce
+
+import (
+	"container/list"
+	"fmt"
+	"go/token"
+	"strings"
+)
+
+// The kinds of verdicts of Phase 1, each of them is explained by its evidence.
+const (
+	// verdictDefinition rejects `:=` and `var`, the evidence is its left-handed side.
+	verdictDefinition = iota
+	// verdictCondition rejects a statement whose left-handed side appears in a condition in front of it, the evidence
+	// is the label in the condition.
+	verdictCondition
+	// verdictNoCondition accepts a self-increasing or self-decreasing statement, the evidence is its label.
+	verdictNoCondition
+	// verdictLiteral accepts an assignment of a literal, the evidence is the literal.
+	verdictLiteral
+	// verdictArgument accepts an assignment reading an argument, the evidence is the argument.
+	verdictArgument
+	// verdictDefinedLabel accepts an assignment reading a label defined by `:=` or `var`, the evidence is the definition.
+	verdictDefinedLabel
+	// verdictUnknownLabel rejects an assignment reading anything else, the evidence is what it reads.
+	verdictUnknownLabel
+	// verdictCaptured rejects a statement of a closure assigning a captured variable, the evidence is the variable.
+	verdictCaptured
+	// verdictDeferred rejects a statement under `defer`, the evidence is the `DeferStmt`.
+	verdictDeferred
+	// verdictGoroutine rejects a statement under `go`, the evidence is the `GoStmt`.
+	verdictGoroutine
+)
+
+// Verdict
+//
+// @description:	This is used to record why Phase 1 accepts or rejects a candidate statement.
+//
+type Verdict struct {
+	Function  string
+	Statement *Ast
+	Accepted  bool
+	Kind      int
+	Evidence  *Ast
+}
+
+// @title:	recordVerdict
+//
+// @description:	This is used to append a verdict to a list of verdicts if the list is not nil.
+//
+// @param: 	verdicts *list.List	List of verdicts, or nil.
+//
+// @param: 	statement *Ast	The candidate statement.
+//
+// @param: 	accepted bool	If the statement can be parallelized.
+//
+// @param: 	kind int	The kind of the verdict.
+//
+// @param: 	evidence *Ast	The node which explains the verdict.
+//
+func recordVerdict(verdicts *list.List, statement *Ast, accepted bool, kind int, evidence *Ast) {
+	if verdicts != nil {
+		verdicts.PushBack(&Verdict{Statement: statement, Accepted: accepted, Kind: kind, Evidence: evidence})
+	}
+}
+
+// @title:	explainVerdict
+//
+// @description:	This is used to describe the reason of a verdict.
+//
+// @param: 	verdict *Verdict	The verdict.
+//
+// @param: 	fileSet *token.FileSet	The file set which the source code is parsed with.
+//
+// @param: 	source string	The source code.
+//
+// @return:	string		The reason of the verdict.
+//
+func explainVerdict(verdict *Verdict, fileSet *token.FileSet, source string) string {
+	text := ""
+	if verdict.Evidence != nil && verdict.Kind == verdictDefinition {
+		// The left-handed side is a list which has no position.
+		names := []string{}
+		for x := range verdict.Evidence.Children {
+			names = append(names, sourceText(fileSet, source, verdict.Evidence.Children[x]))
+		}
+		text = strings.Join(names, ", ")
+	} else if verdict.Evidence != nil {
+		text = sourceText(fileSet, source, verdict.Evidence)
+	}
+	switch verdict.Kind {
+	case verdictDefinition:
+		return fmt.Sprintf("definition of `%s`, which is only a source of chains", text)
+	case verdictCondition:
+		return fmt.Sprintf("LHS `%s` appears in condition at line %d", text, lineOf(fileSet, verdict.Evidence.Pos))
+	case verdictNoCondition:
+		return fmt.Sprintf("`%s` appears in no condition in front of it", text)
+	case verdictLiteral:
+		return fmt.Sprintf("RHS is the literal `%s`", text)
+	case verdictArgument:
+		return fmt.Sprintf("RHS reads argument `%s`", text)
+	case verdictDefinedLabel:
+		return fmt.Sprintf("RHS reads `%s` defined at line %d", text, lineOf(fileSet, verdict.Evidence.Pos))
+	case verdictCaptured:
+		return fmt.Sprintf("closure assigns captured `%s`, which happens when the closure is called", text)
+	case verdictDeferred:
+		return fmt.Sprintf("deferred at line %d, it runs when the function returns", lineOf(fileSet, verdict.Evidence.Pos))
+	case verdictGoroutine:
+		return fmt.Sprintf("runs in the goroutine spawned at line %d", lineOf(fileSet, verdict.Evidence.Pos))
+	}
+	if verdict.Evidence == nil {
+		return "RHS reads nothing which is an argument or defined in the function"
+	}
+	// Phase 1 only checks a label itself, not the variable a field or an element is read from.
+	if root := findRootLabel(verdict.Evidence); root != nil && root != verdict.Evidence {
+		return fmt.Sprintf("RHS reads `%s` through `%s`, only a label read by itself is checked to be an argument or "+
+			"defined in the function", text, sourceText(fileSet, source, root))
+	}
+	return fmt.Sprintf("RHS reads `%s`, which is neither an argument nor defined in the function", text)
+}
+
+// @title:	printVerdicts
+//
+// @description:	This is used to print the verdict of every candidate statement grouped by function.
+//
+// @param: 	verdicts *list.List	List of verdicts.
+//
+// @param: 	fileSet *token.FileSet	The file set which the source code is parsed with.
+//
+// @param: 	source string	The source code.
+//
+func printVerdicts(verdicts *list.List, fileSet *token.FileSet, source string) {
+	fmt.Print("\n\nExplain:\n")
+	function := ""
+	for e := verdicts.Front(); e != nil; e = e.Next() {
+		verdict := e.Value.(*Verdict)
+		if verdict.Function != function {
+			function = verdict.Function
+			fmt.Printf("%s:\n", function)
+		}
+		result := "reject"
+		if verdict.Accepted {
+			result = "accept"
+		}
+		// Statements spanning several lines are printed on one line.
+		fmt.Printf("\tline %d %s `%s`: %s\n", lineOf(fileSet, verdict.Statement.Pos), result,
+			strings.Join(strings.Fields(sourceText(fileSet, source, verdict.Statement)), " "),
+			explainVerdict(verdict, fileSet, source))
+	}
+}
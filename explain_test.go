@@ -0,0 +1,75 @@
+package stcpsce
+
+import (
+	"container/list"
+	"strings"
+	"testing"
+)
+
+func TestExplainSelectorOperand(t *testing.T) {
+	analysis := analyzeTestSource(t, `package main
+
+type Account struct {
+	Balance int
+}
+
+func Pay(account *Account, total int) {
+	x := &Account{}
+	total = x.Balance
+	total = y
+}
+`)
+	verdicts := list.New()
+	function := findTestFunction(t, analysis.Ast, "Pay")
+	findExchangeableSentences(findFunctionBody(function), findFunctionArguments(function), verdicts)
+	reasons := []string{}
+	for e := verdicts.Front(); e != nil; e = e.Next() {
+		reasons = append(reasons, explainVerdict(e.Value.(*Verdict), analysis.FileSet, analysis.Source))
+	}
+	if len(reasons) != 3 {
+		t.Fatalf("verdicts = %q, want 3", reasons)
+	}
+	if !strings.Contains(reasons[1], "`x.Balance` through `x`") || strings.Contains(reasons[1], "neither") {
+		t.Errorf("reason of a field of a defined variable = %q", reasons[1])
+	}
+	if reasons[2] != "RHS reads `y`, which is neither an argument nor defined in the function" {
+		t.Errorf("reason of an unknown label = %q", reasons[2])
+	}
+}
+
+func TestExplainVerdicts(t *testing.T) {
+	analysis := analyzeTestSource(t, `package main
+
+func Pay(amount int, total int) {
+	count := 0
+	if count > 0 {
+		return
+	}
+	total = 1
+	total = amount
+	count = amount
+	total++
+}
+`)
+	verdicts := list.New()
+	function := findTestFunction(t, analysis.Ast, "Pay")
+	findExchangeableSentences(findFunctionBody(function), findFunctionArguments(function), verdicts)
+	want := []string{
+		"reject: definition of `count`, which is only a source of chains",
+		"accept: RHS is the literal `1`",
+		"accept: RHS reads argument `amount`",
+		"reject: LHS `count` appears in condition at line 5",
+		"accept: `total` appears in no condition in front of it",
+	}
+	got := []string{}
+	for e := verdicts.Front(); e != nil; e = e.Next() {
+		result := "reject: "
+		if e.Value.(*Verdict).Accepted {
+			result = "accept: "
+		}
+		got = append(got, result+explainVerdict(e.Value.(*Verdict), analysis.FileSet, analysis.Source))
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("verdicts =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
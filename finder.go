@@ -1,14 +1,20 @@
-package main
+// Package stcpsce implements the static transaction chopping of smart contract executions: Phase 1 finds the
+// statements of a chaincode which can run in parallel and Phase 2 the arguments which the keys read and written by
+// every function depend on. The program is in `cmd/goast-viewer`, and ReadWriteAnalyzer and ChoppingAnalyzer run the
+// phases as analyzers of `golang.org/x/tools/go/analysis`.
+package stcpsce
 
 import (
 	"bytes"
 	"container/list"
+	"flag"
 	"fmt"
 	"go/ast"
 	"go/parser"
 	"go/token"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 )
@@ -21,15 +27,6 @@ type Ast struct {
 	Children []*Ast            `json:"children"`
 }
 
-// This is a type used to represent the result of the parsing.
-// Used in debugging.
-
-//type Result struct {
-//	*Ast `json:"ast"`
-//	//Source string `json:"source"`
-//	//Dump   string `json:"dump"`
-//}
-
 // @title:	isBasicLabel
 //
 // @description:	This is used to determine if a node is a basic label and I choose `Ident` or `SelectorExpr` as basic
@@ -122,11 +119,13 @@ func addLabelsInConditionStatement(ast *Ast) (labels *list.List) {
 // @return:	bool		If the labels in condition statements are in the left-handed side of assignment statements,
 //return true, otherwise return false.
 //
-func checkLabelsInAssignStatementLeftHandedSide(ast *Ast, labels *list.List) bool {
+// @return:	*Ast		The label in condition statements which is found, or nil.
+//
+func checkLabelsInAssignStatementLeftHandedSide(ast *Ast, labels *list.List) (bool, *Ast) {
 	for x := range ast.Children {
 		for e := labels.Front(); e != nil; e = e.Next() {
 			if astNodeEqual(ast.Children[x], e.Value.(*Ast)) {
-				return true
+				return true, e.Value.(*Ast)
 			}
 		}
 		//Theoretically, we should check the labels in the left-handed side of assignment statements recursively.
@@ -135,7 +134,7 @@ func checkLabelsInAssignStatementLeftHandedSide(ast *Ast, labels *list.List) boo
 		//	return true
 		//}
 	}
-	return false
+	return false, nil
 }
 
 // @title:	checkLabelsInAssignStatementRightHandedSide
@@ -154,20 +153,25 @@ func checkLabelsInAssignStatementLeftHandedSide(ast *Ast, labels *list.List) boo
 // @return:	bool		If the labels in the right-handed side of assignment statements are in the left-handed side of
 //assignment statements, return true, otherwise return false.
 //
-func checkLabelsInAssignStatementRightHandedSide(ast *Ast, functionArguments []*Ast, labels *list.List) bool {
+// @return:	kind int	The kind of the verdict, see `Verdict`.
+//
+// @return:	evidence *Ast	The literal, argument or label which decides the result.
+//
+func checkLabelsInAssignStatementRightHandedSide(ast *Ast, functionArguments []*Ast, labels *list.List) (bool, int, *Ast) {
+	var evidence *Ast
 	for x := range ast.Children {
 		// no need to consider `BasicLit`
 		if strings.Contains(ast.Children[x].Label, "BasicLit") {
-			return false
+			return false, verdictLiteral, ast.Children[x]
 		} else if strings.Contains(ast.Children[x].Label, "*ast.Ident") {
 			for y := range functionArguments {
 				if astNodeEqual(ast.Children[x], functionArguments[y]) {
-					return false
+					return false, verdictArgument, functionArguments[y]
 				}
 			}
 			for e := labels.Front(); e != nil; e = e.Next() {
 				if astNodeEqual(ast.Children[x], e.Value.(*Ast)) {
-					return false
+					return false, verdictDefinedLabel, e.Value.(*Ast)
 				}
 			}
 			// need to investigate the arguments of function calls
@@ -175,24 +179,27 @@ func checkLabelsInAssignStatementRightHandedSide(ast *Ast, functionArguments []*
 			for z := range ast.Children[x].Children[1].Children {
 				for y := range functionArguments {
 					if astNodeEqual(ast.Children[x].Children[1].Children[z], functionArguments[y]) {
-						return false
+						return false, verdictArgument, functionArguments[y]
 					}
 				}
 				for e := labels.Front(); e != nil; e = e.Next() {
 					if astNodeEqual(ast.Children[x].Children[1].Children[z], e.Value.(*Ast)) {
-						return false
+						return false, verdictDefinedLabel, e.Value.(*Ast)
 					}
 				}
-				return true
+				return true, verdictUnknownLabel, ast.Children[x].Children[1].Children[z]
 			}
 		}
+		if evidence == nil {
+			evidence = ast.Children[x]
+		}
 		//Theoretically, we should check the labels in the right-handed side of assignment statements recursively.
 		//But in practice, we only need to check the first level of the right-handed side of assignment statements.
 		//if !checkLabelsInAssignStatementRightHandedSide(ast.Children[x], functionArguments) {
 		//	return false
 		//}
 	}
-	return true
+	return true, verdictUnknownLabel, evidence
 }
 
 // @title:	findLabelsInHalfStatements
@@ -238,10 +245,88 @@ func trimList(labels *list.List) {
 	}
 }
 
+// The kinds of statements which define labels. They share the same semantics in Phase 1:
+// A definition (`:=` or `var`) is never a candidate. Its labels are defined in the function and it starts a chain.
+// An assignment (`=`) is a candidate. In a chain it replaces the labels on its left-handed side by the ones on its
+// right-handed side.
+// An update (`+=` and the other op-assigns, `++`, `--`) is a candidate. It also reads its left-handed side, so in a
+// chain it keeps the labels on its left-handed side and adds the ones on its right-handed side.
+const (
+	statementOther = iota
+	statementDefinition
+	statementAssignment
+	statementUpdate
+)
+
+// @title:	splitStatement
+//
+// @description:	This is used to split a statement which defines labels into its left-handed side and right-handed
+//side. `DeclStmt` with several `ValueSpec` is merged into one statement.
+//
+// @param: 	ast *Ast	The statement.
+//
+// @return:	left *Ast	The node whose children are the left-handed side.
+//
+// @return:	right *Ast	The node whose children are the right-handed side.
+//
+// @return:	kind int	The kind of the statement, `statementOther` if it defines no label.
+//
+func splitStatement(ast *Ast) (left *Ast, right *Ast, kind int) {
+	if strings.Contains(ast.Label, "AssignStmt") {
+		kind = statementUpdate
+		if ast.Attrs["Tok"] == ":=" {
+			kind = statementDefinition
+		} else if ast.Attrs["Tok"] == "=" {
+			kind = statementAssignment
+		}
+		return ast.Children[0], ast.Children[1], kind
+	} else if strings.Contains(ast.Label, "IncDecStmt") {
+		return &Ast{Children: ast.Children[:1]}, &Ast{}, statementUpdate
+	} else if strings.Contains(ast.Label, "DeclStmt") && strings.Contains(ast.Children[0].Label, "Tok: var") {
+		left = &Ast{}
+		right = &Ast{}
+		// A declaration with a comment has its `Doc` before its `Specs`.
+		specs := findChild(ast.Children[0], "Specs").Children
+		for x := range specs {
+			for y := range specs[x].Children {
+				if strings.HasPrefix(specs[x].Children[y].Label, "Names") {
+					left.Children = append(left.Children, specs[x].Children[y].Children...)
+				} else if strings.HasPrefix(specs[x].Children[y].Label, "Values") {
+					right.Children = append(right.Children, specs[x].Children[y].Children...)
+				}
+			}
+		}
+		return left, right, statementDefinition
+	}
+	return nil, nil, statementOther
+}
+
+// @title:	definesLabel
+//
+// @description:	This is used to determine if a label on the left-handed side defines a label which is used later.
+// Defining `a` also defines `a.b` and `a[i]`.
+//
+// @param: 	left *Ast	The label on the left-handed side.
+//
+// @param: 	label *Ast	The label which is used later.
+//
+// @return:	bool		If the label is defined, return true, otherwise return false.
+//
+func definesLabel(left *Ast, label *Ast) bool {
+	if left.Attrs["Name"] == "_" {
+		return false
+	} else if astNodeEqual(left, label) {
+		return true
+	} else if strings.Contains(label.Label, "SelectorExpr") || strings.Contains(label.Label, "IndexExpr") {
+		return strings.Contains(left.Label, "*ast.Ident") && definesLabel(left, label.Children[0])
+	}
+	return false
+}
+
 // @title:	expendKernels
 //
 // @description:	This is used to find all statements relative to the exchangeable sentences.
-// It is like expanding the kernels.
+// It is like expanding the kernels. See `statementDefinition` for how each kind of statement is followed.
 //
 // @auth: 	Songxiao Guo
 //
@@ -249,10 +334,15 @@ func trimList(labels *list.List) {
 //
 // @param: 	kernels []*Ast	List of exchangeable sentences.
 //
+// @param: 	graph *ChainGraph	The graph which the label dependencies between the statements are added to, or nil.
+//
 // @return:	pos []*Ast	List of statements relative to the exchangeable sentences.
 //
-func expendKernels(ast *Ast, kernels []*Ast) (pos []*Ast) {
+func expendKernels(ast *Ast, kernels []*Ast, graph *ChainGraph) (pos []*Ast) {
 	pos = []*Ast{}
+	// readers maps the labels in `tempLabels` to the statements reading them, which the statement defining a label
+	// feeds.
+	readers := map[*Ast][]*Ast{}
 	for kernel := range kernels {
 		var x int
 		// Step 1: find the last statement which can be parallelized.
@@ -261,28 +351,54 @@ func expendKernels(ast *Ast, kernels []*Ast) (pos []*Ast) {
 				break
 			}
 		}
+		// A kernel in a nested block has no statement in front of it at this level.
+		if x < 0 {
+			pos = append(pos, kernels[kernel])
+			continue
+		}
+		left, right, kind := splitStatement(ast.Children[x])
 		tempLabels := list.New()
-		tempLabels.PushBackList(findLabelsInHalfStatements(ast.Children[x].Children[1]))
+		tempLabels.PushBackList(findLabelsInHalfStatements(right))
+		if kind == statementUpdate {
+			tempLabels.PushBackList(findLabelsInHalfStatements(left))
+		}
+		addLabelReaders(tempLabels, tempLabels.Front(), ast.Children[x], readers)
 		trimList(tempLabels)
 		pos = append(pos, ast.Children[x])
 		// Step 2: find the statements which can be parallelized before the last statement.
 		for x--; tempLabels.Len() != 0 && x >= 0; x-- {
-			if strings.Contains(ast.Children[x].Label, "AssignStmt") {
-				flag := false
-				for z := range ast.Children[x].Children[0].Children {
-					for e := tempLabels.Front(); e != nil; e = e.Next() {
-						if astNodeEqual(ast.Children[x].Children[0].Children[z], e.Value.(*Ast)) {
+			left, right, kind = splitStatement(ast.Children[x])
+			if kind == statementOther {
+				continue
+			}
+			flag := false
+			for z := range left.Children {
+				for e := tempLabels.Front(); e != nil; {
+					next := e.Next()
+					if definesLabel(left.Children[z], e.Value.(*Ast)) {
+						graph.addDependencies(ast.Children[x], e.Value.(*Ast), readers[e.Value.(*Ast)])
+						if kind != statementUpdate {
 							tempLabels.Remove(e)
-							flag = true
+						} else {
+							// An update reads the label as well, the statements before it feed it.
+							readers[e.Value.(*Ast)] = []*Ast{ast.Children[x]}
 						}
+						flag = true
 					}
+					e = next
 				}
-				// If flag is true, it means that some new labels are added in the label list.
-				if flag {
-					tempLabels.PushBackList(findLabelsInHalfStatements(ast.Children[x].Children[1]))
-					trimList(tempLabels)
-					pos = append(pos, ast.Children[x])
+			}
+			// If flag is true, it means that some new labels are added in the label list.
+			if flag {
+				added := tempLabels.Back()
+				tempLabels.PushBackList(findLabelsInHalfStatements(right))
+				if added == nil {
+					addLabelReaders(tempLabels, tempLabels.Front(), ast.Children[x], readers)
+				} else {
+					addLabelReaders(tempLabels, added.Next(), ast.Children[x], readers)
 				}
+				trimList(tempLabels)
+				pos = append(pos, ast.Children[x])
 			}
 		}
 	}
@@ -297,26 +413,64 @@ func expendKernels(ast *Ast, kernels []*Ast) (pos []*Ast) {
 //
 // @param: 	ast *Ast	The node which needs to be determined.
 //
+// @param: 	nonChoppable map[string]bool	Set of the names of functions whose exchangeable sentences are dropped.
+//
+// @param: 	verdicts *list.List	List which the verdicts of the candidate statements are appended to, or nil.
+//
+// @param: 	graphs *list.List	List which the dependency graph of the chains of every function is appended to, or nil.
+//
+// @param: 	failures *list.List	List which the diagnostics of the functions failing to be analyzed are appended to, or
+//nil.
+//
 // @return:	posList *list.List	List of exchangeable sentences in the function.
 //
-func analyzeFunctionDeclaration(ast *Ast) (posList *list.List) {
+func analyzeFunctionDeclaration(ast *Ast, nonChoppable map[string]bool, verdicts *list.List,
+	graphs *list.List, failures *list.List) (posList *list.List) {
 	posList = list.New()
 	if strings.Contains(ast.Label, "FuncDecl") {
-		var arguments []*Ast
-		// Step 1: find the arguments of the function.
-		for x := range ast.Children[2].Children[0].Children[0].Children {
-			arguments = append(arguments, ast.Children[2].Children[0].Children[0].Children[x].Children[0].Children[0])
+		// The function is analyzed in isolation, its verdicts, chain and graph are kept only if it does not fail.
+		functionVerdicts := list.New()
+		var pos []*Ast
+		var graph *ChainGraph
+		ok := isolateFunction(ast, "phase 1", failures, func() {
+			// A function declared without a body has no statement.
+			body := findFunctionBody(ast)
+			if body == nil {
+				return
+			}
+			// Step 1: find the arguments of the function.
+			arguments := findLeadingArguments(ast)
+			// Step 2: find the exchangeable sentences in the function.
+			kernels := findExchangeableSentences(ast, arguments, functionVerdicts)
+			name := findFunctionName(ast)
+			for e := functionVerdicts.Front(); e != nil; e = e.Next() {
+				e.Value.(*Verdict).Function = name
+			}
+			// Step 3: expand the kernels.
+			if len(kernels) != 0 && !nonChoppable[name] {
+				if graphs != nil {
+					graph = &ChainGraph{Function: name, Dependencies: []*Dependency{}}
+				}
+				pos = expendKernels(findChild(body, "List"), kernels, graph)
+			}
+		})
+		if !ok {
+			return posList
 		}
-		// Step 2: find the exchangeable sentences in the function.
-		kernels := findExchangeableSentences(ast, arguments)
-		// Step 3: expand the kernels.
-		if len(kernels) != 0 {
-			posList.PushBack(expendKernels(ast.Children[3].Children[0], kernels))
+		if verdicts != nil {
+			verdicts.PushBackList(functionVerdicts)
+		}
+		if pos != nil {
+			posList.PushBack(pos)
+			if graphs != nil {
+				graph.Statements = pos
+				graphs.PushBack(graph)
+			}
 		}
 	} else {
 		// The `else` part is used to link each list of exchangeable sentences in different functions.
 		for x := range ast.Children {
-			posList.PushBackList(analyzeFunctionDeclaration(ast.Children[x]))
+			posList.PushBackList(analyzeFunctionDeclaration(ast.Children[x], nonChoppable, verdicts, graphs, failures))
 		}
 	}
 	return posList
@@ -354,25 +508,37 @@ func addLabelsInLeftValue(ast *Ast) (labels *list.List) {
 //
 // @param: 	functionArguments []*Ast	List of arguments of the function.
 //
+// @param: 	verdicts *list.List	List which the verdicts of the candidate statements are appended to, or nil.
+//
 // @return:	pos []*Ast	List of exchangeable sentences in the function.
 //
-func findExchangeableSentences(ast *Ast, functionArguments []*Ast) (pos []*Ast) {
+func findExchangeableSentences(ast *Ast, functionArguments []*Ast, verdicts *list.List) (pos []*Ast) {
 	pos = []*Ast{}
 	if strings.Contains(ast.Label, "List : []ast.Stmt") {
 		labelsInCondition := list.New()
 		labelsInLeftHandedSide := list.New()
 		for x := range ast.Children {
+			// Closures, deferred calls and goroutines do not run where they are written.
+			pos = append(pos, findNestedClosures(&Ast{Children: ast.Children[x : x+1]}, functionArguments, verdicts)...)
 			// If the statement is `IfStmt`, then we need to find the labels in the condition statement.
 			if strings.Contains(ast.Children[x].Label, "IfStmt") {
 				labelsInCondition.PushBackList(addLabelsInConditionStatement(ast.Children[x]))
+				// A `var` declaration is a definition like `:=`.
+			} else if strings.Contains(ast.Children[x].Label, "DeclStmt") {
+				if left, _, kind := splitStatement(ast.Children[x]); kind == statementDefinition {
+					labelsInLeftHandedSide.PushBackList(addLabelsInLeftValue(left))
+					recordVerdict(verdicts, ast.Children[x], false, verdictDefinition, left)
+				}
 				// If the statement is `IncDecStmt` and the self-increasing or self-decreasing label is not in the
 				//conditions which in front of it, it means that the statement can be parallelized.
 			} else if strings.Contains(ast.Children[x].Label, "IncDecStmt") {
 				for e := labelsInCondition.Front(); e != nil; e = e.Next() {
 					if astNodeEqual(ast.Children[x].Children[0], e.Value.(*Ast)) {
+						recordVerdict(verdicts, ast.Children[x], false, verdictCondition, e.Value.(*Ast))
 						goto A
 					}
 				}
+				recordVerdict(verdicts, ast.Children[x], true, verdictNoCondition, ast.Children[x].Children[0])
 				pos = append(pos, ast.Children[x])
 				// If the statement is `AssignStmt`, then we need to check if the operator is `:=`.
 				// If the operator is `:=`, then we need to find the labels in the left-handed side of assignment statements.
@@ -382,27 +548,48 @@ func findExchangeableSentences(ast *Ast, functionArguments []*Ast) (pos []*Ast)
 			} else if strings.Contains(ast.Children[x].Label, "AssignStmt") {
 				if ast.Children[x].Attrs["Tok"] == ":=" {
 					labelsInLeftHandedSide.PushBackList(addLabelsInLeftValue(ast.Children[x].Children[0]))
+					recordVerdict(verdicts, ast.Children[x], false, verdictDefinition, ast.Children[x].Children[0])
+				} else if found, label := checkLabelsInAssignStatementLeftHandedSide(ast.Children[x].Children[0],
+					labelsInCondition); found {
+					recordVerdict(verdicts, ast.Children[x], false, verdictCondition, label)
 				} else {
-					if !checkLabelsInAssignStatementLeftHandedSide(ast.Children[x].Children[0],
-						labelsInCondition) && !checkLabelsInAssignStatementRightHandedSide(ast.Children[x].
-						Children[1], functionArguments, labelsInLeftHandedSide) {
+					found, kind, evidence := checkLabelsInAssignStatementRightHandedSide(ast.Children[x].Children[1],
+						functionArguments, labelsInLeftHandedSide)
+					recordVerdict(verdicts, ast.Children[x], !found, kind, evidence)
+					if !found {
 						pos = append(pos, ast.Children[x])
 					}
 				}
 			}
 		A: //It is my coding style to use `goto` to break the nested loop.
 		}
+	} else if strings.Contains(ast.Label, "FuncLit") {
+		pos = append(pos, findClosureExchangeableSentences(ast, verdicts)...)
+	} else if strings.Contains(ast.Label, "DeferStmt") || strings.Contains(ast.Label, "GoStmt") {
+		findDetachedExchangeableSentences(ast, functionArguments, verdicts)
 	} else {
 		for x := range ast.Children {
-			pos = append(pos, findExchangeableSentences(ast.Children[x], functionArguments)...)
+			pos = append(pos, findExchangeableSentences(ast.Children[x], functionArguments, verdicts)...)
 		}
 	}
 	return pos
 }
 
+// The APIs of the stub reading and writing the ledger, with the positions of the arguments selecting the entry. The
+// key of private data is the second argument, after the collection.
+var readAPIPositions = map[string][]int{
+	"GetState":       {0},
+	"GetPrivateData": {0, 1},
+}
+var writeAPIPositions = map[string][]int{
+	"PutState":       {0},
+	"PutPrivateData": {0, 1},
+}
+
 // @title:	findGetOrPutStateExpression
 //
-// @description:	This is used to find `GetState` or `PutState` expressions in the function.
+// @description:	This is used to find the positions of the arguments of a call which select the entry read or written
+//by it, when it is a `GetState` or `PutState` expression. The calls in its arguments are not searched.
 //
 // @auth: 	Songxiao Guo
 //
@@ -412,29 +599,60 @@ func findExchangeableSentences(ast *Ast, functionArguments []*Ast) (pos []*Ast)
 //
 // @param: 	isGet bool	If the expression is `GetState`, then `isGet` is true, otherwise `isGet` is false.
 //
-// @return:	ArgumentPosition []int	List of positions of `GetState` or `PutState` expressions in the function.
+// @param: 	spec *APISpec	The APIs added by a spec file, or nil.
 //
-func findGetOrPutStateExpression(ast *Ast, GetOrPutStateMap map[string][]int, isGet bool) (ArgumentPosition []int) {
-	ArgumentPosition = []int{}
-	if strings.Contains(ast.Label, "CallExpr") {
-		if strings.Contains(ast.Children[0].Label, "SelectorExpr") {
-			if isGet {
-				if ast.Children[0].Children[1].Attrs["Name"] == "GetState" {
-					ArgumentPosition = []int{0}
-				}
-			} else {
-				if ast.Children[0].Children[1].Attrs["Name"] == "PutState" {
-					ArgumentPosition = []int{0}
-				}
+// @return:	positions []int	List of positions, empty if the node is not such a call.
+//
+func findGetOrPutStateExpression(ast *Ast, GetOrPutStateMap map[string][]int, isGet bool, spec *APISpec) (
+	positions []int) {
+	positions = []int{}
+	if !strings.Contains(ast.Label, "CallExpr") {
+		return positions
+	}
+	if strings.Contains(ast.Children[0].Label, "SelectorExpr") {
+		positions = append(positions, spec.entryPositions(ast.Children[0].Children[1].Attrs["Name"], isGet)...)
+		// A function of another package is keyed by its qualified name, like `lib.LoadAccount`.
+		if len(positions) == 0 {
+			positions = append(positions, GetOrPutStateMap[ast.Children[0].Children[0].Attrs["Name"]+"."+
+				ast.Children[0].Children[1].Attrs["Name"]]...)
+		}
+	} else {
+		positions = append(positions, GetOrPutStateMap[ast.Children[0].Attrs["Name"]]...)
+	}
+	return positions
+}
+
+// @title:	findGetOrPutStateArguments
+//
+// @description:	This is used to find the arguments of the `GetState` or `PutState` expressions of a statement which
+//select the entries read or written, wherever the calls are in the statement, like in a bare `stub.PutState(k, v)`.
+//
+// @param: 	ast *Ast	The statement.
+//
+// @param: 	GetOrPutStateMap map[string][]int	Map of `GetState` or `PutState` expressions in the function.
+//
+// @param: 	isGet bool	If the expression is `GetState`, then `isGet` is true, otherwise `isGet` is false.
+//
+// @param: 	spec *APISpec	The APIs added by a spec file, or nil.
+//
+// @return:	arguments []*Ast	List of the arguments, the ones of an outer call first.
+//
+func findGetOrPutStateArguments(ast *Ast, GetOrPutStateMap map[string][]int, isGet bool, spec *APISpec) (
+	arguments []*Ast) {
+	arguments = []*Ast{}
+	if positions := findGetOrPutStateExpression(ast, GetOrPutStateMap, isGet, spec); len(positions) != 0 {
+		args := findChild(ast, "Args")
+		for _, position := range positions {
+			// A variadic call may pass fewer arguments than its positions.
+			if args != nil && position < len(args.Children) {
+				arguments = append(arguments, args.Children[position])
 			}
-		} else {
-			ArgumentPosition = GetOrPutStateMap[ast.Children[0].Attrs["Name"]]
 		}
 	}
 	for x := range ast.Children {
-		ArgumentPosition = append(ArgumentPosition, findGetOrPutStateExpression(ast.Children[x], GetOrPutStateMap, isGet)...)
+		arguments = append(arguments, findGetOrPutStateArguments(ast.Children[x], GetOrPutStateMap, isGet, spec)...)
 	}
-	return ArgumentPosition
+	return arguments
 }
 
 // @title:	findGetOrPutStateList
@@ -452,18 +670,19 @@ func findGetOrPutStateExpression(ast *Ast, GetOrPutStateMap map[string][]int, is
 //
 // @param: 	isGet bool	If the expression is `GetState`, then `isGet` is true, otherwise `isGet` is false.
 //
+// @param: 	spec *APISpec	The APIs added by a spec file, or nil.
+//
 // @return:	GetStateList []int	List of positions of `GetState` or `PutState` expressions in the arguments of the
 //function.
 //
-func findGetOrPutStateList(ast *Ast, GetOrPutStateMap map[string][]int, arguments []*Ast, isGet bool) (GetStateList []int) {
+func findGetOrPutStateList(ast *Ast, GetOrPutStateMap map[string][]int, arguments []*Ast, isGet bool,
+	spec *APISpec) (GetStateList []int) {
 	GetStateList = []int{}
-	var argumentsPosition []int
 	tempLabels := list.New()
 	for x := len(ast.Children) - 1; x >= 0; x-- {
-		argumentsPosition = findGetOrPutStateExpression(ast.Children[x], GetOrPutStateMap, isGet)
-		if len(argumentsPosition) != 0 {
-			for y := range argumentsPosition {
-				tempLabels.PushBack(ast.Children[x].Children[len(ast.Children[x].Children)-1].Children[0].Children[1].Children[argumentsPosition[y]])
+		if keys := findGetOrPutStateArguments(ast.Children[x], GetOrPutStateMap, isGet, spec); len(keys) != 0 {
+			for y := range keys {
+				tempLabels.PushBack(keys[y])
 			}
 			trimList(tempLabels)
 		} else if strings.Contains(ast.Children[x].Label, "AssignStmt") {
@@ -511,46 +730,271 @@ func findGetOrPutStateList(ast *Ast, GetOrPutStateMap map[string][]int, argument
 //
 // @param: 	ast *Ast	The node which needs to be determined.
 //
+// @param: 	spec *APISpec	The APIs added by a spec file, or nil.
+//
+// @param: 	failures *list.List	List which the diagnostics of the functions failing to be analyzed are appended to, or
+//nil.
+//
 // @return:	GetStateMap map[string][]int	Map of `GetState` expressions in the function.
 //
 // @return:	PutStateMap map[string][]int	Map of `PutState` expressions in the function.
 //
-func analyzeReadWriteAPI(ast *Ast) (GetStateMap map[string][]int, PutStateMap map[string][]int) {
+func analyzeReadWriteAPI(ast *Ast, spec *APISpec, failures *list.List) (GetStateMap map[string][]int,
+	PutStateMap map[string][]int) {
 	GetStateMap = make(map[string][]int)
 	PutStateMap = make(map[string][]int)
+	updateReadWriteAPI(ast, GetStateMap, PutStateMap, spec, failures)
+	return GetStateMap, PutStateMap
+}
+
+// @title:	updateReadWriteAPI
+//
+// @description:	This is used to update the maps of `GetState` and `PutState` expressions with the functions in a node
+//until they are not changed. The maps may be seeded with the functions of other packages.
+//
+// @param: 	ast *Ast	The node which needs to be determined.
+//
+// @param: 	GetStateMap map[string][]int	Map of `GetState` expressions which is updated.
+//
+// @param: 	PutStateMap map[string][]int	Map of `PutState` expressions which is updated.
+//
+// @param: 	spec *APISpec	The APIs added by a spec file, or nil.
+//
+// @param: 	failures *list.List	List which the diagnostics of the functions failing to be analyzed are appended to, or
+//nil.
+//
+func updateReadWriteAPI(ast *Ast, GetStateMap map[string][]int, PutStateMap map[string][]int, spec *APISpec,
+	failures *list.List) {
+	// A function failing to be analyzed reads and writes no key and is not analyzed again.
+	failed := map[int]bool{}
 	for flag := true; flag; {
 		flag = false
 		for y := range ast.Children {
-			if strings.Contains(ast.Children[y].Label, "FuncDecl") {
-				var arguments []*Ast
-				for x := range ast.Children[y].Children[len(ast.Children[y].Children)-2].Children[0].Children[0].Children {
-					arguments = append(arguments, ast.Children[y].Children[len(ast.Children[y].Children)-2].Children[0].Children[0].Children[x].Children[0].Children[0])
-				}
-				// Here is a complicated logic. I will explain it in detail.
-				// The basic idea is update the `GetStateMap` and `PutStateMap` until they are not changed.
-				// So we need to find the new `GetStateMap` and `PutStateMap` in each iteration.
-				// Then use a `DeepEqual` function to check if the `GetStateMap` and `PutStateMap` are changed.
-				// The code `[len(ast.Children[y].Children)-3]` is used to process some nodes which lack of some children.
-				if !reflect.DeepEqual(GetStateMap[ast.Children[y].Children[len(ast.Children[y].Children)-3].
-					Attrs["Name"]], findGetOrPutStateList(ast.Children[y].Children[len(ast.Children[y].Children)-1].
-					Children[0], GetStateMap, arguments, true)) {
-					GetStateMap[ast.Children[y].Children[len(ast.Children[y].Children)-3].
-						Attrs["Name"]] = findGetOrPutStateList(ast.
-						Children[y].Children[len(ast.Children[y].Children)-1].Children[0], GetStateMap, arguments, true)
+			if strings.Contains(ast.Children[y].Label, "FuncDecl") && !failed[y] {
+				ok := isolateFunction(ast.Children[y], "phase 2", failures, func() {
+					name := findFunctionName(ast.Children[y])
+					arguments := findLeadingArguments(ast.Children[y])
+					// A function declared without a body reads and writes no key.
+					statements := findChild(findFunctionBody(ast.Children[y]), "List")
+					if statements == nil {
+						statements = &Ast{}
+					}
+					// Here is a complicated logic. I will explain it in detail.
+					// The basic idea is update the `GetStateMap` and `PutStateMap` until they are not changed.
+					// So we need to find the new `GetStateMap` and `PutStateMap` in each iteration.
+					// Then use a `DeepEqual` function to check if the `GetStateMap` and `PutStateMap` are changed.
+					if list := findGetOrPutStateList(statements, GetStateMap, arguments, true, spec); !reflect.DeepEqual(
+						GetStateMap[name], list) {
+						GetStateMap[name] = list
+						flag = true
+					}
+					if list := findGetOrPutStateList(statements, GetStateMap, arguments, false, spec); !reflect.DeepEqual(
+						PutStateMap[name], list) {
+						PutStateMap[name] = list
+						flag = true
+					}
+				})
+				if !ok {
+					failed[y] = true
+					GetStateMap[findFunctionName(ast.Children[y])] = []int{}
+					PutStateMap[findFunctionName(ast.Children[y])] = []int{}
 					flag = true
 				}
-				if !reflect.DeepEqual(PutStateMap[ast.Children[y].Children[len(ast.Children[y].Children)-3].
-					Attrs["Name"]], findGetOrPutStateList(ast.Children[y].Children[len(ast.Children[y].Children)-1].
-					Children[0], GetStateMap, arguments, false)) {
-					PutStateMap[ast.Children[y].Children[len(ast.Children[y].Children)-3].
-						Attrs["Name"]] = findGetOrPutStateList(ast.
-						Children[y].Children[len(ast.Children[y].Children)-1].Children[0], GetStateMap, arguments, false)
-					flag = true
+			}
+		}
+	}
+}
+
+// @title:	findFunctionDeclarations
+//
+// @description:	This is used to collect the top-level function declarations of the file.
+//
+// @param: 	ast *Ast	The root node of the file.
+//
+// @return:	functions []*Ast	List of `FuncDecl` nodes in declaration order.
+//
+func findFunctionDeclarations(ast *Ast) (functions []*Ast) {
+	functions = []*Ast{}
+	for x := range ast.Children {
+		if strings.Contains(ast.Children[x].Label, "Decls") {
+			for y := range ast.Children[x].Children {
+				if strings.Contains(ast.Children[x].Children[y].Label, "FuncDecl") {
+					functions = append(functions, ast.Children[x].Children[y])
 				}
 			}
 		}
 	}
-	return GetStateMap, PutStateMap
+	return functions
+}
+
+// @title:	findFunctionName
+//
+// @description:	This is used to get the name of a function declaration.
+//
+// @param: 	ast *Ast	The `FuncDecl` node.
+//
+// @return:	string		The name of the function, or an empty string if it has none.
+//
+func findFunctionName(ast *Ast) string {
+	if name := findChild(ast, "Name"); name != nil {
+		return name.Attrs["Name"]
+	}
+	return ""
+}
+
+// @title:	findFunctionBody
+//
+// @description:	This is used to get the body of a function declaration or a function literal.
+//
+// @param: 	ast *Ast	The `FuncDecl` or `FuncLit` node.
+//
+// @return:	*Ast		The `BlockStmt` node, or nil for a declaration without a body, like
+//`func external(x int) int`.
+//
+func findFunctionBody(ast *Ast) *Ast {
+	return findChild(ast, "Body")
+}
+
+// @title:	isMethodDeclaration
+//
+// @description:	This is used to determine if a function declaration is a method, which has a receiver.
+//
+// @param: 	ast *Ast	The `FuncDecl` node.
+//
+// @return:	bool		If the function has a receiver, return true, otherwise return false.
+//
+func isMethodDeclaration(ast *Ast) bool {
+	return findChild(ast, "Recv") != nil
+}
+
+// @title:	findParameterFields
+//
+// @description:	This is used to get the fields of the parameters of a function declaration or a function literal,
+//one field for parameters declared together like `a, b int`.
+//
+// @param: 	ast *Ast	The `FuncDecl` or `FuncLit` node.
+//
+// @return:	fields []*Ast	List of `Field` nodes.
+//
+func findParameterFields(ast *Ast) (fields []*Ast) {
+	fields = []*Ast{}
+	if params := findChild(findChild(ast, "Type"), "Params"); params != nil {
+		if list := findChild(params, "List"); list != nil {
+			fields = list.Children
+		}
+	}
+	return fields
+}
+
+// @title:	findLeadingArguments
+//
+// @description:	This is used to get the first name of every parameter field of a function, which the positions of
+//Phase 2 index. An unnamed parameter is kept as its field, so the positions of the others do not move.
+//
+// @param: 	ast *Ast	The `FuncDecl` node.
+//
+// @return:	arguments []*Ast	List of `Ident` nodes, or `Field` nodes for unnamed parameters.
+//
+func findLeadingArguments(ast *Ast) (arguments []*Ast) {
+	arguments = []*Ast{}
+	for _, field := range findParameterFields(ast) {
+		if names := findChild(field, "Names"); names != nil && len(names.Children) != 0 {
+			arguments = append(arguments, names.Children[0])
+		} else {
+			arguments = append(arguments, field)
+		}
+	}
+	return arguments
+}
+
+// @title:	findFunctionArguments
+//
+// @description:	This is used to get the names of all parameters of a function declaration, including the ones
+//declared together like `a, b int`.
+//
+// @param: 	ast *Ast	The `FuncDecl` node.
+//
+// @return:	arguments []*Ast	List of `Ident` nodes of the parameters.
+//
+func findFunctionArguments(ast *Ast) (arguments []*Ast) {
+	arguments = []*Ast{}
+	for _, field := range findParameterFields(ast) {
+		if names := findChild(field, "Names"); names != nil {
+			arguments = append(arguments, names.Children...)
+		}
+	}
+	return arguments
+}
+
+// @title:	lineOf
+//
+// @description:	This is used to convert the position stored in a node to a line number.
+//
+// @param: 	fileSet *token.FileSet	The file set which the source code is parsed with.
+//
+// @param: 	pos int		The position stored in `Ast.Pos` or `Ast.End`.
+//
+// @return:	int		The line number of the position.
+//
+func lineOf(fileSet *token.FileSet, pos int) int {
+	return fileSet.Position(token.Pos(pos)).Line
+}
+
+// @title:	sourceText
+//
+// @description:	This is used to get the source code of a node.
+//
+// @param: 	fileSet *token.FileSet	The file set which the source code is parsed with.
+//
+// @param: 	source string	The source code.
+//
+// @param: 	ast *Ast	The node whose source code is needed.
+//
+// @return:	string		The source code between `Ast.Pos` and `Ast.End`, or the node formatted by `formatAst` if the
+//source code is empty, like for an AST read from a dump.
+//
+func sourceText(fileSet *token.FileSet, source string, ast *Ast) string {
+	if source == "" {
+		return formatAst(ast)
+	}
+	return source[fileSet.Position(token.Pos(ast.Pos)).Offset:fileSet.Position(token.Pos(ast.End)).Offset]
+}
+
+// Options
+//
+// @description:	This is used to hold the optional analyses and outputs selected on the command line.
+//
+type Options struct {
+	// DeltaOutput is the file the delta-write rewrite of the source code is written to, empty to disable it.
+	DeltaOutput string
+	// Guards prints the origins of the operands of every condition and the statements each condition blocks.
+	Guards bool
+	// Explain prints the verdict of Phase 1 and its reason for every assignment and self-increasing statement.
+	Explain bool
+	// Conflicts prints the conflict graph of the transactions built from the key templates of Phase 2.
+	Conflicts bool
+	// Summary prints the ordered accesses of every function and whether each key is read then written, written
+	// blindly or only read.
+	Summary bool
+	// Paths prints the paths of every function with their accesses, and the writes made on every path committing the
+	// transaction.
+	Paths bool
+	// Aborts prints the aborts of every transaction and the transactions which require rollback-safe chopping.
+	Aborts bool
+	// Sarif is the file the findings are written to in SARIF, empty to disable it.
+	Sarif string
+	// HTML is the directory the HTML report is written to, empty to disable it.
+	HTML string
+	// Dot is the directory the Graphviz graphs of the chains of Phase 1 are written to, one file per function, empty
+	// to disable it.
+	Dot string
+	// Spec is the JSON file adding APIs reading and writing the ledger, empty if none is added.
+	Spec string
+	// APIs holds the APIs read from Spec, Analyze reads them when it is nil.
+	APIs *APISpec
+	// Chaincodes is the JSON file mapping the names of the chaincodes called by `InvokeChaincode` to their source
+	// code, empty if no chaincode is resolved.
+	Chaincodes string
 }
 
 // Parse
@@ -563,44 +1007,208 @@ func analyzeReadWriteAPI(ast *Ast) (GetStateMap map[string][]int, PutStateMap ma
 //
 // @param: 	source string	The source code which needs to be parsed.
 //
-// @return:	err error	If the source code can be parsed, return nil, otherwise return an error.
+// @param: 	options *Options	The optional analyses and outputs which need to be run.
+//
+// @return:	err error	If the source code can be parsed, return nil, otherwise return an error. The syntax errors are
+//returned as a `scanner.ErrorList` after the well-formed declarations are analyzed.
 //
-func Parse(filename string, source string) (err error) {
+func Parse(filename string, source string, options *Options) (err error) {
 
 	// Create the AST by parsing src.
 	fileSet := token.NewFileSet() // positions are relative to fileSet
-	f, err := parser.ParseFile(fileSet, filename, source, parser.ParseComments)
+	f, syntaxErr := parser.ParseFile(fileSet, filename, source, parser.ParseComments|parser.AllErrors)
+	syntaxErr = removeDuplicateErrors(syntaxErr)
+	if f == nil || !f.Package.IsValid() {
+		return syntaxErr
+	}
+	// The declarations the parser recovers from the syntax errors are skipped, the others are still analyzed.
+	var skipped []*SkippedDeclaration
+	if syntaxErr != nil {
+		skipped = pruneMalformedDeclarations(f, fileSet, syntaxErr)
+	}
 
 	a, err := BuildAst("", f)
 	if err != nil {
 		return err
 	}
+	if err = Analyze(filename, source, fileSet, a, skipped, options); err != nil {
+		return err
+	}
+	return syntaxErr
+}
 
-	posList := analyzeFunctionDeclaration(a)
+// ParseDump
+//
+// @description:	This is used to read the AST of a file from a dump, like the one of `dump-ast`, instead of parsing
+//the source code. The outputs which need the source code cannot be selected.
+//
+// @param: 	filename string	The name of the dump.
+//
+// @param: 	body []byte	The dump.
+//
+// @param: 	options *Options	The optional analyses and outputs which need to be run.
+//
+// @return:	err error	If the dump can be read and matches the schema, return nil, otherwise return an error.
+//
+func ParseDump(filename string, body []byte, options *Options) (err error) {
+	if options.HTML != "" || options.DeltaOutput != "" {
+		return fmt.Errorf("%s: -html and -delta need the source code, not an AST dump", filename)
+	}
+	a, fileSet, err := loadAstDump(filename, body)
+	if err != nil {
+		return err
+	}
+	return Analyze(fileSet.File(token.Pos(a.Pos)).Name(), "", fileSet, a, nil, options)
+}
+
+// Analyze
+//
+// @description:	This is used to run the analyses on the AST of a file and print their results.
+//
+// @param: 	filename string	The name of the file.
+//
+// @param: 	source string	The source code, or an empty string for an AST read from a dump.
+//
+// @param: 	fileSet *token.FileSet	The file set of the AST.
+//
+// @param: 	a *Ast		The root node of the file.
+//
+// @param: 	skipped []*SkippedDeclaration	List of the declarations left out because of syntax errors, or nil.
+//
+// @param: 	options *Options	The optional analyses and outputs which need to be run.
+//
+// @return:	err error	If the outputs can be written, return nil, otherwise return an error.
+//
+func Analyze(filename string, source string, fileSet *token.FileSet, a *Ast, skipped []*SkippedDeclaration,
+	options *Options) (err error) {
+	file := fileSet.File(token.Pos(a.Pos))
+	if options.Spec != "" && options.APIs == nil {
+		if options.APIs, err = loadAPISpec(options.Spec); err != nil {
+			return err
+		}
+	}
+	var verdicts *list.List
+	if options.Explain || options.Sarif != "" {
+		verdicts = list.New()
+	}
+	var graphs *list.List
+	if options.Dot != "" {
+		graphs = list.New()
+	}
+	failures := list.New()
+	GetStateList, PutStateList := analyzeReadWriteAPI(findChild(a, "Decls"), options.APIs, failures)
+	concurrencyDiagnostics, nonChoppable := analyzeConcurrency(a, PutStateList, options.APIs, failures)
+	packageVariables := analyzePackageVariables(a, failures)
+	mergeNonChoppable(nonChoppable, findPackageVariableDependents(packageVariables))
+	posList := analyzeFunctionDeclaration(a, nonChoppable, verdicts, graphs, failures)
 	fmt.Print("Phase 1:\n")
 	for pos := posList.Front(); pos != nil; pos = pos.Next() {
 		fmt.Print("[")
 		for x := range pos.Value.([]*Ast) {
-			fmt.Print(fileSet.File(f.Pos()).Line(fileSet.File(f.Pos()).Pos(pos.Value.([]*Ast)[x].Pos)))
+			fmt.Print(file.Line(file.Pos(pos.Value.([]*Ast)[x].Pos)))
 			fmt.Print(", ")
 		}
 		fmt.Print("\b\b]\n")
 	}
 	fmt.Print("\nPhase2: Read/Write API:\n")
-	GetStateList, PutStateList := analyzeReadWriteAPI(a.Children[1])
 	fmt.Print("GetState:\n")
 	fmt.Print(GetStateList)
 	fmt.Print("\nPutState:\n")
 	fmt.Print(PutStateList)
-	//body, err := json.Marshal(Result{Ast: a})
-	//if err != nil {
-	//	return err
-	//}
-	//err = ioutil.WriteFile("ast.json", body, 0666)
-	//if err != nil {
-	//	return err
-	//}
-
+	if len(skipped) != 0 {
+		fmt.Print("\n\nSkipped declarations:\n")
+		printSkippedDeclarations(skipped, fileSet, os.Stdout)
+	}
+	var chaincodes *chaincodeResolver
+	if options.Chaincodes != "" {
+		chaincodes, err = loadChaincodeConfig(options.Chaincodes)
+		if err != nil {
+			return err
+		}
+	}
+	keyAccesses := analyzeKeyTemplates(a, packageVariables, fileSet, filename, source, chaincodes, options.APIs,
+		failures)
+	printKeyTemplates(keyAccesses, fileSet)
+	printChaincodeErrors(chaincodes)
+	printDiagnostics("Concurrency", concurrencyDiagnostics, fileSet)
+	printPackageVariables(packageVariables, fileSet)
+	nondeterminismDiagnostics := analyzeNondeterminism(a, PutStateList, options.APIs, fileSet, failures)
+	printDiagnostics("Nondeterminism", nondeterminismDiagnostics, fileSet)
+	// The optional analyses run before the failures are printed, so that their failures are printed as well.
+	var summaries []*AccessSummary
+	if options.Summary || options.HTML != "" {
+		summaries = summarizeAccesses(a, GetStateList, PutStateList, options.APIs, keyAccesses, failures)
+	}
+	var accessPaths []*FunctionPaths
+	var aborts []*AbortReport
+	// The paths of the transactions tell which conflicts come only from may-writes.
+	if options.Paths || options.Aborts || options.Conflicts || options.Sarif != "" || options.HTML != "" {
+		accessPaths = analyzeAccessPaths(a, keyAccesses, failures)
+	}
+	if options.Aborts {
+		aborts = analyzeAborts(a, accessPaths, failures)
+	}
+	var edges []*ConflictEdge
+	if options.Conflicts || options.Sarif != "" || options.HTML != "" {
+		edges = analyzeConflicts(a, keyAccesses, accessPaths, failures)
+	}
+	var guards *list.List
+	if options.Guards {
+		guards = analyzeGuards(a, GetStateList, options.APIs, failures)
+	}
+	rewritten, rewrites, planned := source, []*DeltaRewrite{}, []*DeltaAccess{}
+	if options.DeltaOutput != "" {
+		rewritten, rewrites, planned, err = rewriteCommutativeUpdates(a, GetStateList, PutStateList, options.APIs,
+			keyAccesses, fileSet, source, failures)
+		if err != nil {
+			return err
+		}
+	}
+	printDiagnostics("Analysis failures", listDiagnostics(failures), fileSet)
+	if options.Explain {
+		printVerdicts(verdicts, fileSet, source)
+	}
+	if options.Summary {
+		printAccessSummaries(summaries, fileSet)
+	}
+	if options.Paths {
+		printAccessPaths(accessPaths, fileSet)
+	}
+	if options.Aborts {
+		printAborts(aborts, fileSet)
+	}
+	if options.Conflicts {
+		printConflicts(edges, fileSet)
+	}
+	if options.Guards {
+		printGuards(guards, fileSet, source)
+	}
+	if options.Sarif != "" {
+		err = writeSarifLog(buildSarifLog(filename, fileSet, source, posList, verdicts, append(nondeterminismDiagnostics,
+			listDiagnostics(failures)...), edges), options.Sarif)
+		if err != nil {
+			return err
+		}
+	}
+	if options.HTML != "" {
+		err = writeHTMLReport(options.HTML, a, filename, fileSet, source, posList, keyAccesses, summaries, edges)
+		if err != nil {
+			return err
+		}
+	}
+	if options.Dot != "" {
+		err = writeDotGraphs(options.Dot, graphs, fileSet, source)
+		if err != nil {
+			return err
+		}
+	}
+	if options.DeltaOutput != "" {
+		printDeltaRewrites(rewrites, planned, fileSet, source)
+		err = ioutil.WriteFile(options.DeltaOutput, []byte(rewritten), 0666)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -741,24 +1349,60 @@ func Label(prefix string, n interface{}) string {
 	return string(bf.Bytes())
 }
 
-// @title:	main
+// @title:	Main
 //
-// @description:	This is the main function, the main part of the program.
+// @description:	This is the main function, the main part of the program. It is run by `cmd/goast-viewer` once
+//`go vet` is ruled out.
 //
 // @auth: 	Songxiao Guo
 //
-func main() {
-	inputFile := ""
-	if len(os.Args) == 2 {
-		inputFile = os.Args[1]
-	} else {
-		fmt.Println("Example: go run main.go input.txt")
+func Main() {
+	if len(os.Args) == 2 && os.Args[1] == "lsp" {
+		if err := runLanguageServer(os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, "Error", err)
+			os.Exit(exitUsage)
+		}
 		return
 	}
+	if len(os.Args) >= 2 && findCommand(os.Args[1]) != nil {
+		os.Exit(runCommand(findCommand(os.Args[1]), os.Args[2:]))
+	}
+	options := Options{}
+	flag.Usage = func() {
+		printUsage(flag.CommandLine.Output())
+		fmt.Fprintln(flag.CommandLine.Output(), "\nFlags without a command:")
+		flag.PrintDefaults()
+	}
+	flag.StringVar(&options.DeltaOutput, "delta", "", "write the source rewritten with delta records for commutative updates to `file`")
+	flag.BoolVar(&options.Guards, "guards", false, "explain which conditions block which statements")
+	flag.BoolVar(&options.Explain, "explain", false, "explain why each statement is or is not parallelizable")
+	flag.BoolVar(&options.Conflicts, "conflicts", false, "print the conflict graph of the transactions")
+	flag.BoolVar(&options.Summary, "summary", false, "print the ordered accesses of every function with read-modify-write and blind-write keys")
+	flag.BoolVar(&options.Paths, "paths", false, "print the accesses on every path of each function with its must and may writes")
+	flag.BoolVar(&options.Aborts, "aborts", false, "print the aborts of every transaction and whether they may follow a write")
+	flag.StringVar(&options.Sarif, "sarif", "", "write the findings in SARIF 2.1.0 to `file`")
+	flag.StringVar(&options.HTML, "html", "", "write the HTML report with the annotated source to `directory`")
+	flag.StringVar(&options.Dot, "dot", "", "write the Graphviz graph of the chains of every function to `directory`")
+	flag.StringVar(&options.Spec, "spec", "", "add the APIs reading and writing the ledger of the JSON `file`")
+	flag.StringVar(&options.Chaincodes, "chaincodes", "", "resolve InvokeChaincode with the JSON `file` mapping chaincode names to source directories")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(exitUsage)
+	}
+	inputFile := flag.Arg(0)
 	src, err := ioutil.ReadFile(inputFile)
-	source := string(src)
-	err = Parse("foo", source)
 	if err != nil {
-		fmt.Println("Error", err)
+		fmt.Fprintln(os.Stderr, "Error", err)
+		os.Exit(exitUsage)
+	}
+	if filepath.Ext(inputFile) == ".json" {
+		err = ParseDump(inputFile, src, &options)
+	} else {
+		err = Parse(inputFile, string(src), &options)
+	}
+	if err != nil {
+		printSyntaxErrors(err, os.Stderr)
+		os.Exit(exitUsage)
 	}
 }
@@ -0,0 +1,164 @@
+package stcpsce
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestReadWriteAPIBareCall(t *testing.T) {
+	analysis := analyzeTestSource(t, `package main
+
+import "github.com/hyperledger/fabric/core/chaincode/shim"
+
+type SmartContract struct{}
+
+func (s *SmartContract) Set(stub shim.ChaincodeStubInterface, key string, value string) {
+	stub.PutState(key, []byte(value))
+}
+
+func (s *SmartContract) Move(stub shim.ChaincodeStubInterface, from string, to string) error {
+	value, _ := stub.GetState(from)
+	if err := stub.PutState(to, value); err != nil {
+		return err
+	}
+	return nil
+}
+`)
+	if len(analysis.Failures) != 0 {
+		t.Fatalf("failure: %s", analysis.Failures[0].Message)
+	}
+	for name, want := range map[string][]int{"Set": {1}, "Move": {2}} {
+		if got := analysis.PutStateMap[name]; !reflect.DeepEqual(got, want) {
+			t.Errorf("PutStateMap[%s] = %v, want %v", name, got, want)
+		}
+	}
+	if got := analysis.GetStateMap["Move"]; !reflect.DeepEqual(got, []int{1}) {
+		t.Errorf("GetStateMap[Move] = %v, want [1]", got)
+	}
+}
+
+func TestSplitDocumentedDeclaration(t *testing.T) {
+	analysis := analyzeTestSource(t, `package main
+
+import "github.com/hyperledger/fabric/core/chaincode/shim"
+
+type SmartContract struct{}
+
+func (s *SmartContract) Pay(stub shim.ChaincodeStubInterface, account string) {
+	// key is the balance of the account.
+	var key = "balance_" + account
+	stub.PutState(key, []byte("1"))
+}
+`)
+	if len(analysis.Failures) != 0 {
+		t.Fatalf("failure: %s", analysis.Failures[0].Message)
+	}
+	statement := findChild(findFunctionBody(findTestFunction(t, analysis.Ast, "Pay")), "List").Children[0]
+	left, right, kind := splitStatement(statement)
+	if kind != statementDefinition || len(left.Children) != 1 || left.Children[0].Attrs["Name"] != "key" ||
+		len(right.Children) != 1 {
+		t.Fatalf("splitStatement = %v, %v, %d", left, right, kind)
+	}
+	if len(analysis.Accesses) != 1 {
+		t.Fatalf("accesses = %d, want 1", len(analysis.Accesses))
+	}
+	if got := formatKeyAccess(analysis.Accesses[0], formatKeyTemplate); got != `"balance_" + {account}` {
+		t.Errorf("key = %s", got)
+	}
+}
+
+func TestSplitStatementKinds(t *testing.T) {
+	analysis := analyzeTestSource(t, `package main
+
+func Pay(a int, b int) {
+	x, y := a, b
+	x = b
+	x += a
+	x++
+	var z, w = 1, 2
+	var (
+		u = 1
+		v = 2
+	)
+	Pay(x, y)
+	_, _, _, _ = z, w, u, v
+}
+`)
+	statements := findChild(findFunctionBody(findTestFunction(t, analysis.Ast, "Pay")), "List").Children
+	want := []struct {
+		kind  int
+		left  int
+		right int
+	}{
+		{statementDefinition, 2, 2},
+		{statementAssignment, 1, 1},
+		{statementUpdate, 1, 1},
+		{statementUpdate, 1, 0},
+		{statementDefinition, 2, 2},
+		{statementDefinition, 2, 2},
+		{statementOther, 0, 0},
+	}
+	for x := range want {
+		left, right, kind := splitStatement(statements[x])
+		if kind != want[x].kind {
+			t.Errorf("statement %d: kind = %d, want %d", x, kind, want[x].kind)
+			continue
+		}
+		if kind != statementOther && (len(left.Children) != want[x].left || len(right.Children) != want[x].right) {
+			t.Errorf("statement %d: %d = %d, want %d = %d", x, len(left.Children), len(right.Children), want[x].left,
+				want[x].right)
+		}
+	}
+	x := statements[0].Children[0].Children[0]
+	if !definesLabel(x, statements[1].Children[0].Children[0]) {
+		t.Errorf("`x` does not define `x`")
+	}
+	if definesLabel(x, statements[0].Children[0].Children[1]) {
+		t.Errorf("`x` defines `y`")
+	}
+}
+
+func TestDefinitionChains(t *testing.T) {
+	source, err := ioutil.ReadFile("input.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		source string
+		want   map[string][]int
+	}{
+		// The update of the loaded account derives from its definition, and the save from the update.
+		{string(source), map[string][]int{"DepositChecking": {154, 153, 149}, "WriteCheck": {172, 171, 167}}},
+		// A definition, by `:=` or `var`, is only a source: the assignments of `label` and `tag` derive from the
+		// definition of `memo`, the update of `total` from the assignment of `label`, and the update of `count`, which
+		// reads it, from its definition.
+		{`package main
+
+func Pay(note string, total int) {
+	memo := note
+	label := ""
+	label = memo
+	total += len(label)
+	count := 0
+	count++
+	var tag = ""
+	tag = memo
+}
+`, map[string][]int{"Pay": {6, 4, 7, 6, 4, 9, 8, 11, 4}}},
+	} {
+		analysis := analyzeTestSource(t, test.source)
+		got := map[string][]int{}
+		for _, chain := range analysis.Chains {
+			name := findEnclosingFunction(analysis.Ast, chain[0])
+			for _, statement := range chain {
+				got[name] = append(got[name], lineOf(analysis.FileSet, statement.Pos))
+			}
+		}
+		for name, want := range test.want {
+			if !reflect.DeepEqual(got[name], want) {
+				t.Errorf("chain of %s = %v, want %v", name, got[name], want)
+			}
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package stcpsce
+
+import (
+	"container/list"
+	"fmt"
+	"go/token"
+	"strings"
+)
+
+// PackageVariable
+//
+// @description:	This is used to describe a package-level variable and the functions accessing it.
+//
+type PackageVariable struct {
+	Name string
+	// Spec is the `ValueSpec` node declaring the variable.
+	Spec *Ast
+	// Mutated tells if the variable is written at runtime or initialized with a nondeterministic value. A variable
+	// which is not mutated is constant-initialized and can be folded into key templates.
+	Mutated bool
+	Reason  string
+	Readers []string
+	Writers []string
+}
+
+// @title:	findValueSpecValue
+//
+// @description:	This is used to get the value a `ValueSpec` assigns to one of its names.
+//
+// @param: 	ast *Ast	The `ValueSpec` node.
+//
+// @param: 	index int	The position of the name.
+//
+// @return:	value *Ast	The value, or nil if the name is declared without a value.
+//
+func findValueSpecValue(ast *Ast, index int) (value *Ast) {
+	for x := range ast.Children {
+		if strings.HasPrefix(ast.Children[x].Label, "Values") && index < len(ast.Children[x].Children) {
+			return ast.Children[x].Children[index]
+		}
+	}
+	return nil
+}
+
+// @title:	findNondeterministicCall
+//
+// @description:	This is used to find a call of a nondeterministic package in a node.
+//
+// @param: 	ast *Ast	The node which needs to be searched.
+//
+// @param: 	imports map[string]string	Map of package names to import paths.
+//
+// @return:	path string		The import path of the package, or an empty string if there is no such call.
+//
+func findNondeterministicCall(ast *Ast, imports map[string]string) (path string) {
+	if path = nondeterministicCallPath(ast, imports); path != "" {
+		return path
+	}
+	for x := range ast.Children {
+		if path = findNondeterministicCall(ast.Children[x], imports); path != "" {
+			return path
+		}
+	}
+	return ""
+}
+
+// @title:	findPackageVariableReaders
+//
+// @description:	This is used to find the functions reading a package-level variable. A function defining a local
+//variable or a parameter with the same name is skipped.
+//
+// @param: 	ast *Ast	The root node of the file.
+//
+// @param: 	name *Ast	The `Ident` node declaring the variable.
+//
+// @param: 	written map[*Ast]bool	Set of the labels written by assignments, which are not reads.
+//
+// @param: 	failures *list.List	List which the diagnostics of the functions failing to be analyzed are appended to, or
+//nil.
+//
+// @return:	readers []string	List of the names of the functions.
+//
+func findPackageVariableReaders(ast *Ast, name *Ast, written map[*Ast]bool, failures *list.List) (readers []string) {
+	readers = []string{}
+	functions := findFunctionDeclarations(ast)
+	for x := range functions {
+		body := findFunctionBody(functions[x])
+		if body == nil {
+			continue
+		}
+		read := false
+		isolateFunction(functions[x], "package variables", failures, func() {
+			locals := findDefinedLabels(body)
+			arguments := findFunctionArguments(functions[x])
+			for y := range arguments {
+				locals.PushBack(arguments[y])
+			}
+			for e := locals.Front(); e != nil; e = e.Next() {
+				if astNodeEqual(name, e.Value.(*Ast)) {
+					return
+				}
+			}
+			var walk func(node *Ast)
+			walk = func(node *Ast) {
+				if strings.Contains(node.Label, "*ast.Ident") && !written[node] &&
+					!strings.HasPrefix(node.Label, "Sel") && !strings.HasPrefix(node.Label, "Key") &&
+					astNodeEqual(node, name) {
+					read = true
+				}
+				for y := range node.Children {
+					walk(node.Children[y])
+				}
+			}
+			walk(body)
+		})
+		if read {
+			readers = append(readers, findFunctionName(functions[x]))
+		}
+	}
+	return readers
+}
+
+// @title:	analyzePackageVariables
+//
+// @description:	This is used to classify the package-level variables. A variable written by a function, or
+//initialized by a call of a nondeterministic package, is mutated: it carries a dependency between transactions which
+//the ledger does not see. Every other variable is constant-initialized.
+//
+// @param: 	ast *Ast	The root node of the file.
+//
+// @param: 	failures *list.List	List which the diagnostics of the functions failing to be analyzed are appended to, or
+//nil.
+//
+// @return:	variables []*PackageVariable	List of package-level variables in the order of declaration.
+//
+func analyzePackageVariables(ast *Ast, failures *list.List) (variables []*PackageVariable) {
+	variables = []*PackageVariable{}
+	imports := findImports(ast)
+	statements, functions := findMutatedPackageVariables(ast, failures)
+	written := map[*Ast]bool{}
+	for _, assignments := range statements {
+		for x := range assignments {
+			left, _, kind := splitStatement(assignments[x])
+			// An update reads the variable as well.
+			if kind == statementUpdate {
+				continue
+			}
+			for y := range left.Children {
+				written[findRootLabel(left.Children[y])] = true
+			}
+		}
+	}
+	specs := findPackageVariables(ast)
+	for x := range specs {
+		names := findValueSpecNames(specs[x])
+		for y := range names {
+			if names[y].Attrs["Name"] == "_" {
+				continue
+			}
+			variable := &PackageVariable{Name: names[y].Attrs["Name"], Spec: specs[x], Writers: []string{}}
+			assignments := statements[variable.Name]
+			for z := range assignments {
+				writer := functions[assignments[z]]
+				if len(variable.Writers) == 0 || variable.Writers[len(variable.Writers)-1] != writer {
+					variable.Writers = append(variable.Writers, writer)
+				}
+			}
+			variable.Readers = findPackageVariableReaders(ast, names[y], written, failures)
+			if len(assignments) != 0 {
+				variable.Mutated = true
+				variable.Reason = fmt.Sprintf("written by %s", strings.Join(variable.Writers, ", "))
+			} else if value := findValueSpecValue(specs[x], y); value != nil {
+				if path := findNondeterministicCall(value, imports); path != "" {
+					variable.Mutated = true
+					variable.Reason = fmt.Sprintf("initialized by a call of %s", path)
+				}
+			}
+			variables = append(variables, variable)
+		}
+	}
+	return variables
+}
+
+// @title:	findPackageVariableDependents
+//
+// @description:	This is used to find the functions reading or writing a mutated package-level variable. Such a
+//variable is kept by the peer between transactions, outside the read-write set, so these functions are non-choppable.
+//
+// @param: 	variables []*PackageVariable	List of package-level variables.
+//
+// @return:	nonChoppable map[string]bool	Set of the names of non-choppable functions.
+//
+func findPackageVariableDependents(variables []*PackageVariable) (nonChoppable map[string]bool) {
+	nonChoppable = map[string]bool{}
+	for x := range variables {
+		if !variables[x].Mutated {
+			continue
+		}
+		for y := range variables[x].Readers {
+			nonChoppable[variables[x].Readers[y]] = true
+		}
+		for y := range variables[x].Writers {
+			nonChoppable[variables[x].Writers[y]] = true
+		}
+	}
+	return nonChoppable
+}
+
+// @title:	printPackageVariables
+//
+// @description:	This is used to print the classification of the package-level variables. Nothing is printed if
+//there is no package-level variable.
+//
+// @param: 	variables []*PackageVariable	List of package-level variables.
+//
+// @param: 	fileSet *token.FileSet	The file set which the source code is parsed with.
+//
+func printPackageVariables(variables []*PackageVariable, fileSet *token.FileSet) {
+	if len(variables) == 0 {
+		return
+	}
+	fmt.Print("\n\nPackage variables:\n")
+	for x := range variables {
+		class := "constant-initialized"
+		if variables[x].Mutated {
+			class = "mutated at runtime (" + variables[x].Reason + "), its readers and writers are non-choppable"
+		}
+		readers := "no function"
+		if len(variables[x].Readers) != 0 {
+			readers = strings.Join(variables[x].Readers, ", ")
+		}
+		fmt.Printf("%s line %d: %s, read by %s\n", variables[x].Name, lineOf(fileSet, variables[x].Spec.Pos), class,
+			readers)
+	}
+}
+
+// @title:	mergeNonChoppable
+//
+// @description:	This is used to add the non-choppable functions found by another analysis to a set.
+//
+// @param: 	nonChoppable map[string]bool	Set of the names of non-choppable functions.
+//
+// @param: 	others map[string]bool	Set which is added.
+//
+func mergeNonChoppable(nonChoppable map[string]bool, others map[string]bool) {
+	for name := range others {
+		nonChoppable[name] = true
+	}
+}
@@ -0,0 +1,41 @@
+package stcpsce
+
+import (
+	"testing"
+)
+
+func TestAnalyzePackageVariables(t *testing.T) {
+	analysis := analyzeTestSource(t, `package main
+
+import "github.com/hyperledger/fabric/core/chaincode/shim"
+
+type SmartContract struct{}
+
+var prefix = "account_"
+
+var calls int
+
+func (s *SmartContract) Open(stub shim.ChaincodeStubInterface, args []string) {
+	calls++
+	stub.PutState(prefix+args[0], []byte("1"))
+}
+
+func (s *SmartContract) Query(stub shim.ChaincodeStubInterface, args []string) {
+	stub.GetState(prefix + args[0])
+}
+`)
+	variables := map[string]*PackageVariable{}
+	for _, variable := range analysis.PackageVariables {
+		variables[variable.Name] = variable
+	}
+	if prefix := variables["prefix"]; prefix == nil || prefix.Mutated || len(prefix.Readers) != 2 {
+		t.Errorf("prefix = %+v, want constant-initialized and read by Open and Query", prefix)
+	}
+	if calls := variables["calls"]; calls == nil || !calls.Mutated || len(calls.Writers) != 1 ||
+		calls.Writers[0] != "Open" {
+		t.Errorf("calls = %+v, want mutated by Open", calls)
+	}
+	if !analysis.NonChoppable["Open"] || analysis.NonChoppable["Query"] {
+		t.Errorf("non-choppable = %v, want Open only", analysis.NonChoppable)
+	}
+}
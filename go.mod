@@ -1,3 +1,5 @@
 module github.com/yuroyoro/goast-viewer
 
 go 1.12
+
+require golang.org/x/tools v0.1.12
@@ -0,0 +1,392 @@
+package stcpsce
+
+import (
+	"container/list"
+	"fmt"
+	"go/token"
+	"strings"
+)
+
+// The origins of a value. A value computed from several origins has all their bits set, except that `originConstant`
+// is only kept when nothing else contributes.
+const (
+	originConstant = 1 << iota
+	originArgument
+	originState
+)
+
+// Guard
+//
+// @description:	This is used to describe a condition statement, where its operands come from and which candidate
+//statements of Phase 1 it blocks.
+//
+type Guard struct {
+	Function  string
+	Statement *Ast
+	Condition *Ast
+	Operands  []*Ast
+	Origins   []int
+	Sources   []*Ast
+	Blocked   []*Ast
+	Blockers  []*Ast
+}
+
+// @title:	originName
+//
+// @description:	This is used to print an origin.
+//
+// @param: 	origin int	The origin.
+//
+// @return:	string		The name of the origin.
+//
+func originName(origin int) string {
+	names := []string{}
+	if origin&originConstant != 0 {
+		names = append(names, "constant")
+	}
+	if origin&originArgument != 0 {
+		names = append(names, "argument-derived")
+	}
+	if origin&originState != 0 {
+		names = append(names, "state-derived")
+	}
+	if len(names) == 0 {
+		return "unknown"
+	}
+	return strings.Join(names, ", ")
+}
+
+// @title:	combineOrigins
+//
+// @description:	This is used to combine the origins of two operands of an expression.
+//
+// @param: 	origin1 int	The first origin.
+//
+// @param: 	origin2 int	The second origin.
+//
+// @return:	int		The combined origin.
+//
+func combineOrigins(origin1 int, origin2 int) int {
+	origin := origin1 | origin2
+	if origin&^originConstant != 0 {
+		origin &^= originConstant
+	}
+	return origin
+}
+
+// @title:	isStateReadingCall
+//
+// @description:	This is used to determine if a call reads the ledger, either by `GetState` or `GetPrivateData` itself or
+//through a function in `GetStateMap`.
+//
+// @param: 	ast *Ast	The `CallExpr` node.
+//
+// @param: 	GetStateMap map[string][]int	Map of `GetState` expressions in the function.
+//
+// @param: 	spec *APISpec	The APIs added by a spec file, or nil.
+//
+// @return:	bool		If the call reads the ledger, return true, otherwise return false.
+//
+func isStateReadingCall(ast *Ast, GetStateMap map[string][]int, spec *APISpec) bool {
+	if strings.Contains(ast.Children[0].Label, "SelectorExpr") {
+		return len(spec.entryPositions(ast.Children[0].Children[1].Attrs["Name"], true)) != 0
+	}
+	return len(GetStateMap[ast.Children[0].Attrs["Name"]]) != 0
+}
+
+// @title:	findExpressionOrigin
+//
+// @description:	This is used to find where the value of an expression comes from.
+// Literals and constants are constant, parameters are argument-derived, calls reading the ledger are state-derived,
+// variables have the origin of their last assignment and everything else combines its operands.
+//
+// @param: 	ast *Ast	The expression.
+//
+// @param: 	origins map[string]int	Map of the origins of the variables assigned so far.
+//
+// @param: 	functionArguments []*Ast	List of arguments of the function.
+//
+// @param: 	GetStateMap map[string][]int	Map of `GetState` expressions in the function.
+//
+// @param: 	spec *APISpec	The APIs added by a spec file, or nil.
+//
+// @return:	origin int	The origin of the expression.
+//
+func findExpressionOrigin(ast *Ast, origins map[string]int, functionArguments []*Ast, GetStateMap map[string][]int,
+	spec *APISpec) (origin int) {
+	if strings.Contains(ast.Label, "BasicLit") {
+		return originConstant
+	} else if strings.Contains(ast.Label, "*ast.Ident") {
+		if o, ok := origins[ast.Attrs["Name"]]; ok {
+			return o
+		}
+		for x := range functionArguments {
+			if astNodeEqual(ast, functionArguments[x]) {
+				return originArgument
+			}
+		}
+		if ast.Attrs["Name"] == "nil" || ast.Attrs["Name"] == "true" || ast.Attrs["Name"] == "false" {
+			return originConstant
+		}
+		for x := range ast.Children {
+			if strings.Contains(ast.Children[x].Label, "Kind: const") {
+				return originConstant
+			}
+		}
+		return 0
+	} else if strings.Contains(ast.Label, "CallExpr") {
+		if isStateReadingCall(ast, GetStateMap, spec) {
+			return originState
+		}
+		// The receiver of a method call is an operand, a package name has no origin.
+		if strings.Contains(ast.Children[0].Label, "SelectorExpr") {
+			origin = findExpressionOrigin(ast.Children[0].Children[0], origins, functionArguments, GetStateMap, spec)
+		}
+		for x := range ast.Children[1].Children {
+			origin = combineOrigins(origin, findExpressionOrigin(ast.Children[1].Children[x], origins,
+				functionArguments, GetStateMap, spec))
+		}
+		return origin
+	}
+	for x := range ast.Children {
+		// The selected field, the key of a composite literal and the type of an expression are not operands.
+		if strings.HasPrefix(ast.Children[x].Label, "Sel :") || strings.HasPrefix(ast.Children[x].Label, "Key :") ||
+			strings.HasPrefix(ast.Children[x].Label, "Type :") || strings.HasPrefix(ast.Children[x].Label, "Obj :") {
+			continue
+		}
+		origin = combineOrigins(origin, findExpressionOrigin(ast.Children[x], origins, functionArguments, GetStateMap, spec))
+	}
+	return origin
+}
+
+// @title:	findConditionOperands
+//
+// @description:	This is used to find the operands of a condition, that is its labels and literals.
+//
+// @param: 	ast *Ast	The condition.
+//
+// @return:	operands *list.List	List of operands of the condition.
+//
+func findConditionOperands(ast *Ast) (operands *list.List) {
+	operands = list.New()
+	if isBasicLabel(ast) || strings.Contains(ast.Label, "BasicLit") {
+		operands.PushBack(ast)
+		return operands
+	}
+	for x := range ast.Children {
+		if strings.Contains(ast.Children[x].Label, "Fun") {
+			continue
+		}
+		operands.PushBackList(findConditionOperands(ast.Children[x]))
+	}
+	return operands
+}
+
+// @title:	traceOrigins
+//
+// @description:	This is used to walk the statements of a function in order, keep the origin of every assigned
+//variable up to date and classify the operands of each condition statement when it is reached.
+//
+// @param: 	ast *Ast	The node which needs to be walked.
+//
+// @param: 	origins map[string]int	Map of the origins of the variables assigned so far.
+//
+// @param: 	sources map[string]*Ast	Map of the statements which assigned the variables last.
+//
+// @param: 	functionArguments []*Ast	List of arguments of the function.
+//
+// @param: 	GetStateMap map[string][]int	Map of `GetState` expressions in the function.
+//
+// @param: 	spec *APISpec	The APIs added by a spec file, or nil.
+//
+// @param: 	guards *list.List	List of guards which the condition statements are appended to.
+//
+func traceOrigins(ast *Ast, origins map[string]int, sources map[string]*Ast, functionArguments []*Ast,
+	GetStateMap map[string][]int, spec *APISpec, guards *list.List) {
+	// A closure or a goroutine does not run where it is written, so its assignments are not followed.
+	if strings.Contains(ast.Label, "FuncLit") {
+		return
+	}
+	if left, right, kind := splitStatement(ast); kind != statementOther {
+		origin := 0
+		for x := range right.Children {
+			origin = combineOrigins(origin, findExpressionOrigin(right.Children[x], origins, functionArguments,
+				GetStateMap, spec))
+		}
+		// A declaration without value has the zero value.
+		if len(right.Children) == 0 && kind == statementDefinition {
+			origin = originConstant
+		}
+		for x := range left.Children {
+			root := findRootLabel(left.Children[x])
+			if root == nil || root.Attrs["Name"] == "_" {
+				continue
+			}
+			// An update like `x += y` or a field assignment keeps what the variable already had.
+			if kind == statementUpdate || root != left.Children[x] {
+				origins[root.Attrs["Name"]] = combineOrigins(origins[root.Attrs["Name"]], origin)
+			} else {
+				origins[root.Attrs["Name"]] = origin
+			}
+			sources[root.Attrs["Name"]] = ast
+		}
+		return
+	} else if strings.Contains(ast.Label, "IfStmt") {
+		for x := range ast.Children {
+			if strings.Contains(ast.Children[x].Label, "Init") {
+				traceOrigins(ast.Children[x], origins, sources, functionArguments, GetStateMap, spec, guards)
+			}
+		}
+		for x := range ast.Children {
+			if !strings.Contains(ast.Children[x].Label, "Cond") {
+				continue
+			}
+			guard := &Guard{Statement: ast, Condition: ast.Children[x]}
+			operands := findConditionOperands(ast.Children[x])
+			trimList(operands)
+			for e := operands.Front(); e != nil; e = e.Next() {
+				operand := e.Value.(*Ast)
+				guard.Operands = append(guard.Operands, operand)
+				guard.Origins = append(guard.Origins, findExpressionOrigin(operand, origins, functionArguments, GetStateMap, spec))
+				var source *Ast
+				if root := findRootLabel(operand); root != nil {
+					source = sources[root.Attrs["Name"]]
+				}
+				guard.Sources = append(guard.Sources, source)
+			}
+			guards.PushBack(guard)
+		}
+		for x := range ast.Children {
+			if !strings.Contains(ast.Children[x].Label, "Init") && !strings.Contains(ast.Children[x].Label, "Cond") {
+				traceOrigins(ast.Children[x], origins, sources, functionArguments, GetStateMap, spec, guards)
+			}
+		}
+		return
+	}
+	for x := range ast.Children {
+		traceOrigins(ast.Children[x], origins, sources, functionArguments, GetStateMap, spec, guards)
+	}
+}
+
+// @title:	findBlockedStatements
+//
+// @description:	This is used to find the candidate statements which are rejected in Phase 1 because their
+//left-handed side appears in a condition statement in front of them, the same way as `findExchangeableSentences`.
+//
+// @param: 	ast *Ast	The node which needs to be determined.
+//
+// @param: 	guards *list.List	List of guards of the function.
+//
+func findBlockedStatements(ast *Ast, guards *list.List) {
+	if !strings.Contains(ast.Label, "List : []ast.Stmt") {
+		for x := range ast.Children {
+			findBlockedStatements(ast.Children[x], guards)
+		}
+		return
+	}
+	active := []*Guard{}
+	for x := range ast.Children {
+		statement := ast.Children[x]
+		if strings.Contains(statement.Label, "IfStmt") {
+			for e := guards.Front(); e != nil; e = e.Next() {
+				if e.Value.(*Guard).Statement == statement {
+					active = append(active, e.Value.(*Guard))
+				}
+			}
+		}
+		var targets []*Ast
+		if strings.Contains(statement.Label, "IncDecStmt") {
+			targets = statement.Children[:1]
+		} else if strings.Contains(statement.Label, "AssignStmt") && statement.Attrs["Tok"] != ":=" {
+			targets = statement.Children[0].Children
+		}
+		for y := range active {
+			// Only the labels of the condition and its initialization block, not the ones of the branches.
+			labels := list.New()
+			for _, child := range active[y].Statement.Children {
+				if strings.Contains(child.Label, "Init") || strings.Contains(child.Label, "Cond") {
+					labels.PushBackList(addLabelsInConditionStatement(&Ast{Children: []*Ast{child}}))
+				}
+			}
+			found := false
+			for z := range targets {
+				for e := labels.Front(); e != nil && !found; e = e.Next() {
+					if astNodeEqual(targets[z], e.Value.(*Ast)) {
+						active[y].Blocked = append(active[y].Blocked, statement)
+						active[y].Blockers = append(active[y].Blockers, e.Value.(*Ast))
+						found = true
+					}
+				}
+			}
+		}
+		findBlockedStatements(statement, guards)
+	}
+}
+
+// @title:	analyzeGuards
+//
+// @description:	This is used to classify the operands of every condition statement of every function as constant,
+//argument-derived or state-derived, and to find the candidate statements each of them blocks.
+//
+// @param: 	ast *Ast	The root node of the file.
+//
+// @param: 	GetStateMap map[string][]int	Map of `GetState` expressions in the function.
+//
+// @param: 	spec *APISpec	The APIs added by a spec file, or nil.
+//
+// @param: 	failures *list.List	List which the diagnostics of the functions failing to be analyzed are appended to, or
+//nil.
+//
+// @return:	guards *list.List	List of guards of all functions.
+//
+func analyzeGuards(ast *Ast, GetStateMap map[string][]int, spec *APISpec, failures *list.List) (guards *list.List) {
+	guards = list.New()
+	functions := findFunctionDeclarations(ast)
+	for x := range functions {
+		body := findFunctionBody(functions[x])
+		if body == nil {
+			continue
+		}
+		isolateFunction(functions[x], "guards", failures, func() {
+			functionGuards := list.New()
+			traceOrigins(body, map[string]int{}, map[string]*Ast{}, findFunctionArguments(functions[x]), GetStateMap, spec,
+				functionGuards)
+			findBlockedStatements(body, functionGuards)
+			for e := functionGuards.Front(); e != nil; e = e.Next() {
+				e.Value.(*Guard).Function = findFunctionName(functions[x])
+			}
+			guards.PushBackList(functionGuards)
+		})
+	}
+	return guards
+}
+
+// @title:	printGuards
+//
+// @description:	This is used to print the guards, the origins of their operands and the statements they block.
+//
+// @param: 	guards *list.List	List of guards.
+//
+// @param: 	fileSet *token.FileSet	The file set which the source code is parsed with.
+//
+// @param: 	source string	The source code.
+//
+func printGuards(guards *list.List, fileSet *token.FileSet, source string) {
+	fmt.Print("\n\nGuards:\n")
+	for e := guards.Front(); e != nil; e = e.Next() {
+		guard := e.Value.(*Guard)
+		fmt.Printf("%s line %d: `%s`\n", guard.Function, lineOf(fileSet, guard.Condition.Pos),
+			sourceText(fileSet, source, guard.Condition))
+		for x := range guard.Operands {
+			fmt.Printf("\t`%s`: %s", sourceText(fileSet, source, guard.Operands[x]), originName(guard.Origins[x]))
+			if guard.Sources[x] != nil {
+				fmt.Printf(" (line %d)", lineOf(fileSet, guard.Sources[x].Pos))
+			}
+			fmt.Print("\n")
+		}
+		for x := range guard.Blocked {
+			fmt.Printf("\tblocks line %d `%s` through `%s`\n", lineOf(fileSet, guard.Blocked[x].Pos),
+				sourceText(fileSet, source, guard.Blocked[x]), sourceText(fileSet, source, guard.Blockers[x]))
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package stcpsce
+
+import (
+	"testing"
+)
+
+func TestGuardOrigins(t *testing.T) {
+	analysis := analyzeTestSource(t, `package main
+
+func Pay(count int, total int) {
+	c := count
+	go func() {
+		c = 1
+	}()
+	if c > 0 {
+		total = 2
+	}
+	total = 3
+}
+`)
+	guards := analyzeGuards(analysis.Ast, analysis.GetStateMap, nil, nil)
+	if guards.Len() != 1 {
+		t.Fatalf("guards = %d, want 1", guards.Len())
+	}
+	guard := guards.Front().Value.(*Guard)
+	if len(guard.Origins) != 2 || guard.Origins[0] != originArgument {
+		t.Fatalf("origins of `c > 0` = %v, want the argument only for `c`", guard.Origins)
+	}
+	if guard.Sources[0] == nil || lineOf(analysis.FileSet, guard.Sources[0].Pos) != 4 {
+		t.Errorf("source of `c` is not its definition at line 4")
+	}
+	if len(guard.Blocked) != 0 {
+		t.Errorf("the guard blocks line %d through a label of its branch", lineOf(analysis.FileSet, guard.Blocked[0].Pos))
+	}
+}
+
+func TestGuardBlocksStateOperand(t *testing.T) {
+	analysis := analyzeTestSource(t, `package main
+
+import "github.com/hyperledger/fabric/core/chaincode/shim"
+
+type SmartContract struct{}
+
+func (s *SmartContract) Pay(stub shim.ChaincodeStubInterface, args []string) {
+	balance, _ := stub.GetState(args[0])
+	if balance != nil {
+		return
+	}
+	balance = []byte(args[1])
+	stub.PutState(args[0], balance)
+}
+`)
+	guards := analyzeGuards(analysis.Ast, analysis.GetStateMap, nil, nil)
+	if guards.Len() != 1 {
+		t.Fatalf("guards = %d, want 1", guards.Len())
+	}
+	guard := guards.Front().Value.(*Guard)
+	if guard.Function != "Pay" || len(guard.Origins) == 0 || guard.Origins[0] != originState {
+		t.Errorf("origins of `balance` in %s = %v, want the state", guard.Function, guard.Origins)
+	}
+	if len(guard.Blocked) != 1 || lineOf(analysis.FileSet, guard.Blocked[0].Pos) != 12 {
+		t.Errorf("blocked = %d, want the assignment at line 12", len(guard.Blocked))
+	}
+}
@@ -0,0 +1,47 @@
+package stcpsce
+
+import (
+	"testing"
+)
+
+// @title:	analyzeTestSource
+//
+// @description:	This is used to parse and analyze the source code of a test, failing the test on a syntax error.
+//
+// @param: 	t *testing.T	The test.
+//
+// @param: 	source string	The source code.
+//
+// @return:	*Analysis	The results.
+//
+func analyzeTestSource(t *testing.T, source string) *Analysis {
+	t.Helper()
+	analysis, err := analyzeSource("test.go", source, nil, nil)
+	if err != nil {
+		t.Fatalf("analyzeSource: %v", err)
+	}
+	return analysis
+}
+
+// @title:	findTestFunction
+//
+// @description:	This is used to find the declaration of a function of the AST of a test by its name.
+//
+// @param: 	t *testing.T	The test.
+//
+// @param: 	a *Ast		The root node of the file.
+//
+// @param: 	name string	The name of the function.
+//
+// @return:	*Ast		The `FuncDecl` node.
+//
+func findTestFunction(t *testing.T, a *Ast, name string) *Ast {
+	t.Helper()
+	for _, function := range findFunctionDeclarations(a) {
+		if findFunctionName(function) == name {
+			return function
+		}
+	}
+	t.Fatalf("function %s not found", name)
+	return nil
+}
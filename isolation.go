@@ -0,0 +1,62 @@
+package stcpsce
+
+import (
+	"container/list"
+	"fmt"
+	"strings"
+)
+
+// @title:	isolateFunction
+//
+// @description:	This is used to run an analysis of a function in isolation. A panic of the analysis, like an index
+//out of range on a shape of the source code it does not expect, is recovered and recorded as a diagnostic of the
+//function, so the other functions are still analyzed. A function failing the same analysis again is recorded once.
+//
+// @param: 	function *Ast	The `FuncDecl` node.
+//
+// @param: 	phase string	The name of the analysis, like `phase 2`.
+//
+// @param: 	failures *list.List	List which the diagnostic of a failure is appended to, or nil.
+//
+// @param: 	analyze func()	The analysis.
+//
+// @return:	ok bool		If the analysis does not panic, return true, otherwise return false.
+//
+func isolateFunction(function *Ast, phase string, failures *list.List, analyze func()) (ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			ok = false
+			if failures == nil {
+				return
+			}
+			name := findFunctionName(function)
+			prefix := fmt.Sprintf("analysis failed for function %s: %s: ", name, phase)
+			for e := failures.Front(); e != nil; e = e.Next() {
+				if failure := e.Value.(*Diagnostic); failure.Pos == function.Pos &&
+					strings.HasPrefix(failure.Message, prefix) {
+					return
+				}
+			}
+			failures.PushBack(&Diagnostic{Rule: "analysis-failed", Function: name, Pos: function.Pos,
+				End: function.End, Message: fmt.Sprintf("%s%v", prefix, r)})
+		}
+	}()
+	analyze()
+	return true
+}
+
+// @title:	listDiagnostics
+//
+// @description:	This is used to convert a list of diagnostics to a slice.
+//
+// @param: 	diagnostics *list.List	List of diagnostics.
+//
+// @return:	result []*Diagnostic	The diagnostics in the order of the list.
+//
+func listDiagnostics(diagnostics *list.List) (result []*Diagnostic) {
+	result = []*Diagnostic{}
+	for e := diagnostics.Front(); e != nil; e = e.Next() {
+		result = append(result, e.Value.(*Diagnostic))
+	}
+	return result
+}
@@ -0,0 +1,117 @@
+package stcpsce
+
+import (
+	"container/list"
+	"strings"
+	"testing"
+)
+
+const bodylessSource = `package main
+
+import "github.com/hyperledger/fabric/core/chaincode/shim"
+
+type SmartContract struct{}
+
+func external(x int) int
+
+func (s *SmartContract) Query(stub shim.ChaincodeStubInterface, args []string) error {
+	value, err := stub.GetState(args[0])
+	if err != nil {
+		return err
+	}
+	_ = value
+	return nil
+}
+`
+
+func TestBodylessFunction(t *testing.T) {
+	analysis := analyzeTestSource(t, bodylessSource)
+	if len(analysis.Failures) != 0 {
+		t.Fatalf("failures = %v, want none", analysis.Failures[0].Message)
+	}
+	external := findTestFunction(t, analysis.Ast, "external")
+	if findFunctionBody(external) != nil {
+		t.Errorf("external has a body")
+	}
+	if got := findFunctionArguments(external); len(got) != 1 || got[0].Attrs["Name"] != "x" {
+		t.Errorf("arguments of external = %v, want [x]", got)
+	}
+	if got := analysis.GetStateMap["Query"]; len(got) != 1 || got[0] != 1 {
+		t.Errorf("GetStateMap[Query] = %v, want [1]", got)
+	}
+	if len(analysis.Accesses) != 1 || analysis.Accesses[0].Function != "Query" {
+		t.Errorf("accesses = %v, want the GetState of Query", analysis.Accesses)
+	}
+	if len(analysis.Paths) != 1 || analysis.Paths[0].Function != "Query" {
+		t.Errorf("paths = %v, want the paths of Query", analysis.Paths)
+	}
+	for _, run := range []func() error{
+		func() error {
+			_, err := runPhase1Command(analysis, &CommandOptions{}, &strings.Builder{})
+			return err
+		},
+		func() error {
+			_, err := runDumpAstCommand(analysis, &CommandOptions{}, &strings.Builder{})
+			return err
+		},
+	} {
+		if err := run(); err != nil {
+			t.Errorf("command: %v", err)
+		}
+	}
+	guards := analyzeGuards(analysis.Ast, analysis.GetStateMap, nil, nil)
+	if guards.Len() != 1 {
+		t.Errorf("guards = %d, want 1", guards.Len())
+	}
+	if rewritten, _, _, err := rewriteCommutativeUpdates(analysis.Ast, analysis.GetStateMap, analysis.PutStateMap,
+		nil, analysis.Accesses, analysis.FileSet, analysis.Source, nil); err != nil || rewritten != bodylessSource {
+		t.Errorf("the source is rewritten")
+	}
+}
+
+func TestParseOnly(t *testing.T) {
+	analysis, err := parseSource("test.go", bodylessSource)
+	if err != nil {
+		t.Fatalf("parseSource: %v", err)
+	}
+	if analysis.GetStateMap != nil || analysis.Accesses != nil {
+		t.Errorf("parseSource analyzes the source")
+	}
+	output := &strings.Builder{}
+	if _, err = runDumpAstCommand(analysis, &CommandOptions{}, output); err != nil {
+		t.Fatalf("dump-ast: %v", err)
+	}
+	if _, _, err = loadAstDump("test.json", []byte(output.String())); err != nil {
+		t.Errorf("the dump of a body-less function is rejected: %v", err)
+	}
+}
+
+func TestIsolateFunction(t *testing.T) {
+	function := findTestFunction(t, analyzeTestSource(t, bodylessSource).Ast, "Query")
+	failures := list.New()
+	for x := 0; x < 2; x++ {
+		if isolateFunction(function, "test", failures, func() {
+			panic("boom")
+		}) {
+			t.Errorf("a panic is not reported")
+		}
+	}
+	if !isolateFunction(function, "test", failures, func() {}) {
+		t.Errorf("a function which does not panic fails")
+	}
+	isolateFunction(function, "other", failures, func() {
+		panic("boom")
+	})
+	diagnostics := listDiagnostics(failures)
+	if len(diagnostics) != 2 {
+		t.Fatalf("failures = %d, want one for each analysis", len(diagnostics))
+	}
+	if diagnostics[0].Function != "Query" || diagnostics[0].Message != "analysis failed for function Query: test: boom" {
+		t.Errorf("failure = %s %q", diagnostics[0].Function, diagnostics[0].Message)
+	}
+	if isolateFunction(function, "test", nil, func() {
+		panic("boom")
+	}) {
+		t.Errorf("a panic is not reported without a list of failures")
+	}
+}
@@ -0,0 +1,1442 @@
+package stcpsce
+
+import (
+	"container/list"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"go/token"
+	"hash"
+	"strconv"
+	"strings"
+)
+
+// KeySegment
+//
+// @description:	This is used to describe a part of a key, either a constant folded at analysis time or a hole whose
+//value is only known when the transaction runs.
+//
+type KeySegment struct {
+	// Constant is the folded text of the segment, empty for a hole.
+	Constant string
+	// Hole describes the expression of a hole, empty for a constant.
+	Hole string
+	// Length is the length of a hole, or -1 if it is unknown.
+	Length int
+}
+
+// KeyTemplate
+//
+// @description:	This is used to describe the keys an expression can evaluate to, as a concatenation of segments.
+//
+type KeyTemplate struct {
+	Segments []*KeySegment
+	// ObjectType and Attributes are set for a key created by `CreateCompositeKey`.
+	ObjectType *KeyTemplate
+	Attributes []*KeyTemplate
+}
+
+// KeyAccess
+//
+// @description:	This is used to describe a call of the ledger API and the template of the key it accesses.
+//
+type KeyAccess struct {
+	Function string
+	// Site is the call in the function, either of the API itself or of the function leading to it.
+	Site *Ast
+	// Via lists the functions between the site and the call of the API, outermost first.
+	Via []string
+	API string
+	// Write tells if the API writes the key, every other access reads it.
+	Write bool
+	Key   *KeyTemplate
+	// Partial tells if the key is a prefix, the access reads every key starting with it.
+	Partial bool
+	// Chaincode is the name of the chaincode called by `InvokeChaincode` which the key belongs to, empty for this one.
+	Chaincode string
+	// Collection is the private data collection of the key, nil for the world state.
+	Collection *KeyTemplate
+	// End is set for a range read, the access reads every key from `Key` up to `End` excluded. An empty template
+	// means there is no bound.
+	End *KeyTemplate
+}
+
+// foldHash holds a hash being computed at analysis time, it is tainted once a hole is written to it.
+type foldHash struct {
+	hash    hash.Hash
+	tainted bool
+}
+
+// foldSlice holds the values of a slice, like the attributes of a composite key.
+type foldSlice []interface{}
+
+// foldFrame holds the values of the labels of the function being interpreted and the accesses found in it.
+type foldFrame struct {
+	env      map[string]interface{}
+	accesses []*KeyAccess
+}
+
+// foldScope holds what the interpretation of every function shares.
+type foldScope struct {
+	fileSet *token.FileSet
+	// sources maps the names of the files to their source code.
+	sources   map[string]string
+	imports   map[string]string
+	functions map[string]*Ast
+	// packageValues maps the constants and the constant-initialized package-level variables to their values.
+	packageValues map[string]*Ast
+	packageCache  map[string]interface{}
+	// active holds the functions being interpreted, a recursive call is not folded.
+	active map[*Ast]bool
+	// chaincodes resolves the chaincodes called by `InvokeChaincode`, nil if no chaincode is configured.
+	chaincodes *chaincodeResolver
+	// spec holds the APIs added by a spec file, nil if none is added.
+	spec *APISpec
+}
+
+// The APIs of the stub accessing a key, with the position of the key in their arguments. The APIs of private data
+// are named like them with `PrivateData` in place of `State` and take the collection first.
+var keyAccessAPIs = map[string]int{
+	"GetState": 0,
+	"PutState": 0,
+	"DelState": 0,
+}
+
+// The APIs of the stub writing a key, every other API accessing a key reads it. A call of a chaincode which cannot be
+// resolved may write any of its keys.
+var keyWritingAPIs = map[string]bool{
+	"PutState":        true,
+	"DelState":        true,
+	"PutPrivateData":  true,
+	"DelPrivateData":  true,
+	"InvokeChaincode": true,
+}
+
+// @title:	newConstantTemplate
+//
+// @description:	This is used to create the template of a constant.
+//
+// @param: 	constant string	The constant.
+//
+// @return:	*KeyTemplate	The template.
+//
+func newConstantTemplate(constant string) *KeyTemplate {
+	if constant == "" {
+		return &KeyTemplate{Segments: []*KeySegment{}}
+	}
+	return &KeyTemplate{Segments: []*KeySegment{{Constant: constant}}}
+}
+
+// @title:	newHoleTemplate
+//
+// @description:	This is used to create the template of a value unknown at analysis time.
+//
+// @param: 	description string	The expression of the value.
+//
+// @param: 	length int	The length of the value, or -1 if it is unknown.
+//
+// @return:	*KeyTemplate	The template.
+//
+func newHoleTemplate(description string, length int) *KeyTemplate {
+	return &KeyTemplate{Segments: []*KeySegment{{Hole: description, Length: length}}}
+}
+
+// @title:	newCompositeTemplate
+//
+// @description:	This is used to create the template of a composite key like `CreateCompositeKey` does: a zero byte,
+//the object type and every attribute, each of them followed by a zero byte.
+//
+// @param: 	objectType *KeyTemplate	The template of the object type.
+//
+// @param: 	attributes []*KeyTemplate	List of the templates of the attributes.
+//
+// @return:	*KeyTemplate	The template.
+//
+func newCompositeTemplate(objectType *KeyTemplate, attributes []*KeyTemplate) *KeyTemplate {
+	template := concatKeyTemplates(newConstantTemplate("\x00"), objectType)
+	template = concatKeyTemplates(template, newConstantTemplate("\x00"))
+	for x := range attributes {
+		template = concatKeyTemplates(concatKeyTemplates(template, attributes[x]), newConstantTemplate("\x00"))
+	}
+	template.ObjectType = objectType
+	template.Attributes = attributes
+	return template
+}
+
+// @title:	foldAttributes
+//
+// @description:	This is used to convert the value of the attributes of a composite key to templates. Attributes
+//which are not known one by one are a single hole.
+//
+// @param: 	value interface{}	The value of the attributes.
+//
+// @param: 	description string	The expression of the attributes.
+//
+// @return:	attributes []*KeyTemplate	List of the templates of the attributes.
+//
+func foldAttributes(value interface{}, description string) (attributes []*KeyTemplate) {
+	slice, ok := value.(foldSlice)
+	if !ok {
+		return []*KeyTemplate{newHoleTemplate(description+"...", -1)}
+	}
+	attributes = []*KeyTemplate{}
+	for x := range slice {
+		if template, ok := slice[x].(*KeyTemplate); ok {
+			attributes = append(attributes, template)
+		} else {
+			attributes = append(attributes, newHoleTemplate(fmt.Sprintf("%s[%d]", description, x), -1))
+		}
+	}
+	return attributes
+}
+
+// @title:	concatKeyTemplates
+//
+// @description:	This is used to concatenate two templates, merging the constants next to each other.
+//
+// @param: 	a *KeyTemplate	The template on the left.
+//
+// @param: 	b *KeyTemplate	The template on the right.
+//
+// @return:	*KeyTemplate	The concatenation.
+//
+func concatKeyTemplates(a *KeyTemplate, b *KeyTemplate) *KeyTemplate {
+	segments := append([]*KeySegment{}, a.Segments...)
+	for x := range b.Segments {
+		if len(segments) != 0 && segments[len(segments)-1].Hole == "" && b.Segments[x].Hole == "" {
+			segments[len(segments)-1] = &KeySegment{Constant: segments[len(segments)-1].Constant + b.Segments[x].Constant}
+		} else {
+			segments = append(segments, b.Segments[x])
+		}
+	}
+	return &KeyTemplate{Segments: segments}
+}
+
+// @title:	keyTemplateConstant
+//
+// @description:	This is used to get the value of a template without hole.
+//
+// @param: 	template *KeyTemplate	The template.
+//
+// @return:	string		The value.
+//
+// @return:	bool		If the template has no hole, return true, otherwise return false.
+//
+func keyTemplateConstant(template *KeyTemplate) (string, bool) {
+	constant := ""
+	for x := range template.Segments {
+		if template.Segments[x].Hole != "" {
+			return "", false
+		}
+		constant += template.Segments[x].Constant
+	}
+	return constant, true
+}
+
+// @title:	keyTemplateLength
+//
+// @description:	This is used to get the length of the keys of a template.
+//
+// @param: 	template *KeyTemplate	The template.
+//
+// @return:	int		The length, or -1 if a hole has an unknown length.
+//
+func keyTemplateLength(template *KeyTemplate) int {
+	length := 0
+	for x := range template.Segments {
+		if template.Segments[x].Hole == "" {
+			length += len(template.Segments[x].Constant)
+		} else if template.Segments[x].Length < 0 {
+			return -1
+		} else {
+			length += template.Segments[x].Length
+		}
+	}
+	return length
+}
+
+// @title:	describeKeyTemplate
+//
+// @description:	This is used to describe a template as an expression, which is used in the description of holes.
+//
+// @param: 	template *KeyTemplate	The template.
+//
+// @return:	string		The description.
+//
+func describeKeyTemplate(template *KeyTemplate) string {
+	parts := []string{}
+	for x := range template.Segments {
+		if template.Segments[x].Hole == "" {
+			parts = append(parts, strconv.Quote(template.Segments[x].Constant))
+		} else {
+			parts = append(parts, template.Segments[x].Hole)
+		}
+	}
+	if len(parts) == 0 {
+		return `""`
+	}
+	return strings.Join(parts, " + ")
+}
+
+// @title:	formatKeyTemplate
+//
+// @description:	This is used to format a template, the holes are written in braces.
+//
+// @param: 	template *KeyTemplate	The template.
+//
+// @return:	string		The formatted template.
+//
+func formatKeyTemplate(template *KeyTemplate) string {
+	if template.ObjectType != nil {
+		attributes := []string{}
+		for x := range template.Attributes {
+			attributes = append(attributes, formatKeyTemplate(template.Attributes[x]))
+		}
+		return fmt.Sprintf("composite(%s, [%s])", formatKeyTemplate(template.ObjectType), strings.Join(attributes, ", "))
+	}
+	parts := []string{}
+	for x := range template.Segments {
+		if template.Segments[x].Hole == "" {
+			parts = append(parts, strconv.Quote(template.Segments[x].Constant))
+		} else {
+			parts = append(parts, "{"+template.Segments[x].Hole+"}")
+		}
+	}
+	if len(parts) == 0 {
+		return `""`
+	}
+	return strings.Join(parts, " + ")
+}
+
+// @title:	formatKeyShape
+//
+// @description:	This is used to format a template without the descriptions of the holes, only with their lengths.
+//Templates with the same shape belong to the same family of keys.
+//
+// @param: 	template *KeyTemplate	The template.
+//
+// @return:	string		The formatted shape.
+//
+func formatKeyShape(template *KeyTemplate) string {
+	parts := []string{}
+	for x := range template.Segments {
+		if template.Segments[x].Hole == "" {
+			parts = append(parts, strconv.Quote(template.Segments[x].Constant))
+		} else if template.Segments[x].Length < 0 {
+			parts = append(parts, "{*}")
+		} else {
+			parts = append(parts, fmt.Sprintf("{%d}", template.Segments[x].Length))
+		}
+	}
+	if len(parts) == 0 {
+		return `""`
+	}
+	return strings.Join(parts, " + ")
+}
+
+// @title:	sliceKeyTemplate
+//
+// @description:	This is used to slice a template like `s[low:high]`. A hole which is cut becomes a hole described by
+//the slice expression. If an unknown length is in front of the bounds, the whole result is such a hole.
+//
+// @param: 	template *KeyTemplate	The template.
+//
+// @param: 	low int		The lower bound.
+//
+// @param: 	high int	The upper bound, or -1 for the end.
+//
+// @return:	*KeyTemplate	The slice.
+//
+func sliceKeyTemplate(template *KeyTemplate, low int, high int) *KeyTemplate {
+	bounds := fmt.Sprintf("[%d:%d]", low, high)
+	length := high - low
+	if low == 0 {
+		bounds = fmt.Sprintf("[:%d]", high)
+	}
+	if high < 0 {
+		bounds = fmt.Sprintf("[%d:]", low)
+		length = -1
+	}
+	if len(template.Segments) == 1 && template.Segments[0].Hole != "" {
+		if high < 0 && template.Segments[0].Length >= 0 {
+			length = template.Segments[0].Length - low
+		}
+		return newHoleTemplate(template.Segments[0].Hole+bounds, length)
+	}
+	result := newConstantTemplate("")
+	offset := 0
+	for x := range template.Segments {
+		segment := template.Segments[x]
+		size := len(segment.Constant)
+		if segment.Hole != "" {
+			size = segment.Length
+		}
+		if high >= 0 && offset >= high {
+			break
+		}
+		if size < 0 {
+			return newHoleTemplate("("+describeKeyTemplate(template)+")"+bounds, length)
+		}
+		start, end := low-offset, size
+		if start < 0 {
+			start = 0
+		}
+		if high >= 0 && high-offset < end {
+			end = high - offset
+		}
+		if start < end && segment.Hole == "" {
+			result = concatKeyTemplates(result, newConstantTemplate(segment.Constant[start:end]))
+		} else if start < end && start == 0 && end == size {
+			result = concatKeyTemplates(result, &KeyTemplate{Segments: []*KeySegment{segment}})
+		} else if start < end {
+			result = concatKeyTemplates(result, newHoleTemplate(fmt.Sprintf("%s[%d:%d]", segment.Hole, start, end),
+				end-start))
+		}
+		offset += size
+	}
+	return result
+}
+
+// @title:	keyTemplateCells
+//
+// @description:	This is used to spell out the keys of a template from one end, one cell per byte, until a hole of
+//unknown length. A cell is a byte, or -1 for a byte of a hole.
+//
+// @param: 	template *KeyTemplate	The template.
+//
+// @param: 	reverse bool	If the keys are spelled out from the end.
+//
+// @return:	cells []int		List of cells.
+//
+func keyTemplateCells(template *KeyTemplate, reverse bool) (cells []int) {
+	cells = []int{}
+	for x := range template.Segments {
+		segment := template.Segments[x]
+		if reverse {
+			segment = template.Segments[len(template.Segments)-1-x]
+		}
+		if segment.Hole != "" && segment.Length < 0 {
+			break
+		}
+		for y := 0; y < len(segment.Constant) || y < segment.Length; y++ {
+			if segment.Hole != "" {
+				cells = append(cells, -1)
+			} else if reverse {
+				cells = append(cells, int(segment.Constant[len(segment.Constant)-1-y]))
+			} else {
+				cells = append(cells, int(segment.Constant[y]))
+			}
+		}
+	}
+	return cells
+}
+
+// @title:	compareKeyTemplates
+//
+// @description:	This is used to compare the keys of two templates in lexicographic order, as the ledger sorts them.
+//The order is known if a constant byte differs before any byte of a hole, or if a template is spelled out entirely and
+//is a proper prefix of the other.
+//
+// @param: 	a *KeyTemplate	A template.
+//
+// @param: 	b *KeyTemplate	Another template.
+//
+// @return:	int		-1 if the keys of `a` are before the keys of `b`, 1 if they are after, 0 if they are equal.
+//
+// @return:	bool		If the order is known, return true, otherwise return false.
+//
+func compareKeyTemplates(a *KeyTemplate, b *KeyTemplate) (int, bool) {
+	cellsA, cellsB := keyTemplateCells(a, false), keyTemplateCells(b, false)
+	fullA, fullB := keyTemplateLength(a) == len(cellsA), keyTemplateLength(b) == len(cellsB)
+	for x := 0; ; x++ {
+		endA, endB := x >= len(cellsA), x >= len(cellsB)
+		if endA && fullA && endB && fullB {
+			return 0, true
+		} else if endA && fullA && !endB {
+			return -1, true
+		} else if endB && fullB && !endA {
+			return 1, true
+		} else if endA || endB || cellsA[x] < 0 || cellsB[x] < 0 {
+			return 0, false
+		} else if cellsA[x] < cellsB[x] {
+			return -1, true
+		} else if cellsA[x] > cellsB[x] {
+			return 1, true
+		}
+	}
+}
+
+// @title:	keyTemplatesDisjoint
+//
+// @description:	This is used to prove that two templates never produce the same key: a constant byte differs at the
+//same offset from the start or from the end, or the lengths differ.
+//
+// @param: 	a *KeyTemplate	A template.
+//
+// @param: 	b *KeyTemplate	Another template.
+//
+// @return:	bool		If the templates are proven disjoint, return true, otherwise return false.
+//
+func keyTemplatesDisjoint(a *KeyTemplate, b *KeyTemplate) bool {
+	lengthA, lengthB := keyTemplateLength(a), keyTemplateLength(b)
+	if lengthA >= 0 && lengthB >= 0 && lengthA != lengthB {
+		return true
+	}
+	for _, reverse := range []bool{false, true} {
+		cellsA, cellsB := keyTemplateCells(a, reverse), keyTemplateCells(b, reverse)
+		if (lengthA >= 0 && len(cellsB) > lengthA) || (lengthB >= 0 && len(cellsA) > lengthB) {
+			return true
+		}
+		for x := 0; x < len(cellsA) && x < len(cellsB); x++ {
+			if cellsA[x] >= 0 && cellsB[x] >= 0 && cellsA[x] != cellsB[x] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// @title:	findChild
+//
+// @description:	This is used to find the child of a node by the name of its field, like `Low` or `Body`.
+//
+// @param: 	ast *Ast	The node.
+//
+// @param: 	name string	The name of the field.
+//
+// @return:	*Ast		The child, or nil if the field is empty or the node is nil.
+//
+func findChild(ast *Ast, name string) *Ast {
+	if ast == nil {
+		return nil
+	}
+	for x := range ast.Children {
+		if strings.HasPrefix(ast.Children[x].Label, name+" :") {
+			return ast.Children[x]
+		}
+	}
+	return nil
+}
+
+// @title:	foldText
+//
+// @description:	This is used to get the source code of a node in any file of the scope.
+//
+// @param: 	scope *foldScope	The shared scope.
+//
+// @param: 	ast *Ast	The node whose source code is needed.
+//
+// @return:	string		The source code of the node.
+//
+func foldText(scope *foldScope, ast *Ast) string {
+	return sourceText(scope.fileSet, scope.sources[scope.fileSet.Position(token.Pos(ast.Pos)).Filename], ast)
+}
+
+// @title:	foldKey
+//
+// @description:	This is used to fold an expression used as a key, anything which is not a string becomes a hole.
+//
+// @param: 	ast *Ast	The expression.
+//
+// @param: 	frame *foldFrame	The frame of the function.
+//
+// @param: 	scope *foldScope	The shared scope.
+//
+// @return:	*KeyTemplate	The template of the expression.
+//
+func foldKey(ast *Ast, frame *foldFrame, scope *foldScope) *KeyTemplate {
+	if template, ok := foldExpression(ast, frame, scope).(*KeyTemplate); ok {
+		return template
+	}
+	return newHoleTemplate(foldText(scope, ast), -1)
+}
+
+// @title:	foldExpression
+//
+// @description:	This is used to evaluate an expression at analysis time. A value is a `*KeyTemplate` for strings
+//and byte slices, an `int`, a `*foldHash`, a `[]interface{}` for several results, or nil if it is unknown. The calls
+//of the ledger API met on the way are appended to the frame.
+//
+// @param: 	ast *Ast	The expression.
+//
+// @param: 	frame *foldFrame	The frame of the function.
+//
+// @param: 	scope *foldScope	The shared scope.
+//
+// @return:	interface{}		The value.
+//
+func foldExpression(ast *Ast, frame *foldFrame, scope *foldScope) interface{} {
+	switch {
+	case strings.Contains(ast.Label, "*ast.BasicLit"):
+		if ast.Attrs["Kind"] == "STRING" {
+			if value, err := strconv.Unquote(ast.Attrs["Value"]); err == nil {
+				return newConstantTemplate(value)
+			}
+		} else if ast.Attrs["Kind"] == "INT" {
+			if value, err := strconv.Atoi(ast.Attrs["Value"]); err == nil {
+				return value
+			}
+		}
+		return nil
+	case strings.Contains(ast.Label, "*ast.Ident"):
+		if value, ok := frame.env[ast.Attrs["Name"]]; ok {
+			return value
+		} else if _, ok := scope.packageValues[ast.Attrs["Name"]]; ok {
+			return foldPackageValue(ast.Attrs["Name"], scope)
+		} else if ast.Attrs["Name"] == "nil" || ast.Attrs["Name"] == "true" || ast.Attrs["Name"] == "false" {
+			return nil
+		}
+		return newHoleTemplate(ast.Attrs["Name"], -1)
+	case strings.Contains(ast.Label, "*ast.ParenExpr"):
+		return foldExpression(ast.Children[0], frame, scope)
+	case strings.Contains(ast.Label, "*ast.BinaryExpr"):
+		x, y := foldExpression(ast.Children[0], frame, scope), foldExpression(ast.Children[1], frame, scope)
+		templateX, okX := x.(*KeyTemplate)
+		templateY, okY := y.(*KeyTemplate)
+		intX, okIntX := x.(int)
+		intY, okIntY := y.(int)
+		if ast.Attrs["Op"] == "+" && okX && okY {
+			return concatKeyTemplates(templateX, templateY)
+		} else if okIntX && okIntY {
+			switch ast.Attrs["Op"] {
+			case "+":
+				return intX + intY
+			case "-":
+				return intX - intY
+			case "*":
+				return intX * intY
+			}
+		}
+		return nil
+	case strings.Contains(ast.Label, "*ast.SliceExpr"):
+		template, ok := foldExpression(ast.Children[0], frame, scope).(*KeyTemplate)
+		low, high := 0, -1
+		lowOk, highOk := true, true
+		if child := findChild(ast, "Low"); child != nil {
+			low, lowOk = foldExpression(child, frame, scope).(int)
+		}
+		if child := findChild(ast, "High"); child != nil {
+			high, highOk = foldExpression(child, frame, scope).(int)
+		}
+		if ok && lowOk && highOk && findChild(ast, "Max") == nil {
+			return sliceKeyTemplate(template, low, high)
+		}
+		return newHoleTemplate(foldText(scope, ast), -1)
+	case strings.Contains(ast.Label, "*ast.IndexExpr"):
+		slice, sliceOk := foldExpression(ast.Children[0], frame, scope).(foldSlice)
+		index, indexOk := foldExpression(ast.Children[1], frame, scope).(int)
+		if sliceOk && indexOk && index >= 0 && index < len(slice) && slice[index] != nil {
+			return slice[index]
+		}
+		return newHoleTemplate(foldText(scope, ast), -1)
+	case strings.Contains(ast.Label, "*ast.CompositeLit") && strings.Contains(ast.Children[0].Label, "*ast.ArrayType"):
+		slice := foldSlice{}
+		if child := findChild(ast, "Elts"); child != nil {
+			for x := range child.Children {
+				slice = append(slice, foldExpression(child.Children[x], frame, scope))
+			}
+		}
+		return slice
+	case strings.Contains(ast.Label, "*ast.SelectorExpr"):
+		// A field of a hole is described from the hole, which may come from the caller. A selector of a package is a
+		// constant of another package, the value is unknown.
+		if template, ok := foldExpression(ast.Children[0], frame, scope).(*KeyTemplate); ok &&
+			len(template.Segments) == 1 && template.Segments[0].Hole != "" {
+			return newHoleTemplate(template.Segments[0].Hole+"."+ast.Children[1].Attrs["Name"], -1)
+		}
+		return newHoleTemplate(foldText(scope, ast), -1)
+	case strings.Contains(ast.Label, "*ast.CallExpr"):
+		return foldCall(ast, frame, scope)
+	case strings.Contains(ast.Label, "*ast.FuncLit"):
+		// The closure is not called here, but the accesses in it are still the function's.
+		closure := &foldFrame{env: map[string]interface{}{}, accesses: []*KeyAccess{}}
+		for name, value := range frame.env {
+			closure.env[name] = value
+		}
+		arguments := findFunctionArguments(ast)
+		for x := range arguments {
+			closure.env[arguments[x].Attrs["Name"]] = newHoleTemplate(arguments[x].Attrs["Name"], -1)
+		}
+		interpretStatements(findFunctionBody(ast), closure, scope)
+		frame.accesses = append(frame.accesses, closure.accesses...)
+		return nil
+	}
+	for x := range ast.Children {
+		foldExpression(ast.Children[x], frame, scope)
+	}
+	return nil
+}
+
+// @title:	foldPackageValue
+//
+// @description:	This is used to evaluate a constant or a constant-initialized package-level variable once.
+//
+// @param: 	name string	The name of the constant or variable.
+//
+// @param: 	scope *foldScope	The shared scope.
+//
+// @return:	interface{}		The value.
+//
+func foldPackageValue(name string, scope *foldScope) interface{} {
+	if value, ok := scope.packageCache[name]; ok {
+		return value
+	}
+	// A value referring to itself is unknown.
+	scope.packageCache[name] = nil
+	value := foldExpression(scope.packageValues[name], &foldFrame{env: map[string]interface{}{}}, scope)
+	scope.packageCache[name] = value
+	return value
+}
+
+// @title:	foldLibraryCall
+//
+// @description:	This is used to evaluate a call of a pure function of the standard library: hashing, hex encoding,
+//changing the case of letters, formatting numbers and `fmt.Sprintf`.
+//
+// @param: 	path string	The import path of the package.
+//
+// @param: 	name string	The name of the function.
+//
+// @param: 	arguments []interface{}	The values of the arguments.
+//
+// @return:	interface{}		The value, or nil if it is unknown.
+//
+func foldLibraryCall(path string, name string, arguments []interface{}) interface{} {
+	hashes := map[string]func() hash.Hash{"crypto/sha512": sha512.New, "crypto/sha256": sha256.New,
+		"crypto/sha1": sha1.New, "crypto/md5": md5.New}
+	call := path[strings.LastIndex(path, "/")+1:] + "." + name
+	describe := func() string {
+		descriptions := []string{}
+		for x := range arguments {
+			switch argument := arguments[x].(type) {
+			case *KeyTemplate:
+				descriptions = append(descriptions, describeKeyTemplate(argument))
+			case int:
+				descriptions = append(descriptions, strconv.Itoa(argument))
+			default:
+				descriptions = append(descriptions, "?")
+			}
+		}
+		return call + "(" + strings.Join(descriptions, ", ") + ")"
+	}
+	var template *KeyTemplate
+	if len(arguments) != 0 {
+		template, _ = arguments[0].(*KeyTemplate)
+	}
+	switch {
+	case hashes[path] != nil && name == "New":
+		return &foldHash{hash: hashes[path]()}
+	case call == "hex.EncodeToString" && template != nil:
+		if constant, ok := keyTemplateConstant(template); ok {
+			return newConstantTemplate(hex.EncodeToString([]byte(constant)))
+		} else if length := keyTemplateLength(template); length >= 0 {
+			return newHoleTemplate(describe(), length*2)
+		}
+		return newHoleTemplate(describe(), -1)
+	case (call == "strings.ToLower" || call == "strings.ToUpper") && template != nil:
+		result := newConstantTemplate("")
+		for x := range template.Segments {
+			if template.Segments[x].Hole != "" {
+				result = concatKeyTemplates(result, newHoleTemplate(call+"("+template.Segments[x].Hole+")",
+					template.Segments[x].Length))
+			} else if call == "strings.ToLower" {
+				result = concatKeyTemplates(result, newConstantTemplate(strings.ToLower(template.Segments[x].Constant)))
+			} else {
+				result = concatKeyTemplates(result, newConstantTemplate(strings.ToUpper(template.Segments[x].Constant)))
+			}
+		}
+		return result
+	case call == "strconv.Itoa" && len(arguments) == 1:
+		if value, ok := arguments[0].(int); ok {
+			return newConstantTemplate(strconv.Itoa(value))
+		}
+		return newHoleTemplate(describe(), -1)
+	case call == "fmt.Sprintf" && template != nil:
+		return foldSprintf(template, arguments[1:], describe())
+	}
+	return nil
+}
+
+// @title:	foldSprintf
+//
+// @description:	This is used to evaluate `fmt.Sprintf`. The constant arguments are formatted at analysis time and
+//a hole formatted by `%s` or `%v` stays a hole, so the constant parts of the format are kept around the holes.
+//
+// @param: 	format *KeyTemplate	The format.
+//
+// @param: 	arguments []interface{}	The values of the other arguments.
+//
+// @param: 	description string	The description of the call, used if the result is unknown.
+//
+// @return:	*KeyTemplate	The result.
+//
+func foldSprintf(format *KeyTemplate, arguments []interface{}, description string) *KeyTemplate {
+	text, ok := keyTemplateConstant(format)
+	if !ok {
+		return newHoleTemplate(description, -1)
+	}
+	result := newConstantTemplate("")
+	index := 0
+	for x := 0; x < len(text); x++ {
+		if text[x] != '%' {
+			result = concatKeyTemplates(result, newConstantTemplate(text[x:x+1]))
+			continue
+		}
+		y := x + 1
+		for y < len(text) && strings.IndexByte("+-# 0123456789.", text[y]) >= 0 {
+			y++
+		}
+		if y == len(text) {
+			return newHoleTemplate(description, -1)
+		}
+		verb := text[x : y+1]
+		x = y
+		if verb == "%%" {
+			result = concatKeyTemplates(result, newConstantTemplate("%"))
+			continue
+		} else if index >= len(arguments) {
+			return newHoleTemplate(description, -1)
+		}
+		switch argument := arguments[index].(type) {
+		case *KeyTemplate:
+			if constant, ok := keyTemplateConstant(argument); ok {
+				result = concatKeyTemplates(result, newConstantTemplate(fmt.Sprintf(verb, constant)))
+			} else if verb == "%s" || verb == "%v" {
+				result = concatKeyTemplates(result, argument)
+			} else {
+				result = concatKeyTemplates(result, newHoleTemplate(describeKeyTemplate(argument), -1))
+			}
+		case int:
+			result = concatKeyTemplates(result, newConstantTemplate(fmt.Sprintf(verb, argument)))
+		default:
+			result = concatKeyTemplates(result, newHoleTemplate(fmt.Sprintf("argument %d", index+1), -1))
+		}
+		index++
+	}
+	return result
+}
+
+// @title:	foldCall
+//
+// @description:	This is used to evaluate a call. The calls of the ledger API are recorded with the template of
+//their key, the pure functions of the standard library and the functions of the file are evaluated. A function of
+//the file returning a single hole made of its own computation is described by the call, like `hexdigest(id)`.
+//
+// @param: 	ast *Ast	The `CallExpr` node.
+//
+// @param: 	frame *foldFrame	The frame of the function.
+//
+// @param: 	scope *foldScope	The shared scope.
+//
+// @return:	interface{}		The value.
+//
+func foldCall(ast *Ast, frame *foldFrame, scope *foldScope) interface{} {
+	fun := ast.Children[0]
+	argumentNodes := []*Ast{}
+	if child := findChild(ast, "Args"); child != nil {
+		argumentNodes = child.Children
+	}
+	arguments := []interface{}{}
+	for x := range argumentNodes {
+		arguments = append(arguments, foldExpression(argumentNodes[x], frame, scope))
+	}
+	// Conversions like `[]byte(s)` and `string(b)` keep the value.
+	if (strings.Contains(fun.Label, "*ast.ArrayType") || (strings.Contains(fun.Label, "*ast.Ident") &&
+		fun.Attrs["Name"] == "string")) && len(arguments) == 1 {
+		return arguments[0]
+	} else if strings.Contains(fun.Label, "*ast.Ident") && fun.Attrs["Name"] == "append" && len(arguments) != 0 {
+		if slice, ok := arguments[0].(foldSlice); ok && findChild(ast, "Ellipsis") == nil {
+			return append(append(foldSlice{}, slice...), arguments[1:]...)
+		}
+		return nil
+	} else if strings.Contains(fun.Label, "*ast.Ident") && fun.Attrs["Name"] == "len" && len(arguments) == 1 {
+		if template, ok := arguments[0].(*KeyTemplate); ok && keyTemplateLength(template) >= 0 {
+			return keyTemplateLength(template)
+		}
+		return nil
+	} else if strings.Contains(fun.Label, "*ast.SelectorExpr") {
+		receiver, selector := fun.Children[0], fun.Children[1].Attrs["Name"]
+		// An API of private data is read as the API of the world state after the collection.
+		api, offset := selector, 0
+		var collection *KeyTemplate
+		if strings.Contains(selector, "PrivateData") && len(argumentNodes) != 0 {
+			api, offset = strings.Replace(selector, "PrivateData", "State", 1), 1
+			collection = foldKey(argumentNodes[0], frame, scope)
+		}
+		if selector == "InvokeChaincode" && len(arguments) >= 2 {
+			invokeChaincode(ast, argumentNodes, arguments, frame, scope)
+			return nil
+		} else if selector == "CreateCompositeKey" && len(arguments) == 2 {
+			return []interface{}{newCompositeTemplate(foldKey(argumentNodes[0], frame, scope), foldAttributes(arguments[1],
+				foldText(scope, argumentNodes[1]))), nil}
+		} else if api == "GetStateByPartialCompositeKey" && len(arguments) == offset+2 {
+			frame.accesses = append(frame.accesses, &KeyAccess{Site: ast, Via: []string{}, API: selector,
+				Collection: collection, Key: newCompositeTemplate(foldKey(argumentNodes[offset], frame, scope),
+					foldAttributes(arguments[offset+1], foldText(scope, argumentNodes[offset+1]))),
+				Partial: true})
+			return nil
+		} else if api == "GetStateByRange" && len(arguments) == offset+2 {
+			frame.accesses = append(frame.accesses, &KeyAccess{Site: ast, Via: []string{}, API: selector,
+				Collection: collection, Key: foldKey(argumentNodes[offset], frame, scope),
+				End: foldKey(argumentNodes[offset+1], frame, scope)})
+			return nil
+		} else if selector == "SplitCompositeKey" && len(arguments) == 1 {
+			if template, ok := arguments[0].(*KeyTemplate); ok && template.ObjectType != nil {
+				attributes := foldSlice{}
+				for x := range template.Attributes {
+					attributes = append(attributes, template.Attributes[x])
+				}
+				return []interface{}{template.ObjectType, attributes, nil}
+			}
+			return nil
+		}
+		if position, ok := scope.spec.keyPosition(api); ok && len(argumentNodes) > position+offset {
+			frame.accesses = append(frame.accesses, &KeyAccess{Site: ast, Via: []string{}, API: selector,
+				Write: scope.spec.writes(selector), Collection: collection,
+				Key: foldKey(argumentNodes[position+offset], frame, scope)})
+			return nil
+		}
+		if strings.Contains(receiver.Label, "*ast.Ident") {
+			if _, local := frame.env[receiver.Attrs["Name"]]; !local && scope.imports[receiver.Attrs["Name"]] != "" {
+				return foldLibraryCall(scope.imports[receiver.Attrs["Name"]], selector, arguments)
+			}
+		}
+		if value, ok := foldExpression(receiver, frame, scope).(*foldHash); ok {
+			var template *KeyTemplate
+			if len(arguments) != 0 {
+				template, _ = arguments[0].(*KeyTemplate)
+			}
+			constant, constantOk := "", template != nil
+			if template != nil {
+				constant, constantOk = keyTemplateConstant(template)
+			}
+			if selector == "Write" && constantOk {
+				value.hash.Write([]byte(constant))
+			} else if selector == "Write" {
+				value.tainted = true
+			} else if selector == "Sum" && !value.tainted && (len(arguments) == 0 || arguments[0] == nil || constantOk) {
+				return newConstantTemplate(string(value.hash.Sum([]byte(constant))))
+			} else if selector == "Sum" {
+				return newHoleTemplate("hash", value.hash.Size())
+			}
+		}
+		return nil
+	}
+	if !strings.Contains(fun.Label, "*ast.Ident") || scope.functions[fun.Attrs["Name"]] == nil {
+		return nil
+	}
+	if _, local := frame.env[fun.Attrs["Name"]]; local {
+		return nil
+	}
+	// An unknown argument is named by its expression in the caller.
+	bound := append([]interface{}{}, arguments...)
+	for x := range bound {
+		if bound[x] == nil {
+			bound[x] = newHoleTemplate(foldText(scope, argumentNodes[x]), -1)
+		}
+	}
+	result, accesses := interpretFunction(scope.functions[fun.Attrs["Name"]], bound, scope)
+	for x := range accesses {
+		frame.accesses = append(frame.accesses, &KeyAccess{Site: ast, Via: append([]string{fun.Attrs["Name"]},
+			accesses[x].Via...), API: accesses[x].API, Write: accesses[x].Write, Key: accesses[x].Key,
+			Partial: accesses[x].Partial, Chaincode: accesses[x].Chaincode, Collection: accesses[x].Collection,
+			End: accesses[x].End})
+	}
+	if template, ok := result.(*KeyTemplate); ok && len(template.Segments) == 1 && template.Segments[0].Hole != "" {
+		for x := range arguments {
+			if argument, ok := arguments[x].(*KeyTemplate); ok && len(argument.Segments) == 1 &&
+				argument.Segments[0].Hole == template.Segments[0].Hole {
+				return result
+			}
+		}
+		descriptions := []string{}
+		for x := range arguments {
+			if argument, ok := arguments[x].(*KeyTemplate); ok {
+				descriptions = append(descriptions, describeKeyTemplate(argument))
+			} else {
+				descriptions = append(descriptions, foldText(scope, argumentNodes[x]))
+			}
+		}
+		return newHoleTemplate(fun.Attrs["Name"]+"("+strings.Join(descriptions, ", ")+")", template.Segments[0].Length)
+	}
+	return result
+}
+
+// @title:	interpretFunction
+//
+// @description:	This is used to interpret a function of the file with the values of its arguments.
+//
+// @param: 	ast *Ast	The `FuncDecl` node.
+//
+// @param: 	arguments []interface{}	The values of the arguments, a missing one is a hole named by the parameter.
+//
+// @param: 	scope *foldScope	The shared scope.
+//
+// @return:	result interface{}	The value returned by the function.
+//
+// @return:	accesses []*KeyAccess	List of the calls of the ledger API in the function.
+//
+func interpretFunction(ast *Ast, arguments []interface{}, scope *foldScope) (result interface{}, accesses []*KeyAccess) {
+	if scope.active[ast] {
+		return nil, []*KeyAccess{}
+	}
+	scope.active[ast] = true
+	defer delete(scope.active, ast)
+	frame := &foldFrame{env: map[string]interface{}{}, accesses: []*KeyAccess{}}
+	parameters := findFunctionArguments(ast)
+	for x := range parameters {
+		if x < len(arguments) {
+			frame.env[parameters[x].Attrs["Name"]] = arguments[x]
+		} else {
+			frame.env[parameters[x].Attrs["Name"]] = newHoleTemplate(parameters[x].Attrs["Name"], -1)
+		}
+	}
+	results := interpretStatements(findFunctionBody(ast), frame, scope)
+	// The function returns a known value only if every `return` agrees on it.
+	for x := range results {
+		if fmt.Sprint(describeFoldValue(results[x])) != fmt.Sprint(describeFoldValue(results[0])) {
+			return nil, frame.accesses
+		}
+	}
+	if len(results) != 0 {
+		result = results[0]
+	}
+	return result, frame.accesses
+}
+
+// @title:	describeFoldValue
+//
+// @description:	This is used to describe a value, two values with the same description are equal.
+//
+// @param: 	value interface{}	The value.
+//
+// @return:	string		The description.
+//
+func describeFoldValue(value interface{}) string {
+	switch value := value.(type) {
+	case *KeyTemplate:
+		return formatKeyTemplate(value)
+	case int:
+		return strconv.Itoa(value)
+	case []interface{}:
+		descriptions := []string{}
+		for x := range value {
+			descriptions = append(descriptions, describeFoldValue(value[x]))
+		}
+		return "(" + strings.Join(descriptions, ", ") + ")"
+	case foldSlice:
+		descriptions := []string{}
+		for x := range value {
+			descriptions = append(descriptions, describeFoldValue(value[x]))
+		}
+		return "[" + strings.Join(descriptions, ", ") + "]"
+	case *foldHash:
+		return fmt.Sprintf("hash %p", value)
+	}
+	return "?"
+}
+
+// @title:	assignFoldValue
+//
+// @description:	This is used to assign the values of the right-handed side of a statement to its labels.
+//
+// @param: 	ast *Ast	The statement.
+//
+// @param: 	frame *foldFrame	The frame of the function.
+//
+// @param: 	scope *foldScope	The shared scope.
+//
+func assignFoldValue(ast *Ast, frame *foldFrame, scope *foldScope) {
+	left, right, kind := splitStatement(ast)
+	if kind == statementOther {
+		return
+	}
+	values := []interface{}{}
+	for x := range right.Children {
+		values = append(values, foldExpression(right.Children[x], frame, scope))
+	}
+	if len(values) == 1 && len(left.Children) > 1 {
+		tuple, _ := values[0].([]interface{})
+		values = tuple
+	}
+	for x := range left.Children {
+		if !strings.Contains(left.Children[x].Label, "*ast.Ident") {
+			foldExpression(left.Children[x], frame, scope)
+			continue
+		}
+		name := left.Children[x].Attrs["Name"]
+		var value interface{}
+		if x < len(values) {
+			value = values[x]
+		}
+		if kind == statementUpdate {
+			previous, previousOk := frame.env[name].(*KeyTemplate)
+			template, templateOk := value.(*KeyTemplate)
+			if ast.Attrs["Tok"] == "+=" && previousOk && templateOk {
+				value = concatKeyTemplates(previous, template)
+			} else {
+				value = nil
+			}
+		}
+		if value == nil {
+			value = newHoleTemplate(name, -1)
+		}
+		if name != "_" {
+			frame.env[name] = value
+		}
+	}
+}
+
+// @title:	interpretBranch
+//
+// @description:	This is used to interpret a block which may run or not, or run several times. A label whose value
+//is changed by the block becomes a hole named by the label.
+//
+// @param: 	ast *Ast	The block.
+//
+// @param: 	frame *foldFrame	The frame of the function.
+//
+// @param: 	scope *foldScope	The shared scope.
+//
+// @return:	results []interface{}	List of the values of the `return` statements in the block.
+//
+func interpretBranch(ast *Ast, frame *foldFrame, scope *foldScope) (results []interface{}) {
+	branch := &foldFrame{env: map[string]interface{}{}, accesses: []*KeyAccess{}}
+	for name, value := range frame.env {
+		branch.env[name] = value
+	}
+	results = interpretStatements(ast, branch, scope)
+	frame.accesses = append(frame.accesses, branch.accesses...)
+	for name, value := range frame.env {
+		if describeFoldValue(branch.env[name]) != describeFoldValue(value) {
+			frame.env[name] = joinKeyTemplates(value, branch.env[name], name)
+		}
+	}
+	return results
+}
+
+// @title:	joinKeyTemplates
+//
+// @description:	This is used to merge two values a label may hold into a hole named by the label, which keeps the
+//constant prefix of two templates.
+//
+// @param: 	a interface{}	A value.
+//
+// @param: 	b interface{}	Another value.
+//
+// @param: 	name string		The name of the label.
+//
+// @return:	*KeyTemplate	The merged template.
+//
+func joinKeyTemplates(a interface{}, b interface{}, name string) *KeyTemplate {
+	templateA, okA := a.(*KeyTemplate)
+	templateB, okB := b.(*KeyTemplate)
+	if !okA || !okB || len(templateA.Segments) == 0 || len(templateB.Segments) == 0 ||
+		templateA.Segments[0].Hole != "" || templateB.Segments[0].Hole != "" {
+		return newHoleTemplate(name, -1)
+	}
+	prefixA, prefixB := templateA.Segments[0].Constant, templateB.Segments[0].Constant
+	length := 0
+	for length < len(prefixA) && length < len(prefixB) && prefixA[length] == prefixB[length] {
+		length++
+	}
+	return concatKeyTemplates(newConstantTemplate(prefixA[:length]), newHoleTemplate(name, -1))
+}
+
+// @title:	interpretStatements
+//
+// @description:	This is used to interpret the statements in a node in the order of the source code.
+//
+// @param: 	ast *Ast	The node, or nil.
+//
+// @param: 	frame *foldFrame	The frame of the function.
+//
+// @param: 	scope *foldScope	The shared scope.
+//
+// @return:	results []interface{}	List of the values of the `return` statements.
+//
+func interpretStatements(ast *Ast, frame *foldFrame, scope *foldScope) (results []interface{}) {
+	results = []interface{}{}
+	// The body of a function declared without one is missing.
+	if ast == nil {
+		return results
+	}
+	switch {
+	case strings.Contains(ast.Label, "[]ast.Stmt"):
+		for x := range ast.Children {
+			results = append(results, interpretStatements(ast.Children[x], frame, scope)...)
+		}
+	case strings.Contains(ast.Label, "*ast.BlockStmt"), strings.Contains(ast.Label, "*ast.LabeledStmt"):
+		for x := range ast.Children {
+			results = append(results, interpretStatements(ast.Children[x], frame, scope)...)
+		}
+	case strings.Contains(ast.Label, "*ast.AssignStmt"), strings.Contains(ast.Label, "*ast.DeclStmt"),
+		strings.Contains(ast.Label, "*ast.IncDecStmt"):
+		assignFoldValue(ast, frame, scope)
+	case strings.Contains(ast.Label, "*ast.ReturnStmt"):
+		values := []interface{}{}
+		for x := range ast.Children {
+			if strings.HasPrefix(ast.Children[x].Label, "Results") {
+				for y := range ast.Children[x].Children {
+					values = append(values, foldExpression(ast.Children[x].Children[y], frame, scope))
+				}
+			}
+		}
+		if len(values) == 1 {
+			results = append(results, values[0])
+		} else {
+			results = append(results, values)
+		}
+	case strings.Contains(ast.Label, "*ast.IfStmt"), strings.Contains(ast.Label, "*ast.ForStmt"),
+		strings.Contains(ast.Label, "*ast.RangeStmt"), strings.Contains(ast.Label, "*ast.SwitchStmt"),
+		strings.Contains(ast.Label, "*ast.TypeSwitchStmt"), strings.Contains(ast.Label, "*ast.SelectStmt"),
+		strings.Contains(ast.Label, "*ast.CaseClause"), strings.Contains(ast.Label, "*ast.CommClause"):
+		for x := range ast.Children {
+			child := ast.Children[x]
+			if strings.HasPrefix(child.Label, "Init") || strings.HasPrefix(child.Label, "Assign") {
+				interpretStatements(child, frame, scope)
+			} else if strings.HasPrefix(child.Label, "Body") || strings.HasPrefix(child.Label, "Else") ||
+				strings.HasPrefix(child.Label, "Post") || strings.HasPrefix(child.Label, "Comm") {
+				results = append(results, interpretBranch(child, frame, scope)...)
+			} else if strings.HasPrefix(child.Label, "Key") || strings.HasPrefix(child.Label, "Value") {
+				if strings.Contains(child.Label, "*ast.Ident") {
+					frame.env[child.Attrs["Name"]] = newHoleTemplate(child.Attrs["Name"], -1)
+				}
+			} else if strings.HasPrefix(child.Label, "List") {
+				// The body of a case clause is a list of statements, its expressions are a list of expressions.
+				if strings.Contains(child.Label, "[]ast.Stmt") {
+					results = append(results, interpretBranch(child, frame, scope)...)
+				} else {
+					foldExpression(child, frame, scope)
+				}
+			} else {
+				foldExpression(child, frame, scope)
+			}
+		}
+	case strings.Contains(ast.Label, "*ast.ExprStmt"), strings.Contains(ast.Label, "*ast.GoStmt"),
+		strings.Contains(ast.Label, "*ast.DeferStmt"), strings.Contains(ast.Label, "*ast.SendStmt"):
+		for x := range ast.Children {
+			foldExpression(ast.Children[x], frame, scope)
+		}
+	}
+	return results
+}
+
+// @title:	newFoldScope
+//
+// @description:	This is used to create the scope of the files of a chaincode, with its functions, its constants and
+//its constant-initialized package-level variables.
+//
+// @param: 	asts []*Ast	The root nodes of the files.
+//
+// @param: 	packageVariables []*PackageVariable	List of package-level variables of the files.
+//
+// @param: 	fileSet *token.FileSet	The file set which the files are parsed with.
+//
+// @param: 	sources map[string]string	Map of the names of the files to their source code.
+//
+// @param: 	chaincodes *chaincodeResolver	The resolver of the called chaincodes, or nil.
+//
+// @param: 	spec *APISpec	The APIs added by a spec file, or nil.
+//
+// @return:	scope *foldScope	The scope.
+//
+func newFoldScope(asts []*Ast, packageVariables []*PackageVariable, fileSet *token.FileSet, sources map[string]string,
+	chaincodes *chaincodeResolver, spec *APISpec) (scope *foldScope) {
+	scope = &foldScope{fileSet: fileSet, sources: sources, imports: map[string]string{}, functions: map[string]*Ast{},
+		packageValues: map[string]*Ast{}, packageCache: map[string]interface{}{}, active: map[*Ast]bool{},
+		chaincodes: chaincodes, spec: spec}
+	for _, ast := range asts {
+		for name, path := range findImports(ast) {
+			scope.imports[name] = path
+		}
+		functions := findFunctionDeclarations(ast)
+		for x := range functions {
+			// Methods are called through their receiver, only functions are folded.
+			if !isMethodDeclaration(functions[x]) {
+				scope.functions[findFunctionName(functions[x])] = functions[x]
+			}
+		}
+		for x := range ast.Children {
+			if !strings.Contains(ast.Children[x].Label, "Decls") {
+				continue
+			}
+			for y := range ast.Children[x].Children {
+				decl := ast.Children[x].Children[y]
+				if !strings.Contains(decl.Label, "GenDecl") || !strings.Contains(decl.Label, "Tok: const") {
+					continue
+				}
+				// A declaration with a comment has its `Doc` before its `Specs`.
+				specs := findChild(decl, "Specs").Children
+				for z := range specs {
+					names := findValueSpecNames(specs[z])
+					for w := range names {
+						if value := findValueSpecValue(specs[z], w); value != nil {
+							scope.packageValues[names[w].Attrs["Name"]] = value
+						}
+					}
+				}
+			}
+		}
+	}
+	for x := range packageVariables {
+		names := findValueSpecNames(packageVariables[x].Spec)
+		for y := range names {
+			if names[y].Attrs["Name"] != packageVariables[x].Name || packageVariables[x].Mutated {
+				continue
+			}
+			if value := findValueSpecValue(packageVariables[x].Spec, y); value != nil {
+				scope.packageValues[packageVariables[x].Name] = value
+			}
+		}
+	}
+	return scope
+}
+
+// @title:	analyzeKeyTemplates
+//
+// @description:	This is used to find the template of the key of every call of the ledger API in every function,
+//directly or through the functions it calls. The constants, the constant-initialized package-level variables and the
+//pure helper calls with constant arguments are folded, so the templates show concrete prefixes.
+//
+// @param: 	ast *Ast	The root node of the file.
+//
+// @param: 	packageVariables []*PackageVariable	List of package-level variables.
+//
+// @param: 	fileSet *token.FileSet	The file set which the source code is parsed with.
+//
+// @param: 	filename string	The name of the file.
+//
+// @param: 	source string	The source code.
+//
+// @param: 	chaincodes *chaincodeResolver	The resolver of the chaincodes called by `InvokeChaincode`, or nil.
+//
+// @param: 	spec *APISpec	The APIs added by a spec file, or nil.
+//
+// @param: 	failures *list.List	List which the diagnostics of the functions failing to be analyzed are appended to, or
+//nil.
+//
+// @return:	accesses []*KeyAccess	List of accesses in the order of the functions.
+//
+func analyzeKeyTemplates(ast *Ast, packageVariables []*PackageVariable, fileSet *token.FileSet, filename string,
+	source string, chaincodes *chaincodeResolver, spec *APISpec, failures *list.List) (accesses []*KeyAccess) {
+	accesses = []*KeyAccess{}
+	scope := newFoldScope([]*Ast{ast}, packageVariables, fileSet, map[string]string{filename: source}, chaincodes,
+		spec)
+	functions := findFunctionDeclarations(ast)
+	for x := range functions {
+		var found []*KeyAccess
+		isolateFunction(functions[x], "key templates", failures, func() {
+			_, found = interpretFunction(functions[x], []interface{}{}, scope)
+		})
+		for y := range found {
+			found[y].Function = findFunctionName(functions[x])
+		}
+		accesses = append(accesses, found...)
+	}
+	return accesses
+}
+
+// @title:	sameKeyNamespace
+//
+// @description:	This is used to determine if two accesses may be in the same namespace, which is the world state or a
+//private data collection of a chaincode. Keys in different namespaces never conflict.
+//
+// @param: 	a *KeyAccess	An access.
+//
+// @param: 	b *KeyAccess	Another access.
+//
+// @return:	bool		If it is not proven that the namespaces differ, return true, otherwise return false.
+//
+func sameKeyNamespace(a *KeyAccess, b *KeyAccess) bool {
+	if a.Chaincode != b.Chaincode {
+		return false
+	} else if a.Collection == nil || b.Collection == nil {
+		return a.Collection == nil && b.Collection == nil
+	}
+	return !keyTemplatesDisjoint(a.Collection, b.Collection)
+}
+
+// @title:	formatKeyAccess
+//
+// @description:	This is used to format the key of an access, after its collection for private data and the chaincode
+//it belongs to when it is not this one.
+//
+// @param: 	access *KeyAccess	The access.
+//
+// @param: 	format func(*KeyTemplate) string	The function formatting a template.
+//
+// @return:	string		The formatted key.
+//
+func formatKeyAccess(access *KeyAccess, format func(*KeyTemplate) string) string {
+	key := format(access.Key)
+	if access.End != nil {
+		key = "[" + key + ", " + format(access.End) + ")"
+	}
+	if access.Collection != nil {
+		key = format(access.Collection) + ": " + key
+	}
+	if access.Chaincode != "" {
+		key = "[" + access.Chaincode + "] " + key
+	}
+	return key
+}
+
+// @title:	printKeyTemplates
+//
+// @description:	This is used to print the key template of every access, then the families of keys, which are the
+//templates with the same shape in the same collection, and which families are proven disjoint.
+//
+// @param: 	accesses []*KeyAccess	List of accesses.
+//
+// @param: 	fileSet *token.FileSet	The file set which the source code is parsed with.
+//
+func printKeyTemplates(accesses []*KeyAccess, fileSet *token.FileSet) {
+	if len(accesses) == 0 {
+		return
+	}
+	fmt.Print("\n\nKey templates:\n")
+	families := []*KeyAccess{}
+	members := map[string][]string{}
+	for x := range accesses {
+		via := ""
+		if len(accesses[x].Via) != 0 {
+			via = " via " + strings.Join(accesses[x].Via, ", ")
+		}
+		fmt.Printf("%s line %d: %s %s%s\n", accesses[x].Function, lineOf(fileSet, accesses[x].Site.Pos),
+			accesses[x].API, formatKeyAccess(accesses[x], formatKeyTemplate), via)
+		// A range is not a family of keys.
+		if accesses[x].End != nil {
+			continue
+		}
+		shape := formatKeyAccess(accesses[x], formatKeyShape)
+		if _, ok := members[shape]; !ok {
+			families = append(families, accesses[x])
+		}
+		if list := members[shape]; len(list) == 0 || list[len(list)-1] != accesses[x].Function {
+			members[shape] = append(list, accesses[x].Function)
+		}
+	}
+	if len(families) == 0 {
+		return
+	}
+	fmt.Print("\nKey families:\n")
+	for x := range families {
+		shape := formatKeyAccess(families[x], formatKeyShape)
+		fmt.Printf("%d %s: %s\n", x+1, shape, strings.Join(members[shape], ", "))
+	}
+	for x := range families {
+		for y := x + 1; y < len(families); y++ {
+			relation := "may overlap"
+			if !sameKeyNamespace(families[x], families[y]) {
+				relation = "disjoint namespaces"
+			} else if keyTemplatesDisjoint(families[x].Key, families[y].Key) {
+				relation = "disjoint"
+			}
+			fmt.Printf("%d and %d: %s\n", x+1, y+1, relation)
+		}
+	}
+}
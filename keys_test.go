@@ -0,0 +1,76 @@
+package stcpsce
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+func TestDocumentedConstPrefix(t *testing.T) {
+	analysis := analyzeTestSource(t, `package main
+
+import "github.com/hyperledger/fabric/core/chaincode/shim"
+
+type SmartContract struct{}
+
+// prefix is the prefix of the keys of the balances.
+const prefix = "balance_"
+
+func (s *SmartContract) Pay(stub shim.ChaincodeStubInterface, account string) {
+	stub.PutState(prefix+account, []byte("1"))
+}
+`)
+	if len(analysis.Accesses) != 1 {
+		t.Fatalf("accesses = %d, want 1", len(analysis.Accesses))
+	}
+	if got := formatKeyAccess(analysis.Accesses[0], formatKeyTemplate); got != `"balance_" + {account}` {
+		t.Errorf("key = %s", got)
+	}
+}
+
+func TestFoldKeyPrefixes(t *testing.T) {
+	analysis := analyzeTestSource(t, `package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+type SmartContract struct{}
+
+var namespace = hexdigest("bank")[:6]
+
+func hexdigest(str string) string {
+	hash := sha256.New()
+	hash.Write([]byte(str))
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func (s *SmartContract) Open(stub shim.ChaincodeStubInterface, args []string) {
+	stub.PutState(namespace+args[0], []byte("1"))
+	stub.PutState(fmt.Sprintf("%s_%d", strings.ToUpper("user"), 7), []byte("1"))
+	stub.PutState(hexdigest(args[0])[:4], []byte("1"))
+}
+`)
+	sum := sha256.Sum256([]byte("bank"))
+	want := []string{
+		`"` + hex.EncodeToString(sum[:])[:6] + `" + {args[0]}`,
+		`"USER_7"`,
+		`{hexdigest(args[0])[:4]}`,
+	}
+	if len(analysis.Accesses) != len(want) {
+		t.Fatalf("accesses = %d, want %d", len(analysis.Accesses), len(want))
+	}
+	for x := range want {
+		if got := formatKeyAccess(analysis.Accesses[x], formatKeyTemplate); got != want[x] {
+			t.Errorf("key %d = %s, want %s", x, got, want[x])
+		}
+	}
+	if !keyTemplatesDisjoint(analysis.Accesses[0].Key, analysis.Accesses[1].Key) {
+		t.Errorf("the folded prefixes are not proven disjoint")
+	}
+}
@@ -0,0 +1,536 @@
+package stcpsce
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// The severities of the diagnostics of the Language Server Protocol.
+const (
+	lspError       = 1
+	lspWarning     = 2
+	lspInformation = 3
+	lspHint        = 4
+)
+
+// lspMessage holds a request, a notification or a response of JSON-RPC.
+type lspMessage struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+}
+
+// lspResponse holds a response of JSON-RPC, whose result is null when there is nothing to return.
+type lspResponse struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id"`
+	Result  interface{}      `json:"result"`
+}
+
+// lspErrorResponse holds a response of JSON-RPC to a request which fails.
+type lspErrorResponse struct {
+	JSONRPC string            `json:"jsonrpc"`
+	ID      *json.RawMessage  `json:"id"`
+	Error   *lspResponseError `json:"error"`
+}
+
+// lspResponseError holds the error of a response.
+type lspResponseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// lspNotification holds a notification sent to the client.
+type lspNotification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+// LSPPosition holds a line and a character of a document, counting from 0 in UTF-16 code units.
+type LSPPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+// LSPRange holds the start and the end of a region, the end excluded.
+type LSPRange struct {
+	Start LSPPosition `json:"start"`
+	End   LSPPosition `json:"end"`
+}
+
+// LSPDiagnostic describes a finding in a document.
+type LSPDiagnostic struct {
+	Range    LSPRange `json:"range"`
+	Severity int      `json:"severity"`
+	Code     string   `json:"code,omitempty"`
+	Source   string   `json:"source"`
+	Message  string   `json:"message"`
+}
+
+// LSPCodeLens holds the title shown above a line, with no command to run.
+type LSPCodeLens struct {
+	Range   LSPRange `json:"range"`
+	Command struct {
+		Title   string `json:"title"`
+		Command string `json:"command"`
+	} `json:"command"`
+}
+
+// LSPDocument
+//
+// @description:	This is used to hold an open document and the results of its last analysis.
+//
+type LSPDocument struct {
+	URI    string
+	Source string
+	// Analysis is nil when the document cannot be parsed or analyzed.
+	Analysis    *Analysis
+	Summaries   []*AccessSummary
+	Edges       []*ConflictEdge
+	Diagnostics []LSPDiagnostic
+}
+
+// @title:	lspPositionAt
+//
+// @description:	This is used to convert an offset of the source code to a position of the Language Server Protocol.
+//
+// @param: 	source string	The source code.
+//
+// @param: 	offset int	The offset.
+//
+// @return:	LSPPosition	The position in the document.
+//
+func lspPositionAt(source string, offset int) LSPPosition {
+	if offset > len(source) {
+		offset = len(source)
+	}
+	start := strings.LastIndex(source[:offset], "\n") + 1
+	character := 0
+	for _, r := range source[start:offset] {
+		if r >= 0x10000 {
+			character += 2
+		} else {
+			character++
+		}
+	}
+	return LSPPosition{Line: strings.Count(source[:start], "\n"), Character: character}
+}
+
+// @title:	lspPositionOf
+//
+// @description:	This is used to convert a position of the file set to a position of the Language Server Protocol.
+//
+// @param: 	fileSet *token.FileSet	The file set which the source code is parsed with.
+//
+// @param: 	source string	The source code.
+//
+// @param: 	pos int	The position.
+//
+// @return:	LSPPosition	The position in the document.
+//
+func lspPositionOf(fileSet *token.FileSet, source string, pos int) LSPPosition {
+	return lspPositionAt(source, fileSet.Position(token.Pos(pos)).Offset)
+}
+
+// @title:	lspOffsetOf
+//
+// @description:	This is used to convert a position of the Language Server Protocol to an offset of the source code.
+//
+// @param: 	source string	The source code.
+//
+// @param: 	position LSPPosition	The position in the document.
+//
+// @return:	offset int	The offset, or -1 if the line is out of the document.
+//
+func lspOffsetOf(source string, position LSPPosition) (offset int) {
+	for line := 0; line < position.Line; line++ {
+		next := strings.IndexByte(source[offset:], '\n')
+		if next < 0 {
+			return -1
+		}
+		offset += next + 1
+	}
+	for character := 0; character < position.Character && offset < len(source) && source[offset] != '\n'; {
+		r, size := utf8.DecodeRuneInString(source[offset:])
+		if r >= 0x10000 {
+			character += 2
+		} else {
+			character++
+		}
+		offset += size
+	}
+	return offset
+}
+
+// @title:	newLSPDiagnostic
+//
+// @description:	This is used to create the diagnostic of a region of a document.
+//
+// @param: 	document *LSPDocument	The document.
+//
+// @param: 	analysis *Analysis	The results of the analyses of the document.
+//
+// @param: 	ast *Ast	The node of the region.
+//
+// @param: 	severity int	The severity of the diagnostic.
+//
+// @param: 	code string	The rule of the diagnostic.
+//
+// @param: 	message string	The message of the diagnostic.
+//
+// @return:	LSPDiagnostic	The diagnostic.
+//
+func newLSPDiagnostic(document *LSPDocument, analysis *Analysis, ast *Ast, severity int, code string,
+	message string) LSPDiagnostic {
+	return LSPDiagnostic{Range: LSPRange{Start: lspPositionOf(analysis.FileSet, document.Source, ast.Pos),
+		End: lspPositionOf(analysis.FileSet, document.Source, ast.End)}, Severity: severity, Code: code,
+		Source: "STCPSCE", Message: message}
+}
+
+// @title:	analyzeLSPDocument
+//
+// @description:	This is used to parse and analyze a document. The syntax errors are reported with the declarations
+//skipped because of them, then the chains of Phase 1, the arguments of Phase 2 and the findings of the analyses of
+//concurrency and nondeterminism. An analysis failing on an unusual shape of the source code is reported instead of
+//stopping the server.
+//
+// @param: 	document *LSPDocument	The document, whose results are replaced.
+//
+func analyzeLSPDocument(document *LSPDocument) {
+	document.Analysis, document.Summaries, document.Edges = nil, nil, nil
+	document.Diagnostics = []LSPDiagnostic{}
+	filename := document.URI
+	if u, err := url.Parse(document.URI); err == nil && u.Path != "" {
+		filename = u.Path
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			document.Analysis, document.Summaries, document.Edges = nil, nil, nil
+			document.Diagnostics = []LSPDiagnostic{{Severity: lspError, Source: "STCPSCE",
+				Message: fmt.Sprint("analysis failed: ", r)}}
+		}
+	}()
+	analysis, err := analyzeSource(filename, document.Source, nil, nil)
+	if err != nil {
+		list, ok := err.(scanner.ErrorList)
+		if !ok {
+			list = scanner.ErrorList{{Msg: err.Error()}}
+		}
+		for _, e := range list {
+			start := lspPositionAt(document.Source, e.Pos.Offset)
+			document.Diagnostics = append(document.Diagnostics, LSPDiagnostic{Range: LSPRange{Start: start, End: start},
+				Severity: lspError, Code: "syntax", Source: "STCPSCE", Message: e.Msg})
+		}
+	}
+	if analysis == nil {
+		return
+	}
+	for _, skipped := range analysis.Skipped {
+		document.Diagnostics = append(document.Diagnostics, newLSPDiagnostic(document, analysis,
+			&Ast{Pos: skipped.Pos, End: skipped.End}, lspWarning, "skipped", "analysis skipped, "+skipped.Reason))
+	}
+	for _, chain := range analysis.Chains {
+		document.Diagnostics = append(document.Diagnostics, newLSPDiagnostic(document, analysis, chain[0],
+			lspInformation, "parallelizable-chain", describeChain(chain, analysis.FileSet)))
+	}
+	functions := findFunctionDeclarations(analysis.Ast)
+	for x := range functions {
+		name := findFunctionName(functions[x])
+		if len(analysis.GetStateMap[name]) == 0 && len(analysis.PutStateMap[name]) == 0 {
+			continue
+		}
+		document.Diagnostics = append(document.Diagnostics, newLSPDiagnostic(document, analysis,
+			findChild(functions[x], "Name"), lspHint, "readwrite",
+			describeReadWriteAPI(name, analysis.GetStateMap, analysis.PutStateMap)))
+	}
+	for _, failure := range analysis.Failures {
+		document.Diagnostics = append(document.Diagnostics, newLSPDiagnostic(document, analysis,
+			&Ast{Pos: failure.Pos, End: failure.End}, lspWarning, failure.Rule, failure.Message))
+	}
+	diagnostics := append(append([]*Diagnostic{}, analysis.Diagnostics...), analysis.Nondeterminism...)
+	for x := range diagnostics {
+		document.Diagnostics = append(document.Diagnostics, newLSPDiagnostic(document, analysis,
+			&Ast{Pos: diagnostics[x].Pos, End: diagnostics[x].End}, lspWarning, diagnostics[x].Rule,
+			diagnostics[x].Message))
+	}
+	document.Summaries = analysis.Summaries
+	document.Edges = analysis.Conflicts
+	document.Analysis = analysis
+}
+
+// @title:	lspHover
+//
+// @description:	This is used to find the hover text of a position, the summary of the keys read and written by the
+//function around it.
+//
+// @param: 	document *LSPDocument	The document.
+//
+// @param: 	position LSPPosition	The position in the document.
+//
+// @return:	interface{}	The hover, or nil if there is none.
+//
+func lspHover(document *LSPDocument, position LSPPosition) interface{} {
+	analysis := document.Analysis
+	if analysis == nil {
+		return nil
+	}
+	offset := lspOffsetOf(document.Source, position)
+	if offset < 0 {
+		return nil
+	}
+	pos := int(analysis.FileSet.File(token.Pos(analysis.Ast.Pos)).Pos(offset))
+	functions := findFunctionDeclarations(analysis.Ast)
+	for x := range functions {
+		if pos < functions[x].Pos || pos >= functions[x].End {
+			continue
+		}
+		name := findFunctionName(functions[x])
+		for _, summary := range document.Summaries {
+			if summary.Function != name {
+				continue
+			}
+			text := []string{fmt.Sprintf("**%s** accesses %d keys:\n", name, len(summary.Keys))}
+			for y := range summary.Keys {
+				text = append(text, fmt.Sprintf("- K%d %s `%s`", y+1, summary.Kinds[y],
+					formatKeyAccess(summary.Keys[y], formatKeyTemplate)))
+			}
+			steps := []string{}
+			for y := range summary.Trace {
+				operation := "R"
+				if summary.Trace[y].Write {
+					operation = "W"
+				}
+				steps = append(steps, fmt.Sprintf("%s K%d (line %d)", operation, summary.Steps[y]+1,
+					lineOf(analysis.FileSet, summary.Trace[y].Site.Pos)))
+			}
+			text = append(text, "", "Trace: "+strings.Join(steps, ", "))
+			return map[string]interface{}{"contents": map[string]string{"kind": "markdown",
+				"value": strings.Join(text, "\n")}, "range": LSPRange{Start: lspPositionOf(analysis.FileSet,
+				document.Source, functions[x].Pos), End: lspPositionOf(analysis.FileSet, document.Source,
+				functions[x].End)}}
+		}
+		return nil
+	}
+	return nil
+}
+
+// @title:	lspCodeLenses
+//
+// @description:	This is used to create the code lens above every handler of `Invoke`, with the number of statements
+//of its chain and the handlers it conflicts with.
+//
+// @param: 	document *LSPDocument	The document.
+//
+// @return:	lenses []LSPCodeLens	List of code lenses.
+//
+func lspCodeLenses(document *LSPDocument) (lenses []LSPCodeLens) {
+	lenses = []LSPCodeLens{}
+	analysis := document.Analysis
+	if analysis == nil {
+		return lenses
+	}
+	handlers := map[string]bool{}
+	for _, name := range findTransactions(analysis.Ast) {
+		handlers[name] = true
+	}
+	functions := findFunctionDeclarations(analysis.Ast)
+	for x := range functions {
+		name := findFunctionName(functions[x])
+		if !handlers[name] {
+			continue
+		}
+		statements := 0
+		for _, chain := range analysis.Chains {
+			if chain[0].Pos >= functions[x].Pos && chain[0].End <= functions[x].End {
+				statements += len(chain)
+			}
+		}
+		conflicts := []string{}
+		for _, edge := range document.Edges {
+			if edge.From == name {
+				conflicts = append(conflicts, edge.To)
+			} else if edge.To == name {
+				conflicts = append(conflicts, edge.From)
+			}
+		}
+		if len(conflicts) == 0 {
+			conflicts = append(conflicts, "none")
+		}
+		lens := LSPCodeLens{}
+		start := lspPositionOf(analysis.FileSet, document.Source, functions[x].Pos)
+		lens.Range = LSPRange{Start: start, End: start}
+		lens.Command.Title = fmt.Sprintf("parallelizable: %d statements; conflicts with: %s", statements,
+			strings.Join(conflicts, ", "))
+		lenses = append(lenses, lens)
+	}
+	return lenses
+}
+
+// @title:	readLSPMessage
+//
+// @description:	This is used to read a message framed by its `Content-Length` header.
+//
+// @param: 	reader *bufio.Reader	The input of the server.
+//
+// @return:	message *lspMessage	The message.
+//
+// @return:	err error	If a message can be read, return nil, otherwise return an error.
+//
+func readLSPMessage(reader *bufio.Reader) (message *lspMessage, err error) {
+	length := -1
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if strings.HasPrefix(strings.ToLower(line), "content-length:") {
+			length, err = strconv.Atoi(strings.TrimSpace(line[len("content-length:"):]))
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("message without Content-Length")
+	}
+	body := make([]byte, length)
+	if _, err = io.ReadFull(reader, body); err != nil {
+		return nil, err
+	}
+	message = &lspMessage{}
+	return message, json.Unmarshal(body, message)
+}
+
+// @title:	writeLSPMessage
+//
+// @description:	This is used to write a message framed by its `Content-Length` header.
+//
+// @param: 	writer io.Writer	The output of the server.
+//
+// @param: 	message interface{}	The message.
+//
+// @return:	err error	If the message can be written, return nil, otherwise return an error.
+//
+func writeLSPMessage(writer io.Writer, message interface{}) (err error) {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(writer, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return err
+}
+
+// @title:	runLanguageServer
+//
+// @description:	This is used to serve the Language Server Protocol until the client exits. A document is analyzed
+//whenever it is opened or changed, which publishes its diagnostics, and its results answer the hovers and the code
+//lenses. The documents are synchronized in full.
+//
+// @param: 	input io.Reader	The input of the server.
+//
+// @param: 	output io.Writer	The output of the server.
+//
+// @return:	err error	If the client exits after a shutdown, return nil, otherwise return an error.
+//
+func runLanguageServer(input io.Reader, output io.Writer) (err error) {
+	reader := bufio.NewReader(input)
+	documents := map[string]*LSPDocument{}
+	shutdown := false
+	publish := func(document *LSPDocument) error {
+		return writeLSPMessage(output, lspNotification{JSONRPC: "2.0", Method: "textDocument/publishDiagnostics",
+			Params: map[string]interface{}{"uri": document.URI, "diagnostics": document.Diagnostics}})
+	}
+	for {
+		message, err := readLSPMessage(reader)
+		if err != nil {
+			return err
+		}
+		var params struct {
+			TextDocument struct {
+				URI  string `json:"uri"`
+				Text string `json:"text"`
+			} `json:"textDocument"`
+			ContentChanges []struct {
+				Text string `json:"text"`
+			} `json:"contentChanges"`
+			Position LSPPosition `json:"position"`
+		}
+		if len(message.Params) != 0 {
+			if err = json.Unmarshal(message.Params, &params); err != nil {
+				return err
+			}
+		}
+		var result interface{}
+		var responseError *lspResponseError
+		document := documents[params.TextDocument.URI]
+		switch message.Method {
+		case "initialize":
+			result = map[string]interface{}{"capabilities": map[string]interface{}{"textDocumentSync": 1,
+				"hoverProvider": true, "codeLensProvider": map[string]bool{"resolveProvider": false}},
+				"serverInfo": map[string]string{"name": "STCPSCE"}}
+		case "textDocument/didOpen":
+			document = &LSPDocument{URI: params.TextDocument.URI, Source: params.TextDocument.Text}
+			documents[document.URI] = document
+			analyzeLSPDocument(document)
+			err = publish(document)
+		case "textDocument/didChange":
+			if document != nil && len(params.ContentChanges) != 0 {
+				document.Source = params.ContentChanges[len(params.ContentChanges)-1].Text
+				analyzeLSPDocument(document)
+				err = publish(document)
+			}
+		case "textDocument/didClose":
+			if document != nil {
+				delete(documents, document.URI)
+				document.Diagnostics = []LSPDiagnostic{}
+				err = publish(document)
+			}
+		case "textDocument/hover":
+			if document != nil {
+				result = lspHover(document, params.Position)
+			}
+		case "textDocument/codeLens":
+			if document != nil {
+				result = lspCodeLenses(document)
+			} else {
+				result = []LSPCodeLens{}
+			}
+		case "shutdown":
+			shutdown = true
+		case "exit":
+			if !shutdown {
+				return fmt.Errorf("exit before shutdown")
+			}
+			return nil
+		default:
+			if message.ID != nil {
+				responseError = &lspResponseError{Code: -32601, Message: "method not found: " + message.Method}
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if message.ID != nil && responseError != nil {
+			err = writeLSPMessage(output, lspErrorResponse{JSONRPC: "2.0", ID: message.ID, Error: responseError})
+		} else if message.ID != nil {
+			err = writeLSPMessage(output, lspResponse{JSONRPC: "2.0", ID: message.ID, Result: result})
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package stcpsce
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// lspTestMessage holds a message written by the server in a test.
+type lspTestMessage struct {
+	ID     *int            `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  json.RawMessage `json:"error"`
+}
+
+// @title:	runTestLanguageServer
+//
+// @description:	This is used to serve the requests and the notifications of a test, each of them given as its
+//method and parameters, and read the messages written by the server.
+//
+// @param: 	t *testing.T	The test.
+//
+// @param: 	messages []string	The messages, in pairs of the method and the JSON of the parameters. The id of a
+//request is its index, and the parameters of a notification start with `!`.
+//
+// @return:	[]lspTestMessage	The messages written by the server.
+//
+// @return:	error	The error returned by the server.
+//
+func runTestLanguageServer(t *testing.T, messages ...string) ([]lspTestMessage, error) {
+	t.Helper()
+	input := &bytes.Buffer{}
+	for x := 0; x < len(messages); x += 2 {
+		message := map[string]interface{}{"jsonrpc": "2.0", "method": messages[x]}
+		params := messages[x+1]
+		if strings.HasPrefix(params, "!") {
+			params = params[1:]
+		} else {
+			message["id"] = x / 2
+		}
+		if params != "" {
+			message["params"] = json.RawMessage(params)
+		}
+		if err := writeLSPMessage(input, message); err != nil {
+			t.Fatal(err)
+		}
+	}
+	output := &bytes.Buffer{}
+	err := runLanguageServer(input, output)
+	reader := bufio.NewReader(output)
+	written := []lspTestMessage{}
+	for {
+		header, e := reader.ReadString('\n')
+		if e == io.EOF {
+			break
+		} else if e != nil {
+			t.Fatal(e)
+		}
+		length, e := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(header, "Content-Length:")))
+		if e != nil {
+			t.Fatal(e)
+		}
+		reader.ReadString('\n')
+		body := make([]byte, length)
+		if _, e = io.ReadFull(reader, body); e != nil {
+			t.Fatal(e)
+		}
+		message := lspTestMessage{}
+		if e = json.Unmarshal(body, &message); e != nil {
+			t.Fatal(e)
+		}
+		written = append(written, message)
+	}
+	return written, err
+}
+
+func TestLanguageServer(t *testing.T) {
+	source := `package main
+
+import "github.com/hyperledger/fabric/core/chaincode/shim"
+
+type SmartContract struct{}
+
+func (s *SmartContract) Set(stub shim.ChaincodeStubInterface, args []string) {
+	stub.PutState(args[0], []byte(args[1]))
+}
+
+func (s *SmartContract) Get(stub shim.ChaincodeStubInterface, args []string) {
+	stub.GetState(args[0])
+}
+`
+	text, _ := json.Marshal(source)
+	document := `{"textDocument": {"uri": "file:///tmp/ledger.go"`
+	messages, err := runTestLanguageServer(t,
+		"initialize", `{}`,
+		"textDocument/didOpen", "!"+document+`, "text": `+string(text)+`}}`,
+		"textDocument/hover", document+`}, "position": {"line": 7, "character": 1}}`,
+		"textDocument/codeLens", document+`}}`,
+		"textDocument/didChange", "!"+document+`}, "contentChanges": [{"text": "package main\nfunc F( {\n"}]}`,
+		"workspace/symbol", `{}`,
+		"shutdown", ``,
+		"exit", `!`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 7 {
+		t.Fatalf("the server writes %d messages, want 7", len(messages))
+	}
+	for _, want := range []struct {
+		index    int
+		field    json.RawMessage
+		contains string
+	}{
+		{0, messages[0].Result, `"hoverProvider":true`},
+		{1, messages[1].Params, `"code":"readwrite","source":"STCPSCE",` +
+			`"message":"Set reads keys from arguments [] and writes keys from arguments [1]"`},
+		{2, messages[2].Result, "**Set** accesses 1 keys:\\n\\n- K1 blind-write `{args[0]}`\\n\\nTrace: W K1 (line 8)"},
+		{3, messages[3].Result, `"title":"parallelizable: 0 statements; conflicts with: Set, Get"`},
+		{3, messages[3].Result, `"title":"parallelizable: 0 statements; conflicts with: Set"`},
+		{4, messages[4].Params, `{"range":{"start":{"line":1,"character":8},"end":{"line":1,"character":8}},` +
+			`"severity":1,"code":"syntax","source":"STCPSCE","message":"expected ')', found '{'"}`},
+		{5, messages[5].Error, `"code":-32601`},
+	} {
+		if !strings.Contains(string(want.field), want.contains) {
+			t.Errorf("message %d = %s, want it to contain %s", want.index, want.field, want.contains)
+		}
+	}
+	if messages[6].ID == nil || *messages[6].ID != 6 {
+		t.Errorf("the shutdown is answered with the id %v", messages[6].ID)
+	}
+}
+
+func TestLanguageServerExitBeforeShutdown(t *testing.T) {
+	messages, err := runTestLanguageServer(t, "initialize", `{}`, "exit", `!`)
+	if err == nil || err.Error() != "exit before shutdown" {
+		t.Errorf("err = %v, want the exit before shutdown", err)
+	}
+	if len(messages) != 1 {
+		t.Errorf("the server writes %d messages, want 1", len(messages))
+	}
+}
+
+func TestLSPPositions(t *testing.T) {
+	source := "a\n\U0001F600é x\n"
+	offset := strings.Index(source, "x")
+	position := lspPositionAt(source, offset)
+	if position != (LSPPosition{Line: 1, Character: 4}) {
+		t.Errorf("lspPositionAt = %+v, want line 1, character 4", position)
+	}
+	if got := lspOffsetOf(source, position); got != offset {
+		t.Errorf("lspOffsetOf = %d, want %d", got, offset)
+	}
+	if got := lspOffsetOf(source, LSPPosition{Line: 3}); got != -1 {
+		t.Errorf("lspOffsetOf of a line out of the document = %d, want -1", got)
+	}
+}
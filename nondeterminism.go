@@ -0,0 +1,556 @@
+package stcpsce
+
+import (
+	"container/list"
+	"fmt"
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// nondeterministicPackages maps the import paths whose calls are nondeterministic to the rule reporting them.
+// `time` only counts for the functions reading the clock.
+var nondeterministicPackages = map[string]string{
+	"math/rand":    "nondeterminism-random",
+	"math/rand/v2": "nondeterminism-random",
+	"crypto/rand":  "nondeterminism-random",
+	"time":         "nondeterminism-time",
+	"os":           "nondeterminism-io",
+	"os/exec":      "nondeterminism-io",
+	"io/ioutil":    "nondeterminism-io",
+	"net":          "nondeterminism-io",
+	"net/http":     "nondeterminism-io",
+	"syscall":      "nondeterminism-io",
+}
+
+// @title:	findImports
+//
+// @description:	This is used to map the names the imported packages are referred by to their paths.
+//
+// @param: 	ast *Ast	The root node of the file.
+//
+// @return:	imports map[string]string	Map of package names to import paths.
+//
+func findImports(ast *Ast) (imports map[string]string) {
+	imports = map[string]string{}
+	var walk func(node *Ast)
+	walk = func(node *Ast) {
+		if strings.Contains(node.Label, "ImportSpec") {
+			path := ""
+			name := ""
+			for x := range node.Children {
+				if strings.HasPrefix(node.Children[x].Label, "Path") {
+					path, _ = strconv.Unquote(node.Children[x].Attrs["Value"])
+				} else if strings.HasPrefix(node.Children[x].Label, "Name") {
+					name = node.Children[x].Attrs["Name"]
+				}
+			}
+			if name == "" {
+				name = path[strings.LastIndex(path, "/")+1:]
+				if strings.HasPrefix(name, "v") && strings.Contains(path, "/") {
+					if _, err := strconv.Atoi(name[1:]); err == nil {
+						name = path[:strings.LastIndex(path, "/")]
+						name = name[strings.LastIndex(name, "/")+1:]
+					}
+				}
+			}
+			imports[name] = path
+			return
+		}
+		for x := range node.Children {
+			walk(node.Children[x])
+		}
+	}
+	for x := range ast.Children {
+		if strings.Contains(ast.Children[x].Label, "Decls") {
+			walk(ast.Children[x])
+		}
+	}
+	return imports
+}
+
+// @title:	findPackageVariables
+//
+// @description:	This is used to find the variables declared at package level.
+//
+// @param: 	ast *Ast	The root node of the file.
+//
+// @return:	variables []*Ast	List of `ValueSpec` nodes of package-level variables.
+//
+func findPackageVariables(ast *Ast) (variables []*Ast) {
+	variables = []*Ast{}
+	for x := range ast.Children {
+		if !strings.Contains(ast.Children[x].Label, "Decls") {
+			continue
+		}
+		for y := range ast.Children[x].Children {
+			decl := ast.Children[x].Children[y]
+			if strings.Contains(decl.Label, "GenDecl") && strings.Contains(decl.Label, "Tok: var") {
+				// A declaration with a comment has its `Doc` before its `Specs`.
+				variables = append(variables, findChild(decl, "Specs").Children...)
+			}
+		}
+	}
+	return variables
+}
+
+// @title:	findValueSpecNames
+//
+// @description:	This is used to get the names declared by a `ValueSpec`.
+//
+// @param: 	ast *Ast	The `ValueSpec` node.
+//
+// @return:	names []*Ast	List of `Ident` nodes.
+//
+func findValueSpecNames(ast *Ast) (names []*Ast) {
+	for x := range ast.Children {
+		if strings.HasPrefix(ast.Children[x].Label, "Names") {
+			return ast.Children[x].Children
+		}
+	}
+	return []*Ast{}
+}
+
+// @title:	findMutatedPackageVariables
+//
+// @description:	This is used to find the statements of the functions which assign package-level variables.
+// A function defining a local variable with the same name is skipped for that name.
+//
+// @param: 	ast *Ast	The root node of the file.
+//
+// @param: 	failures *list.List	List which the diagnostics of the functions failing to be analyzed are appended to, or
+//nil.
+//
+// @return:	statements map[string][]*Ast	Map of variable names to the statements assigning them.
+//
+// @return:	functions map[*Ast]string	Map of the statements to the names of the functions they are in.
+//
+func findMutatedPackageVariables(ast *Ast, failures *list.List) (statements map[string][]*Ast,
+	functions map[*Ast]string) {
+	statements = map[string][]*Ast{}
+	functions = map[*Ast]string{}
+	globals := list.New()
+	variables := findPackageVariables(ast)
+	for x := range variables {
+		names := findValueSpecNames(variables[x])
+		for y := range names {
+			globals.PushBack(names[y])
+		}
+	}
+	declarations := findFunctionDeclarations(ast)
+	for x := range declarations {
+		body := findFunctionBody(declarations[x])
+		if body == nil {
+			continue
+		}
+		// The statements of a function are kept only if it does not fail.
+		names := []string{}
+		assignments := []*Ast{}
+		isolateFunction(declarations[x], "package variables", failures, func() {
+			locals := findDefinedLabels(body)
+			arguments := findFunctionArguments(declarations[x])
+			for y := range arguments {
+				locals.PushBack(arguments[y])
+			}
+			var walk func(node *Ast)
+			walk = func(node *Ast) {
+				if left, _, kind := splitStatement(node); kind == statementAssignment || kind == statementUpdate {
+					for y := range left.Children {
+						root := findRootLabel(left.Children[y])
+						if root == nil {
+							continue
+						}
+						for e := globals.Front(); e != nil; e = e.Next() {
+							if !astNodeEqual(root, e.Value.(*Ast)) {
+								continue
+							}
+							shadowed := false
+							for l := locals.Front(); l != nil; l = l.Next() {
+								if astNodeEqual(root, l.Value.(*Ast)) {
+									shadowed = true
+								}
+							}
+							if !shadowed {
+								names = append(names, root.Attrs["Name"])
+								assignments = append(assignments, node)
+							}
+						}
+					}
+				}
+				for y := range node.Children {
+					walk(node.Children[y])
+				}
+			}
+			walk(body)
+			for y := range assignments {
+				statements[names[y]] = append(statements[names[y]], assignments[y])
+				functions[assignments[y]] = findFunctionName(declarations[x])
+			}
+		})
+	}
+	return statements, functions
+}
+
+// @title:	containsTaint
+//
+// @description:	This is used to determine if a node contains the source of a nondeterministic value or reads a
+//label holding one.
+//
+// @param: 	ast *Ast	The node which needs to be determined.
+//
+// @param: 	source *Ast	The source of the nondeterministic value.
+//
+// @param: 	tainted *list.List	List of labels holding the nondeterministic value.
+//
+// @return:	bool		If the node contains the source or a tainted label, return true, otherwise return false.
+//
+func containsTaint(ast *Ast, source *Ast, tainted *list.List) bool {
+	if ast == source {
+		return true
+	} else if strings.Contains(ast.Label, "*ast.Ident") && !strings.HasPrefix(ast.Label, "Sel") &&
+		!strings.HasPrefix(ast.Label, "Key") && !strings.HasPrefix(ast.Label, "Fun") {
+		for e := tainted.Front(); e != nil; e = e.Next() {
+			if astNodeEqual(ast, e.Value.(*Ast)) {
+				return true
+			}
+		}
+	}
+	for x := range ast.Children {
+		if containsTaint(ast.Children[x], source, tainted) {
+			return true
+		}
+	}
+	return false
+}
+
+// @title:	traceTaint
+//
+// @description:	This is used to find the state writes a nondeterministic value can reach in a function.
+// Every label assigned from the source or from a tainted label is tainted, in the order of the statements. The
+// labels a `range` over a map assigns, inside and as its key and value, depend on the order of the iteration.
+//
+// @param: 	ast *Ast	The body of the function.
+//
+// @param: 	source *Ast	The source of the nondeterministic value.
+//
+// @param: 	PutStateMap map[string][]int	Map of `PutState` expressions in the function.
+//
+// @param: 	spec *APISpec	The APIs added by a spec file, or nil.
+//
+// @return:	writes []*Ast	List of `CallExpr` nodes writing state which the value reaches.
+//
+// @return:	returned bool	If the value reaches a `return` statement.
+//
+func traceTaint(ast *Ast, source *Ast, PutStateMap map[string][]int, spec *APISpec) (writes []*Ast, returned bool) {
+	writes = []*Ast{}
+	tainted := list.New()
+	if strings.Contains(source.Label, "RangeStmt") {
+		for x := range source.Children {
+			if strings.HasPrefix(source.Children[x].Label, "Key") || strings.HasPrefix(source.Children[x].Label, "Value") {
+				tainted.PushBack(source.Children[x])
+			}
+		}
+		var walk func(node *Ast)
+		walk = func(node *Ast) {
+			if left, _, kind := splitStatement(node); kind != statementOther {
+				for x := range left.Children {
+					if root := findRootLabel(left.Children[x]); root != nil && root.Attrs["Name"] != "_" {
+						tainted.PushBack(root)
+					}
+				}
+			}
+			for x := range node.Children {
+				walk(node.Children[x])
+			}
+		}
+		walk(findChild(source, "Body"))
+	}
+	var walk func(node *Ast)
+	walk = func(node *Ast) {
+		if left, right, kind := splitStatement(node); kind != statementOther && node.End > source.Pos {
+			if containsTaint(right, source, tainted) || kind == statementUpdate && containsTaint(left, source, tainted) {
+				for x := range left.Children {
+					if root := findRootLabel(left.Children[x]); root != nil && root.Attrs["Name"] != "_" {
+						tainted.PushBack(root)
+					}
+				}
+			}
+		} else if strings.Contains(node.Label, "ReturnStmt") && node.End > source.Pos &&
+			containsTaint(node, source, tainted) {
+			returned = true
+		}
+		for x := range node.Children {
+			walk(node.Children[x])
+		}
+	}
+	walk(ast)
+	calls := findStateWrites(ast, PutStateMap, spec)
+	for x := range calls {
+		if calls[x].End > source.Pos && containsTaint(calls[x].Children[1], source, tainted) {
+			writes = append(writes, calls[x])
+		}
+	}
+	return writes, returned
+}
+
+// @title:	isMapExpression
+//
+// @description:	This is used to determine if a `range` clause iterates over a map, either a map literal, a
+//`make(map...)` or a label declared, defined or passed as a map in the function.
+//
+// @param: 	ast *Ast	The expression which is iterated over.
+//
+// @param: 	function *Ast	The `FuncDecl` node.
+//
+// @return:	bool		If the expression is a map, return true, otherwise return false.
+//
+func isMapExpression(ast *Ast, function *Ast) bool {
+	hasMapType := func(node *Ast) bool {
+		if strings.Contains(node.Label, "MapType") {
+			return true
+		}
+		if strings.Contains(node.Label, "CompositeLit") || strings.Contains(node.Label, "CallExpr") {
+			for x := range node.Children {
+				if strings.Contains(node.Children[x].Label, "MapType") {
+					return true
+				}
+				// `make(map[K]V)` has the type as its first argument.
+				if strings.HasPrefix(node.Children[x].Label, "Args") && len(node.Children[x].Children) != 0 &&
+					strings.Contains(node.Children[x].Children[0].Label, "MapType") {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	if hasMapType(ast) {
+		return true
+	} else if !strings.Contains(ast.Label, "*ast.Ident") {
+		return false
+	}
+	found := false
+	var walk func(node *Ast)
+	walk = func(node *Ast) {
+		if strings.Contains(node.Label, "*ast.Field") || strings.Contains(node.Label, "ValueSpec") {
+			names := []*Ast{}
+			for x := range node.Children {
+				if strings.HasPrefix(node.Children[x].Label, "Names") {
+					names = node.Children[x].Children
+				}
+			}
+			for x := range names {
+				if astNodeEqual(names[x], ast) {
+					for y := range node.Children {
+						if strings.HasPrefix(node.Children[y].Label, "Type") && hasMapType(node.Children[y]) ||
+							strings.HasPrefix(node.Children[y].Label, "Values") && len(node.Children[y].Children) > x &&
+								hasMapType(node.Children[y].Children[x]) {
+							found = true
+						}
+					}
+				}
+			}
+		} else if left, right, kind := splitStatement(node); kind == statementDefinition || kind == statementAssignment {
+			for x := range left.Children {
+				if astNodeEqual(left.Children[x], ast) && len(right.Children) > x && hasMapType(right.Children[x]) {
+					found = true
+				}
+			}
+		}
+		for x := range node.Children {
+			walk(node.Children[x])
+		}
+	}
+	walk(function)
+	return found
+}
+
+// @title:	nondeterministicCallPath
+//
+// @description:	This is used to determine if a node calls a nondeterministic package.
+//
+// @param: 	ast *Ast	The node which needs to be determined.
+//
+// @param: 	imports map[string]string	Map of package names to import paths.
+//
+// @return:	string		The import path of the package, or an empty string if the node is not such a call.
+//
+func nondeterministicCallPath(ast *Ast, imports map[string]string) string {
+	if !strings.Contains(ast.Label, "CallExpr") || !strings.Contains(ast.Children[0].Label, "SelectorExpr") ||
+		!strings.Contains(ast.Children[0].Children[0].Label, "*ast.Ident") {
+		return ""
+	}
+	path := imports[ast.Children[0].Children[0].Attrs["Name"]]
+	selector := ast.Children[0].Children[1].Attrs["Name"]
+	if nondeterministicPackages[path] != "" && (path != "time" || selector == "Now" || selector == "Since" ||
+		selector == "Until") {
+		return path
+	}
+	return ""
+}
+
+// @title:	findNondeterministicSources
+//
+// @description:	This is used to find the sources of nondeterminism in a function: calls to math/rand, time.Now, os
+//and net, `range` over maps, goroutines, reads of package-level variables written at runtime and calls to functions
+//returning a nondeterministic value.
+//
+// @param: 	ast *Ast	The `FuncDecl` node.
+//
+// @param: 	imports map[string]string	Map of package names to import paths.
+//
+// @param: 	mutated map[string][]*Ast	Map of package-level variables to the statements assigning them.
+//
+// @param: 	nondeterministicFunctions map[string]string	Map of functions returning a nondeterministic value to
+//the description of the value.
+//
+// @return:	sources []*Ast	List of nodes producing a nondeterministic value.
+//
+// @return:	rules []string	List of rules, one for each source.
+//
+// @return:	descriptions []string	List of descriptions, one for each source.
+//
+func findNondeterministicSources(ast *Ast, imports map[string]string, mutated map[string][]*Ast,
+	nondeterministicFunctions map[string]string) (sources []*Ast, rules []string, descriptions []string) {
+	written := map[*Ast]bool{}
+	for _, statements := range mutated {
+		for x := range statements {
+			left, _, _ := splitStatement(statements[x])
+			for y := range left.Children {
+				written[findRootLabel(left.Children[y])] = true
+			}
+		}
+	}
+	var walk func(node *Ast)
+	walk = func(node *Ast) {
+		rule, description := "", ""
+		if path := nondeterministicCallPath(node, imports); path != "" {
+			rule, description = nondeterministicPackages[path], "uses "+path
+		} else if strings.Contains(node.Label, "CallExpr") && strings.Contains(node.Children[0].Label, "*ast.Ident") &&
+			nondeterministicFunctions[node.Children[0].Attrs["Name"]] != "" {
+			rule = "nondeterminism-call"
+			description = "returns a nondeterministic value (" + nondeterministicFunctions[node.Children[0].Attrs["Name"]] + ")"
+		} else if strings.Contains(node.Label, "RangeStmt") &&
+			isMapExpression(findChild(node, "X"), ast) {
+			rule, description = "nondeterminism-map-range", "iterates over a map in random order"
+		} else if strings.Contains(node.Label, "GoStmt") {
+			rule, description = "nondeterminism-goroutine", "spawns a goroutine scheduled in random order"
+		} else if strings.Contains(node.Label, "*ast.Ident") && len(mutated[node.Attrs["Name"]]) != 0 && !written[node] &&
+			!strings.HasPrefix(node.Label, "Sel") && !strings.HasPrefix(node.Label, "Key") {
+			rule, description = "nondeterminism-global", "reads package-level variable `"+node.Attrs["Name"]+
+				"` written at runtime"
+		}
+		if rule != "" {
+			sources = append(sources, node)
+			rules = append(rules, rule)
+			descriptions = append(descriptions, description)
+			return
+		}
+		for x := range node.Children {
+			walk(node.Children[x])
+		}
+	}
+	walk(findFunctionBody(ast))
+	return sources, rules, descriptions
+}
+
+// @title:	analyzeNondeterminism
+//
+// @description:	This is used to find the sources of nondeterminism in every function and the state writes they can
+//reach, as well as the statements writing package-level variables. A `range` over a map is only reported when it
+//reaches a state write, because an order-independent use of it is harmless.
+//
+// @param: 	ast *Ast	The root node of the file.
+//
+// @param: 	PutStateMap map[string][]int	Map of `PutState` expressions in the function.
+//
+// @param: 	spec *APISpec	The APIs added by a spec file, or nil.
+//
+// @param: 	fileSet *token.FileSet	The file set which the source code is parsed with.
+//
+// @param: 	failures *list.List	List which the diagnostics of the functions failing to be analyzed are appended to, or
+//nil.
+//
+// @return:	diagnostics []*Diagnostic	List of findings ordered by position.
+//
+func analyzeNondeterminism(ast *Ast, PutStateMap map[string][]int, spec *APISpec, fileSet *token.FileSet,
+	failures *list.List) (diagnostics []*Diagnostic) {
+	diagnostics = []*Diagnostic{}
+	imports := findImports(ast)
+	mutated, mutatedIn := findMutatedPackageVariables(ast, failures)
+	functions := []*Ast{}
+	for _, function := range findFunctionDeclarations(ast) {
+		if findFunctionBody(function) != nil {
+			functions = append(functions, function)
+		}
+	}
+	for name, statements := range mutated {
+		for x := range statements {
+			diagnostics = append(diagnostics, &Diagnostic{Rule: "nondeterminism-global", Function: mutatedIn[statements[x]],
+				Pos: statements[x].Pos, End: statements[x].End, Message: fmt.Sprintf("package-level variable `%s` "+
+					"is written at runtime, its value depends on what the peer executed before", name)})
+		}
+	}
+	// Functions returning a nondeterministic value are found again until nothing changes, like `analyzeReadWriteAPI`.
+	nondeterministicFunctions := map[string]string{}
+	for flag := true; flag; {
+		flag = false
+		for x := range functions {
+			name := findFunctionName(functions[x])
+			if nondeterministicFunctions[name] != "" {
+				continue
+			}
+			isolateFunction(functions[x], "nondeterminism", failures, func() {
+				sources, _, descriptions := findNondeterministicSources(functions[x], imports, mutated,
+					nondeterministicFunctions)
+				for y := range sources {
+					_, returned := traceTaint(findFunctionBody(functions[x]), sources[y], PutStateMap, spec)
+					if returned {
+						nondeterministicFunctions[name] = fmt.Sprintf("%s at line %d", descriptions[y],
+							lineOf(fileSet, sources[y].Pos))
+						flag = true
+						break
+					}
+				}
+			})
+		}
+	}
+	for x := range functions {
+		// The findings of a function are kept only if it does not fail.
+		functionDiagnostics := []*Diagnostic{}
+		isolateFunction(functions[x], "nondeterminism", failures, func() {
+			sources, rules, descriptions := findNondeterministicSources(functions[x], imports, mutated,
+				nondeterministicFunctions)
+			for y := range sources {
+				writes, returned := traceTaint(findFunctionBody(functions[x]), sources[y], PutStateMap, spec)
+				if rules[y] == "nondeterminism-map-range" && len(writes) == 0 && !returned {
+					continue
+				}
+				reached := "reaches no state write"
+				if returned && len(writes) == 0 {
+					reached = "is returned to the callers"
+				} else if len(writes) != 0 {
+					lines := []string{}
+					for z := range writes {
+						lines = append(lines, strconv.Itoa(lineOf(fileSet, writes[z].Pos)))
+					}
+					reached = "reaches the state write(s) at line " + strings.Join(lines, ", ")
+				}
+				functionDiagnostics = append(functionDiagnostics, &Diagnostic{Rule: rules[y],
+					Function: findFunctionName(functions[x]), Pos: sources[y].Pos, End: sources[y].End,
+					Message: descriptions[y] + ", " + reached})
+			}
+			diagnostics = append(diagnostics, functionDiagnostics...)
+		})
+	}
+	// The sources are found by iterating maps, so the diagnostics at the same position are ordered by their text.
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		if diagnostics[i].Pos != diagnostics[j].Pos {
+			return diagnostics[i].Pos < diagnostics[j].Pos
+		} else if diagnostics[i].Rule != diagnostics[j].Rule {
+			return diagnostics[i].Rule < diagnostics[j].Rule
+		}
+		return diagnostics[i].Message < diagnostics[j].Message
+	})
+	return diagnostics
+}
@@ -0,0 +1,125 @@
+package stcpsce
+
+import (
+	"testing"
+)
+
+func TestDocumentedPackageVariables(t *testing.T) {
+	analysis := analyzeTestSource(t, `package main
+
+import (
+	"math/rand"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+type SmartContract struct{}
+
+// counter counts the calls.
+var counter = 0
+
+// seed is random.
+var seed = rand.Int()
+
+func (s *SmartContract) Count(stub shim.ChaincodeStubInterface) {
+	counter++
+	stub.PutState("counter", []byte{byte(counter + seed)})
+}
+`)
+	if len(analysis.PackageVariables) != 2 {
+		t.Fatalf("package variables = %d, want 2", len(analysis.PackageVariables))
+	}
+	for x, name := range []string{"counter", "seed"} {
+		variable := analysis.PackageVariables[x]
+		if variable.Name != name || !variable.Mutated {
+			t.Errorf("variable %d = %s mutated %v, want %s mutated", x, variable.Name, variable.Mutated, name)
+		}
+	}
+	if !analysis.NonChoppable["Count"] {
+		t.Errorf("Count is choppable")
+	}
+	if len(analysis.Nondeterminism) == 0 {
+		t.Errorf("no nondeterminism is found")
+	}
+}
+
+func TestNondeterminismOrder(t *testing.T) {
+	analysis := analyzeTestSource(t, `package main
+
+import "github.com/hyperledger/fabric/core/chaincode/shim"
+
+type SmartContract struct{}
+
+var a, b, c, d = 0, 0, 0, 0
+
+func (s *SmartContract) Reset(stub shim.ChaincodeStubInterface) {
+	d, c, b, a = 1, 1, 1, 1
+}
+`)
+	for x := 0; x < 20; x++ {
+		diagnostics := analyzeNondeterminism(analysis.Ast, analysis.PutStateMap, nil, analysis.FileSet, nil)
+		if len(diagnostics) != 4 {
+			t.Fatalf("diagnostics = %d, want 4", len(diagnostics))
+		}
+		for y := 1; y < len(diagnostics); y++ {
+			if diagnostics[y-1].Message > diagnostics[y].Message {
+				t.Fatalf("diagnostics at the same position are not ordered by message: %q before %q",
+					diagnostics[y-1].Message, diagnostics[y].Message)
+			}
+		}
+	}
+}
+
+func TestNondeterministicSources(t *testing.T) {
+	analysis := analyzeTestSource(t, `package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+type SmartContract struct{}
+
+func now() int64 {
+	return time.Now().Unix()
+}
+
+func (s *SmartContract) Stamp(stub shim.ChaincodeStubInterface, args []string) {
+	stub.PutState(args[0], []byte(strconv.FormatInt(now(), 10)))
+}
+
+func (s *SmartContract) Join(stub shim.ChaincodeStubInterface, values map[string]string) {
+	joined := ""
+	for key := range values {
+		joined += key
+	}
+	stub.PutState("joined", []byte(joined))
+}
+
+func (s *SmartContract) Count(stub shim.ChaincodeStubInterface, values map[string]string) int {
+	count := 0
+	for range values {
+		count++
+	}
+	return 0
+}
+`)
+	rules := map[string][]string{}
+	for _, diagnostic := range analyzeNondeterminism(analysis.Ast, analysis.PutStateMap, nil, analysis.FileSet, nil) {
+		rules[diagnostic.Function] = append(rules[diagnostic.Function], diagnostic.Rule)
+	}
+	if got := rules["now"]; len(got) != 1 || got[0] != "nondeterminism-time" {
+		t.Errorf("rules of now = %v, want the time", got)
+	}
+	if got := rules["Stamp"]; len(got) != 1 || got[0] != "nondeterminism-call" {
+		t.Errorf("rules of Stamp = %v, want the call of now", got)
+	}
+	if got := rules["Join"]; len(got) != 1 || got[0] != "nondeterminism-map-range" {
+		t.Errorf("rules of Join = %v, want the map range", got)
+	}
+	if got := rules["Count"]; len(got) != 0 {
+		t.Errorf("rules of Count = %v, want none since the order reaches no write", got)
+	}
+}
@@ -0,0 +1,543 @@
+package stcpsce
+
+import (
+	"container/list"
+	"fmt"
+	"go/token"
+	"strings"
+)
+
+// The most paths enumerated in a function, a function with more paths only has its accesses outside of every branch
+// as must accesses.
+const maxAccessPaths = 256
+
+// AccessPath
+//
+// @description:	This is used to describe a path through a function, from its entry to a `return` or the end of its
+//body, and the accesses on it. Every branch is assumed feasible.
+//
+type AccessPath struct {
+	// Exit is the `return` statement or the call of `panic` ending the path, nil if the path reaches the end of the
+	// body.
+	Exit *Ast
+	// Abort tells if the path ends by returning `shim.Error`, directly or through a function which always does, or by
+	// a panic. The transaction is then not committed.
+	Abort    bool
+	Accesses []*KeyAccess
+}
+
+// FunctionPaths
+//
+// @description:	This is used to describe the paths of a function and which of its accesses are on every path
+//committing the transaction.
+//
+type FunctionPaths struct {
+	Function string
+	// Transaction tells if the function is a transaction, whose paths not aborting commit it.
+	Transaction bool
+	Paths       []*AccessPath
+	// Truncated tells if the function has more than `maxAccessPaths` paths, Paths is then empty.
+	Truncated bool
+	// Must holds the accesses on every committing path, May the other ones, in the order of the source code.
+	Must []*KeyAccess
+	May  []*KeyAccess
+}
+
+// @title:	isAbortCall
+//
+// @description:	This is used to determine if an expression is a call of `shim.Error`, of a function which always
+//returns one, or of `panic`.
+//
+// @param: 	ast *Ast	The expression.
+//
+// @param: 	aborts map[string]bool	Set of the names of the functions which always return `shim.Error`.
+//
+// @return:	bool		If the expression aborts the transaction, return true, otherwise return false.
+//
+func isAbortCall(ast *Ast, aborts map[string]bool) bool {
+	if !strings.Contains(ast.Label, "*ast.CallExpr") {
+		return false
+	}
+	function := findChild(ast, "Fun")
+	if function == nil {
+		return false
+	} else if strings.Contains(function.Label, "*ast.Ident") {
+		return function.Attrs["Name"] == "panic" || aborts[function.Attrs["Name"]]
+	} else if !strings.Contains(function.Label, "*ast.SelectorExpr") {
+		return false
+	}
+	x, selector := findChild(function, "X"), findChild(function, "Sel")
+	return x != nil && selector != nil && x.Attrs["Name"] == "shim" && selector.Attrs["Name"] == "Error"
+}
+
+// @title:	isAbortReturn
+//
+// @description:	This is used to determine if a `return` statement aborts the transaction, which is when its last
+//result is an aborting call.
+//
+// @param: 	ast *Ast	The `return` statement.
+//
+// @param: 	aborts map[string]bool	Set of the names of the functions which always return `shim.Error`.
+//
+// @return:	bool		If the statement aborts the transaction, return true, otherwise return false.
+//
+func isAbortReturn(ast *Ast, aborts map[string]bool) bool {
+	results := findChild(ast, "Results")
+	if results == nil || len(results.Children) == 0 {
+		return false
+	}
+	return isAbortCall(results.Children[len(results.Children)-1], aborts)
+}
+
+// @title:	findReturnStatements
+//
+// @description:	This is used to find the `return` statements of a function, skipping the function literals in it.
+//
+// @param: 	ast *Ast	The node which needs to be searched.
+//
+// @return:	returns []*Ast	List of `return` statements.
+//
+func findReturnStatements(ast *Ast) (returns []*Ast) {
+	returns = []*Ast{}
+	if strings.Contains(ast.Label, "*ast.FuncLit") {
+		return returns
+	} else if strings.Contains(ast.Label, "*ast.ReturnStmt") {
+		return append(returns, ast)
+	}
+	for x := range ast.Children {
+		returns = append(returns, findReturnStatements(ast.Children[x])...)
+	}
+	return returns
+}
+
+// @title:	findAbortFunctions
+//
+// @description:	This is used to find the functions of the file which always return `shim.Error`, like `errormsg`,
+//directly or through another such function.
+//
+// @param: 	ast *Ast	The root node of the file.
+//
+// @param: 	failures *list.List	List which the diagnostics of the functions failing to be analyzed are appended to, or
+//nil.
+//
+// @return:	aborts map[string]bool	Set of the names of the functions.
+//
+func findAbortFunctions(ast *Ast, failures *list.List) (aborts map[string]bool) {
+	aborts = map[string]bool{}
+	functions := findFunctionDeclarations(ast)
+	for changed := true; changed; {
+		changed = false
+		for x := range functions {
+			name := findFunctionName(functions[x])
+			body := findFunctionBody(functions[x])
+			// Methods are called through their receiver, which is not followed.
+			if aborts[name] || body == nil || isMethodDeclaration(functions[x]) {
+				continue
+			}
+			isolateFunction(functions[x], "access paths", failures, func() {
+				returns := findReturnStatements(body)
+				abort := len(returns) != 0
+				for y := range returns {
+					abort = abort && isAbortReturn(returns[y], aborts)
+				}
+				if abort {
+					aborts[name] = true
+					changed = true
+				}
+			})
+		}
+	}
+	return aborts
+}
+
+// accessPathWalker holds what the enumeration of the paths of a function shares.
+type accessPathWalker struct {
+	accesses  []*KeyAccess
+	aborts    map[string]bool
+	truncated bool
+}
+
+// @title:	addAccesses
+//
+// @description:	This is used to add the accesses of a node to the paths running it.
+//
+// @param: 	ast *Ast	The node.
+//
+// @param: 	paths []*AccessPath	List of the paths running the node.
+//
+func (walker *accessPathWalker) addAccesses(ast *Ast, paths []*AccessPath) {
+	for x := range walker.accesses {
+		if walker.accesses[x].Site.Pos < ast.Pos || walker.accesses[x].Site.Pos >= ast.End {
+			continue
+		}
+		for y := range paths {
+			paths[y].Accesses = append(paths[y].Accesses, walker.accesses[x])
+		}
+	}
+}
+
+// @title:	fork
+//
+// @description:	This is used to copy the paths before a branch, one copy of them for each way it may go.
+//
+// @param: 	paths []*AccessPath	List of paths.
+//
+// @return:	forked []*AccessPath	List of the copies.
+//
+func (walker *accessPathWalker) fork(paths []*AccessPath) (forked []*AccessPath) {
+	forked = []*AccessPath{}
+	for x := range paths {
+		forked = append(forked, &AccessPath{Accesses: append([]*KeyAccess{}, paths[x].Accesses...)})
+	}
+	return forked
+}
+
+// @title:	walkBranches
+//
+// @description:	This is used to run the paths through the branches of a statement, like an `if` statement or a
+//loop. The loops are run at most once.
+//
+// @param: 	ast *Ast	The statement.
+//
+// @param: 	paths []*AccessPath	List of the paths before the statement.
+//
+// @return:	result []*AccessPath	List of the paths after the statement, including the ones ended in it.
+//
+func (walker *accessPathWalker) walkBranches(ast *Ast, paths []*AccessPath) (result []*AccessPath) {
+	result = []*AccessPath{}
+	// The statement may run none of its branches: an `if` without `else`, a loop or a switch without `default`.
+	skipped := !strings.Contains(ast.Label, "*ast.IfStmt") || findChild(ast, "Else") == nil
+	post := findChild(ast, "Post")
+	for x := range ast.Children {
+		child := ast.Children[x]
+		switch {
+		case strings.HasPrefix(child.Label, "Init") || strings.HasPrefix(child.Label, "Assign"):
+			paths = walker.walk(child, paths)
+		case strings.HasPrefix(child.Label, "Body") && (strings.Contains(ast.Label, "*ast.SwitchStmt") ||
+			strings.Contains(ast.Label, "*ast.TypeSwitchStmt") || strings.Contains(ast.Label, "*ast.SelectStmt")):
+			// The body of a switch is a list of clauses, each one is a way it may go.
+			skipped = !strings.Contains(ast.Label, "*ast.SelectStmt")
+			clauses := findChild(child, "List")
+			if clauses == nil {
+				clauses = &Ast{}
+			}
+			for y := range clauses.Children {
+				clause := clauses.Children[y]
+				if expressions := findChild(clause, "List"); (expressions == nil || len(expressions.Children) == 0) &&
+					findChild(clause, "Comm") == nil {
+					skipped = false
+				}
+				branch := walker.fork(paths)
+				for z := range clause.Children {
+					if !strings.HasPrefix(clause.Children[z].Label, "Body") {
+						walker.addAccesses(clause.Children[z], branch)
+					}
+				}
+				if body := findChild(clause, "Body"); body != nil {
+					branch = walker.walk(body, branch)
+				}
+				result = append(result, branch...)
+			}
+		case strings.HasPrefix(child.Label, "Body") || strings.HasPrefix(child.Label, "Else"):
+			branch := walker.walk(child, walker.fork(paths))
+			if post != nil && strings.HasPrefix(child.Label, "Body") {
+				// The post statement of a loop runs after its body.
+				for y := range branch {
+					if branch[y].Exit == nil {
+						walker.addAccesses(post, branch[y:y+1])
+					}
+				}
+			}
+			result = append(result, branch...)
+		case child != post:
+			walker.addAccesses(child, paths)
+		}
+	}
+	if skipped {
+		result = append(result, paths...)
+	}
+	return result
+}
+
+// @title:	dedupeAccessPaths
+//
+// @description:	This is used to remove the paths which have the same exit, abort and accesses as a path before them.
+//
+// @param: 	paths []*AccessPath	List of paths.
+//
+// @return:	deduped []*AccessPath	List of the distinct paths, in the same order.
+//
+func dedupeAccessPaths(paths []*AccessPath) (deduped []*AccessPath) {
+	deduped = []*AccessPath{}
+	for _, path := range paths {
+		duplicate := false
+		for _, other := range deduped {
+			if other.Exit == path.Exit && other.Abort == path.Abort && len(other.Accesses) == len(path.Accesses) {
+				duplicate = true
+				for x := range path.Accesses {
+					duplicate = duplicate && other.Accesses[x] == path.Accesses[x]
+				}
+			}
+			if duplicate {
+				break
+			}
+		}
+		if !duplicate {
+			deduped = append(deduped, path)
+		}
+	}
+	return deduped
+}
+
+// @title:	walk
+//
+// @description:	This is used to run the paths through a statement. A path ended before the statement is kept as it
+//is.
+//
+// @param: 	ast *Ast	The statement.
+//
+// @param: 	paths []*AccessPath	List of paths.
+//
+// @return:	result []*AccessPath	List of the paths after the statement.
+//
+func (walker *accessPathWalker) walk(ast *Ast, paths []*AccessPath) (result []*AccessPath) {
+	result, open := []*AccessPath{}, []*AccessPath{}
+	// Branches which do not differ in their accesses lead to the same path, which is only counted once.
+	paths = dedupeAccessPaths(paths)
+	for x := range paths {
+		if paths[x].Exit != nil {
+			result = append(result, paths[x])
+		} else {
+			open = append(open, paths[x])
+		}
+	}
+	if len(open) == 0 {
+		return result
+	} else if len(open) > maxAccessPaths {
+		walker.truncated = true
+		return append(result, open...)
+	}
+	switch {
+	case strings.Contains(ast.Label, "[]ast.Stmt"), strings.Contains(ast.Label, "*ast.BlockStmt"),
+		strings.Contains(ast.Label, "*ast.LabeledStmt"):
+		for x := range ast.Children {
+			open = walker.walk(ast.Children[x], open)
+		}
+	case strings.Contains(ast.Label, "*ast.ReturnStmt"):
+		walker.addAccesses(ast, open)
+		for x := range open {
+			open[x].Exit, open[x].Abort = ast, isAbortReturn(ast, walker.aborts)
+		}
+	case strings.Contains(ast.Label, "*ast.IfStmt"), strings.Contains(ast.Label, "*ast.ForStmt"),
+		strings.Contains(ast.Label, "*ast.RangeStmt"), strings.Contains(ast.Label, "*ast.SwitchStmt"),
+		strings.Contains(ast.Label, "*ast.TypeSwitchStmt"), strings.Contains(ast.Label, "*ast.SelectStmt"):
+		open = walker.walkBranches(ast, open)
+	default:
+		walker.addAccesses(ast, open)
+		if expression := findChild(ast, "X"); strings.Contains(ast.Label, "*ast.ExprStmt") && expression != nil &&
+			isAbortCall(expression, walker.aborts) {
+			for x := range open {
+				open[x].Exit, open[x].Abort = ast, true
+			}
+		}
+	}
+	return append(result, open...)
+}
+
+// @title:	findBranchFreeAccesses
+//
+// @description:	This is used to find the accesses of a function which are outside of every branch and before every
+//`return`, which run whenever the function runs.
+//
+// @param: 	ast *Ast	The body of the function.
+//
+// @param: 	accesses []*KeyAccess	List of the accesses of the function.
+//
+// @return:	must []*KeyAccess	List of the accesses.
+//
+func findBranchFreeAccesses(ast *Ast, accesses []*KeyAccess) (must []*KeyAccess) {
+	must = []*KeyAccess{}
+	statements := findChild(ast, "List")
+	if statements == nil {
+		return must
+	}
+	for x := range statements.Children {
+		statement := statements.Children[x]
+		if strings.Contains(statement.Label, "*ast.AssignStmt") || strings.Contains(statement.Label, "*ast.ExprStmt") ||
+			strings.Contains(statement.Label, "*ast.DeclStmt") || strings.Contains(statement.Label, "*ast.IncDecStmt") {
+			for y := range accesses {
+				if accesses[y].Site.Pos >= statement.Pos && accesses[y].Site.Pos < statement.End {
+					must = append(must, accesses[y])
+				}
+			}
+			continue
+		} else if len(findReturnStatements(statement)) != 0 {
+			break
+		}
+	}
+	return must
+}
+
+// @title:	analyzeAccessPaths
+//
+// @description:	This is used to enumerate the paths of every function accessing the ledger. An access is a must
+//access if it is on every path committing the transaction, so a write after a check aborting the transaction, like
+//`Insufficient funds`, is only made by the paths passing the check. The accesses of a called function are on the
+//paths running the call.
+//
+// @param: 	ast *Ast	The root node of the file.
+//
+// @param: 	accesses []*KeyAccess	List of accesses of every function.
+//
+// @param: 	failures *list.List	List which the diagnostics of the functions failing to be analyzed are appended to, or
+//nil.
+//
+// @return:	functions []*FunctionPaths	List of the paths of the functions in declaration order.
+//
+func analyzeAccessPaths(ast *Ast, accesses []*KeyAccess, failures *list.List) (functions []*FunctionPaths) {
+	functions = []*FunctionPaths{}
+	aborts := findAbortFunctions(ast, failures)
+	transactions := map[string]bool{}
+	for _, name := range findTransactions(ast) {
+		transactions[name] = true
+	}
+	accessesOf := map[string][]*KeyAccess{}
+	for x := range accesses {
+		accessesOf[accesses[x].Function] = append(accessesOf[accesses[x].Function], accesses[x])
+	}
+	declarations := findFunctionDeclarations(ast)
+	for x := range declarations {
+		name := findFunctionName(declarations[x])
+		if len(accessesOf[name]) == 0 {
+			continue
+		}
+		body := findFunctionBody(declarations[x])
+		if body == nil {
+			continue
+		}
+		isolateFunction(declarations[x], "access paths", failures, func() {
+			walker := &accessPathWalker{accesses: accessesOf[name], aborts: aborts}
+			function := &FunctionPaths{Function: name, Transaction: transactions[name], Must: []*KeyAccess{},
+				May: []*KeyAccess{}}
+			function.Paths = dedupeAccessPaths(walker.walk(body, []*AccessPath{{Accesses: []*KeyAccess{}}}))
+			must := map[*KeyAccess]bool{}
+			if walker.truncated {
+				function.Paths, function.Truncated = []*AccessPath{}, true
+				for _, access := range findBranchFreeAccesses(body, accessesOf[name]) {
+					must[access] = true
+				}
+			} else {
+				committing := 0
+				count := map[*KeyAccess]int{}
+				for _, path := range function.Paths {
+					if path.Abort {
+						continue
+					}
+					committing++
+					seen := map[*KeyAccess]bool{}
+					for _, access := range path.Accesses {
+						if !seen[access] {
+							seen[access] = true
+							count[access]++
+						}
+					}
+				}
+				for access, n := range count {
+					must[access] = n == committing
+				}
+			}
+			for _, access := range accessesOf[name] {
+				if must[access] {
+					function.Must = append(function.Must, access)
+				} else {
+					function.May = append(function.May, access)
+				}
+			}
+			functions = append(functions, function)
+		})
+	}
+	return functions
+}
+
+// @title:	formatAccessList
+//
+// @description:	This is used to format a list of accesses as their APIs and lines.
+//
+// @param: 	accesses []*KeyAccess	List of accesses.
+//
+// @param: 	fileSet *token.FileSet	The file set which the source code is parsed with.
+//
+// @param: 	keys bool	If the keys are formatted after the APIs.
+//
+// @return:	string		The formatted list, `none` if it is empty.
+//
+func formatAccessList(accesses []*KeyAccess, fileSet *token.FileSet, keys bool) string {
+	if len(accesses) == 0 {
+		return "none"
+	}
+	formatted := []string{}
+	for x := range accesses {
+		if keys {
+			formatted = append(formatted, fmt.Sprintf("%s %s (line %d)", accesses[x].API,
+				formatKeyAccess(accesses[x], formatKeyTemplate), lineOf(fileSet, accesses[x].Site.Pos)))
+		} else {
+			formatted = append(formatted, fmt.Sprintf("%s line %d", accesses[x].API, lineOf(fileSet,
+				accesses[x].Site.Pos)))
+		}
+	}
+	return strings.Join(formatted, ", ")
+}
+
+// @title:	printAccessPaths
+//
+// @description:	This is used to print the paths of every function with their accesses, then its must and may
+//writes.
+//
+// @param: 	functions []*FunctionPaths	List of the paths of the functions.
+//
+// @param: 	fileSet *token.FileSet	The file set which the source code is parsed with.
+//
+func printAccessPaths(functions []*FunctionPaths, fileSet *token.FileSet) {
+	fmt.Print("\n\nAccess paths:\n")
+	for _, function := range functions {
+		if function.Truncated {
+			fmt.Printf("%s: more than %d paths, only the accesses outside of every branch are must accesses\n",
+				function.Function, maxAccessPaths)
+		} else {
+			aborting := 0
+			for _, path := range function.Paths {
+				if path.Abort {
+					aborting++
+				}
+			}
+			fmt.Printf("%s: %d paths, %d abort\n", function.Function, len(function.Paths), aborting)
+		}
+		for _, path := range function.Paths {
+			exit := "end"
+			if path.Exit != nil {
+				exit = fmt.Sprintf("line %d", lineOf(fileSet, path.Exit.Pos))
+			}
+			kind := "return"
+			if function.Transaction {
+				kind = "commit"
+			}
+			if path.Abort {
+				kind = "abort"
+			}
+			fmt.Printf("\t%s %s: %s\n", kind, exit, formatAccessList(path.Accesses, fileSet, false))
+		}
+		must, may := []*KeyAccess{}, []*KeyAccess{}
+		for x := range function.Must {
+			if function.Must[x].Write {
+				must = append(must, function.Must[x])
+			}
+		}
+		for x := range function.May {
+			if function.May[x].Write {
+				may = append(may, function.May[x])
+			}
+		}
+		fmt.Printf("\tmust write: %s\n", formatAccessList(must, fileSet, true))
+		fmt.Printf("\tmay write: %s\n", formatAccessList(may, fileSet, true))
+	}
+}
@@ -0,0 +1,78 @@
+package stcpsce
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDedupeAccessPaths(t *testing.T) {
+	branches := strings.Repeat("\tif len(args) > 1 {\n\t\tcount++\n\t}\n", 9)
+	analysis := analyzeTestSource(t, `package main
+
+import "github.com/hyperledger/fabric/core/chaincode/shim"
+
+type SmartContract struct{}
+
+func (s *SmartContract) Count(stub shim.ChaincodeStubInterface, args []string) {
+	count := 0
+`+branches+`	stub.PutState(args[0], []byte{byte(count)})
+}
+`)
+	if len(analysis.Paths) != 1 {
+		t.Fatalf("functions = %d, want 1", len(analysis.Paths))
+	}
+	function := analysis.Paths[0]
+	if function.Truncated {
+		t.Errorf("the paths of %s are truncated", function.Function)
+	}
+	if len(function.Paths) != 1 || len(function.Paths[0].Accesses) != 1 {
+		t.Errorf("paths = %d, want the one writing the count", len(function.Paths))
+	}
+}
+
+func TestMustAndMayAccesses(t *testing.T) {
+	analysis := analyzeTestSource(t, `package main
+
+import (
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+type SmartContract struct{}
+
+func (s *SmartContract) Withdraw(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	balance, _ := stub.GetState(args[0])
+	if len(balance) == 0 {
+		return shim.Error("insufficient funds")
+	}
+	stub.PutState(args[0], balance)
+	if len(args) > 1 {
+		stub.PutState(args[1], balance)
+	}
+	return shim.Success(nil)
+}
+`)
+	if len(analysis.Paths) != 1 {
+		t.Fatalf("functions = %d, want 1", len(analysis.Paths))
+	}
+	function := analysis.Paths[0]
+	if !function.Transaction || len(function.Paths) != 3 {
+		t.Fatalf("paths = %d, want the abort and two committing paths", len(function.Paths))
+	}
+	if !function.Paths[0].Abort || function.Paths[1].Abort || function.Paths[2].Abort {
+		t.Errorf("only the first path aborts")
+	}
+	format := func(accesses []*KeyAccess) string {
+		keys := []string{}
+		for _, access := range accesses {
+			keys = append(keys, access.API+" "+formatKeyAccess(access, formatKeyTemplate))
+		}
+		return strings.Join(keys, ", ")
+	}
+	if got := format(function.Must); got != "GetState {args[0]}, PutState {args[0]}" {
+		t.Errorf("must = %s", got)
+	}
+	if got := format(function.May); got != "PutState {args[1]}" {
+		t.Errorf("may = %s", got)
+	}
+}
@@ -0,0 +1,283 @@
+package stcpsce
+
+import (
+	"bytes"
+	"container/list"
+	"fmt"
+	"go/token"
+	"html"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// reportStyle is the style sheet of the HTML report, which is inlined so the report has no external asset.
+const reportStyle = `body { font-family: sans-serif; margin: 2em; color: #222; }
+h1, h2, h3 { font-weight: normal; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+td, th { border: 1px solid #ccc; padding: 2px 8px; text-align: left; vertical-align: top; }
+pre.source { border: 1px solid #ccc; padding: 0; line-height: 1.4; overflow-x: auto; }
+pre.source a.line { display: inline-block; width: 4em; padding-right: 1em; text-align: right; color: #999;
+  text-decoration: none; user-select: none; }
+span.chain { background: #e3f2d0; }
+pre.source span.marks { color: #2a6; font-size: smaller; margin-left: 1em; }
+pre.source :target { background: #fff3b0; }
+span.read { background: #d6e6ff; border-bottom: 2px solid #36c; }
+span.write { background: #ffd9d0; border-bottom: 2px solid #c33; }
+code { font-size: 95%; }
+`
+
+// reportKindColors maps the kinds of conflicts to the colors of their edges in the conflict graph.
+var reportKindColors = map[string]string{
+	"write-write":        "#c33",
+	"read-write":         "#e80",
+	"partial-read-write": "#a6c",
+	"phantom":            "#36c",
+}
+
+// reportMark is an access marked in the source code of the report.
+type reportMark struct {
+	start  int
+	end    int
+	access *KeyAccess
+}
+
+// @title:	writeReportSource
+//
+// @description:	This is used to write the source code with a numbered anchor for every line, the lines of the
+//parallelizable chains highlighted and linked to their chains, and the calls accessing the ledger marked.
+//
+// @param: 	buffer *bytes.Buffer	The buffer the report is written to.
+//
+// @param: 	fileSet *token.FileSet	The file set which the source code is parsed with.
+//
+// @param: 	source string	The source code.
+//
+// @param: 	chains [][]*Ast	List of the parallelizable chains.
+//
+// @param: 	accesses []*KeyAccess	List of accesses.
+//
+func writeReportSource(buffer *bytes.Buffer, fileSet *token.FileSet, source string, chains [][]*Ast,
+	accesses []*KeyAccess) {
+	chainsOf := map[int][]int{}
+	for x := range chains {
+		for y := range chains[x] {
+			for line := lineOf(fileSet, chains[x][y].Pos); line <= lineOf(fileSet, chains[x][y].End); line++ {
+				if known := chainsOf[line]; len(known) == 0 || known[len(known)-1] != x {
+					chainsOf[line] = append(known, x)
+				}
+			}
+		}
+	}
+	// The calls are marked from their offsets, a call nested in a call already marked is skipped.
+	marks := []*reportMark{}
+	seen := map[*Ast]bool{}
+	for x := range accesses {
+		if seen[accesses[x].Site] {
+			continue
+		}
+		seen[accesses[x].Site] = true
+		marks = append(marks, &reportMark{start: fileSet.Position(token.Pos(accesses[x].Site.Pos)).Offset,
+			end: fileSet.Position(token.Pos(accesses[x].Site.End)).Offset, access: accesses[x]})
+	}
+	sort.Slice(marks, func(i, j int) bool {
+		return marks[i].start < marks[j].start
+	})
+	buffer.WriteString("<pre class=\"source\">")
+	offset, next := 0, 0
+	for number, line := range strings.SplitAfter(source, "\n") {
+		number++
+		class := ""
+		if len(chainsOf[number]) != 0 {
+			class = " class=\"chain\""
+		}
+		fmt.Fprintf(buffer, "<span id=\"L%d\"%s><a class=\"line\" href=\"#L%d\">%d</a>", number, class, number, number)
+		text := strings.TrimSuffix(line, "\n")
+		end := offset + len(text)
+		position := offset
+		for next < len(marks) && marks[next].start < end {
+			mark := marks[next]
+			next++
+			if mark.start < position {
+				continue
+			}
+			// A call spanning several lines is only marked on its first line.
+			stop := mark.end
+			if stop > end {
+				stop = end
+			}
+			class := "read"
+			if mark.access.Write {
+				class = "write"
+			}
+			buffer.WriteString(html.EscapeString(source[position:mark.start]))
+			fmt.Fprintf(buffer, "<span class=\"%s\" title=\"%s\">%s</span>", class, html.EscapeString(mark.access.API+
+				" "+formatKeyAccess(mark.access, formatKeyTemplate)), html.EscapeString(source[mark.start:stop]))
+			position = stop
+		}
+		buffer.WriteString(html.EscapeString(source[position:end]))
+		if len(chainsOf[number]) != 0 {
+			links := []string{}
+			for _, chain := range chainsOf[number] {
+				links = append(links, fmt.Sprintf("<a href=\"#chain%d\">chain %d</a>", chain+1, chain+1))
+			}
+			fmt.Fprintf(buffer, "<span class=\"marks\">%s</span>", strings.Join(links, " "))
+		}
+		buffer.WriteString("</span>\n")
+		offset += len(line)
+	}
+	buffer.WriteString("</pre>\n")
+}
+
+// @title:	writeReportSummaries
+//
+// @description:	This is used to write a table of the keys of the access summary of every function.
+//
+// @param: 	buffer *bytes.Buffer	The buffer the report is written to.
+//
+// @param: 	summaries []*AccessSummary	List of summaries.
+//
+// @param: 	fileSet *token.FileSet	The file set which the source code is parsed with.
+//
+func writeReportSummaries(buffer *bytes.Buffer, summaries []*AccessSummary, fileSet *token.FileSet) {
+	for _, summary := range summaries {
+		fmt.Fprintf(buffer, "<h3>%s</h3>\n<table>\n<tr><th>Key</th><th>Kind</th><th>Template</th><th>Accesses</th>"+
+			"</tr>\n", html.EscapeString(summary.Function))
+		for x := range summary.Keys {
+			lines := []string{}
+			for y := range summary.Trace {
+				if summary.Steps[y] != x {
+					continue
+				}
+				operation := "R"
+				if summary.Trace[y].Write {
+					operation = "W"
+				}
+				line := lineOf(fileSet, summary.Trace[y].Site.Pos)
+				lines = append(lines, fmt.Sprintf("<a href=\"#L%d\">%s line %d</a>", line, operation, line))
+			}
+			fmt.Fprintf(buffer, "<tr><td>K%d</td><td>%s</td><td><code>%s</code></td><td>%s</td></tr>\n", x+1,
+				summary.Kinds[x], html.EscapeString(formatKeyAccess(summary.Keys[x], formatKeyTemplate)),
+				strings.Join(lines, ", "))
+		}
+		buffer.WriteString("</table>\n")
+	}
+}
+
+// @title:	writeConflictGraph
+//
+// @description:	This is used to draw the conflict graph as an SVG image, with the transactions on a circle and an
+//edge colored by the kind of its first conflict. A transaction conflicting with itself has a loop.
+//
+// @param: 	buffer *bytes.Buffer	The buffer the report is written to.
+//
+// @param: 	transactions []string	List of the names of the transactions.
+//
+// @param: 	edges []*ConflictEdge	List of the edges of the conflict graph.
+//
+func writeConflictGraph(buffer *bytes.Buffer, transactions []string, edges []*ConflictEdge) {
+	const size, radius = 640.0, 220.0
+	x, y := map[string]float64{}, map[string]float64{}
+	for index, name := range transactions {
+		angle := 2*math.Pi*float64(index)/float64(len(transactions)) - math.Pi/2
+		x[name], y[name] = size/2+radius*math.Cos(angle), size/2+radius*math.Sin(angle)
+	}
+	fmt.Fprintf(buffer, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%.0f\" height=\"%.0f\" "+
+		"font-family=\"sans-serif\" font-size=\"12\">\n", size, size)
+	for _, edge := range edges {
+		color := reportKindColors[edge.Kinds[0]]
+		title := html.EscapeString(fmt.Sprintf("%s -- %s: %s", edge.From, edge.To, strings.Join(edge.Kinds, ", ")))
+		if edge.From == edge.To {
+			// The loop is drawn outside of the circle.
+			dx, dy := x[edge.From]-size/2, y[edge.From]-size/2
+			length := math.Sqrt(dx*dx + dy*dy)
+			fmt.Fprintf(buffer, "<circle cx=\"%.1f\" cy=\"%.1f\" r=\"18\" fill=\"none\" stroke=\"%s\" "+
+				"stroke-width=\"2\"><title>%s</title></circle>\n", x[edge.From]+dx/length*24, y[edge.From]+dy/length*24,
+				color, title)
+			continue
+		}
+		fmt.Fprintf(buffer, "<line x1=\"%.1f\" y1=\"%.1f\" x2=\"%.1f\" y2=\"%.1f\" stroke=\"%s\" stroke-width=\"2\">"+
+			"<title>%s</title></line>\n", x[edge.From], y[edge.From], x[edge.To], y[edge.To], color, title)
+	}
+	for _, name := range transactions {
+		fmt.Fprintf(buffer, "<circle cx=\"%.1f\" cy=\"%.1f\" r=\"6\" fill=\"#222\"/>\n", x[name], y[name])
+		anchor := "start"
+		if x[name] < size/2-1 {
+			anchor = "end"
+		} else if x[name] < size/2+1 {
+			anchor = "middle"
+		}
+		fmt.Fprintf(buffer, "<text x=\"%.1f\" y=\"%.1f\" text-anchor=\"%s\">%s</text>\n", x[name]+(x[name]-size/2)/
+			radius*12, y[name]+(y[name]-size/2)/radius*16+4, anchor, html.EscapeString(name))
+	}
+	kinds := []string{"write-write", "read-write", "partial-read-write", "phantom"}
+	for index, kind := range kinds {
+		fmt.Fprintf(buffer, "<line x1=\"10\" y1=\"%d\" x2=\"40\" y2=\"%d\" stroke=\"%s\" stroke-width=\"2\"/>"+
+			"<text x=\"46\" y=\"%d\">%s</text>\n", 16+index*16, 16+index*16, reportKindColors[kind], 20+index*16, kind)
+	}
+	buffer.WriteString("</svg>\n")
+}
+
+// @title:	writeHTMLReport
+//
+// @description:	This is used to write the HTML report of a file to `index.html` in a directory, which is created if
+//needed. The report holds the parallelizable chains, the access summaries, the conflict graph and the annotated source
+//code, with no external asset.
+//
+// @param: 	directory string	The directory.
+//
+// @param: 	ast *Ast	The root node of the file.
+//
+// @param: 	filename string	The name of the file.
+//
+// @param: 	fileSet *token.FileSet	The file set which the source code is parsed with.
+//
+// @param: 	source string	The source code.
+//
+// @param: 	posList *list.List	List of the chains of Phase 1.
+//
+// @param: 	accesses []*KeyAccess	List of accesses.
+//
+// @param: 	summaries []*AccessSummary	List of the access summaries.
+//
+// @param: 	edges []*ConflictEdge	List of the edges of the conflict graph.
+//
+// @return:	err error	If the report can be written, return nil, otherwise return an error.
+//
+func writeHTMLReport(directory string, ast *Ast, filename string, fileSet *token.FileSet, source string,
+	posList *list.List, accesses []*KeyAccess, summaries []*AccessSummary, edges []*ConflictEdge) (err error) {
+	chains := [][]*Ast{}
+	for pos := posList.Front(); pos != nil; pos = pos.Next() {
+		if chain := pos.Value.([]*Ast); len(chain) != 0 {
+			chains = append(chains, chain)
+		}
+	}
+	title := html.EscapeString(filepath.Base(filename))
+	buffer := &bytes.Buffer{}
+	fmt.Fprintf(buffer, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n"+
+		"<style>\n%s</style>\n</head>\n<body>\n<h1>%s</h1>\n", title, reportStyle, title)
+	buffer.WriteString("<h2>Parallelizable chains</h2>\n<ol>\n")
+	for x := range chains {
+		lines := []string{}
+		for y := range chains[x] {
+			line := lineOf(fileSet, chains[x][y].Pos)
+			lines = append(lines, fmt.Sprintf("<a href=\"#L%d\">%d</a>", line, line))
+		}
+		fmt.Fprintf(buffer, "<li id=\"chain%d\">[%s]</li>\n", x+1, strings.Join(lines, ", "))
+	}
+	buffer.WriteString("</ol>\n<h2>Access summaries</h2>\n")
+	writeReportSummaries(buffer, summaries, fileSet)
+	buffer.WriteString("<h2>Conflict graph</h2>\n")
+	writeConflictGraph(buffer, findTransactions(ast), edges)
+	buffer.WriteString("<h2>Source</h2>\n<p><span class=\"read\">read</span> <span class=\"write\">write</span> " +
+		"<span class=\"chain\">parallelizable chain</span></p>\n")
+	writeReportSource(buffer, fileSet, source, chains, accesses)
+	buffer.WriteString("</body>\n</html>\n")
+	if err = os.MkdirAll(directory, 0777); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(directory, "index.html"), buffer.Bytes(), 0666)
+}
@@ -0,0 +1,59 @@
+package stcpsce
+
+import (
+	"container/list"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteHTMLReport(t *testing.T) {
+	analysis := analyzeTestSource(t, `package main
+
+import "github.com/hyperledger/fabric/core/chaincode/shim"
+
+type SmartContract struct{}
+
+func (s *SmartContract) Pay(stub shim.ChaincodeStubInterface, id string, note string) {
+	memo, _ := stub.GetState(id)
+	memo = []byte(note) // <&>
+	stub.PutState(id, memo)
+}
+`)
+	posList := list.New()
+	for _, chain := range analysis.Chains {
+		posList.PushBack(chain)
+	}
+	directory, err := ioutil.TempDir("", "report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+	err = writeHTMLReport(filepath.Join(directory, "report"), analysis.Ast, "test.go", analysis.FileSet,
+		analysis.Source, posList, analysis.Accesses, analysis.Summaries, analysis.Conflicts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadFile(filepath.Join(directory, "report", "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := string(body)
+	for _, want := range []string{
+		`<li id="chain1">[<a href="#L9">9</a>`,
+		`<span id="L9" class="chain">`,
+		`<span class="read"`,
+		`<span class="write"`,
+		"Pay",
+		"&lt;&amp;&gt;",
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("the report lacks %q", want)
+		}
+	}
+	if strings.Contains(report, "<&>") {
+		t.Errorf("the source is not escaped")
+	}
+}
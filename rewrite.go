@@ -0,0 +1,1029 @@
+package stcpsce
+
+import (
+	"container/list"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DeltaRewrite
+//
+// @description:	This is used to describe a commutative update which is rewritten into a delta record.
+//
+type DeltaRewrite struct {
+	Function  string
+	Stub      string
+	Statement *Ast
+	// Target is the field updated by the statement.
+	Target *Ast
+	// Field is the name of the field in the JSON encoding of the value, which the delta records are stored under.
+	Field string
+	// Key is the expression of the key of the value, empty until it is found from the accesses of the loader.
+	Key    string
+	Loader *Ast
+	// Save is the statement saving the value after the update, nil if there is none.
+	Save  *Ast
+	Delta string
+	// Kept tells that the update is not rewritten, Reason says why, or how it is rewritten.
+	Kept   bool
+	Reason string
+}
+
+// DeltaAccess
+//
+// @description:	This is used to describe another access of a key with delta records, which is rewritten to add the
+//delta records to the value it reads, or to delete them when it writes a value which already holds them.
+//
+type DeltaAccess struct {
+	Access *KeyAccess
+	// Fields lists the fields with delta records under the key.
+	Fields []string
+}
+
+// deltaEdit is a replacement of the source code between two offsets.
+type deltaEdit struct {
+	start int
+	end   int
+	text  string
+}
+
+// deltaHelpers is appended to the rewritten source code. The delta records of a field are stored under the composite
+// key `delta~field~key~txID`, so every transaction writes its own key and only the aggregation reads them together.
+const deltaHelpers = `
+// putDelta records a commutative update of field for key under a key owned by the current transaction.
+func putDelta(stub shim.ChaincodeStubInterface, field string, key string, delta int) error {
+	deltaKey, err := stub.CreateCompositeKey("delta", []string{field, key, stub.GetTxID()})
+	if err != nil {
+		return err
+	}
+	return stub.PutState(deltaKey, []byte(strconv.Itoa(delta)))
+}
+
+// aggregateDelta sums every delta recorded for field of key.
+func aggregateDelta(stub shim.ChaincodeStubInterface, field string, key string) (int, error) {
+	iterator, err := stub.GetStateByPartialCompositeKey("delta", []string{field, key})
+	if err != nil {
+		return 0, err
+	}
+	defer iterator.Close()
+	sum := 0
+	for iterator.HasNext() {
+		kv, err := iterator.Next()
+		if err != nil {
+			return 0, err
+		}
+		delta, err := strconv.Atoi(string(kv.Value))
+		if err != nil {
+			return 0, err
+		}
+		sum += delta
+	}
+	return sum, nil
+}
+
+// getStateWithDeltas reads key like GetState and adds the deltas recorded for each field to the JSON object stored.
+func getStateWithDeltas(stub shim.ChaincodeStubInterface, key string, fields ...string) ([]byte, error) {
+	value, err := stub.GetState(key)
+	if err != nil || value == nil {
+		return value, err
+	}
+	object := map[string]json.RawMessage{}
+	if err = json.Unmarshal(value, &object); err != nil {
+		return nil, err
+	}
+	changed := false
+	for _, field := range fields {
+		delta, err := aggregateDelta(stub, field, key)
+		if err != nil {
+			return nil, err
+		}
+		if delta != 0 {
+			stored, _ := strconv.Atoi(string(object[field]))
+			object[field], changed = json.RawMessage(strconv.Itoa(stored+delta)), true
+		}
+	}
+	if !changed {
+		return value, nil
+	}
+	return json.Marshal(object)
+}
+
+// putStateWithoutDeltas writes key like PutState and deletes the deltas recorded for each field, which the value
+// written replaces.
+func putStateWithoutDeltas(stub shim.ChaincodeStubInterface, key string, value []byte, fields ...string) error {
+	for _, field := range fields {
+		iterator, err := stub.GetStateByPartialCompositeKey("delta", []string{field, key})
+		if err != nil {
+			return err
+		}
+		for err == nil && iterator.HasNext() {
+			kv, nextErr := iterator.Next()
+			if err = nextErr; err == nil {
+				err = stub.DelState(kv.Key)
+			}
+		}
+		iterator.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return stub.PutState(key, value)
+}
+`
+
+// deltaImports lists the packages the helpers use.
+var deltaImports = []string{"encoding/json", "strconv"}
+
+// @title:	findRootLabel
+//
+// @description:	This is used to find the variable an expression like `a.b.c` or `a[i].b` is rooted at.
+//
+// @param: 	ast *Ast	The expression.
+//
+// @return:	*Ast		The `Ident` node of the variable, or nil if the expression is not rooted at a variable.
+//
+func findRootLabel(ast *Ast) *Ast {
+	if strings.Contains(ast.Label, "*ast.Ident") {
+		return ast
+	} else if strings.Contains(ast.Label, "SelectorExpr") || strings.Contains(ast.Label, "IndexExpr") ||
+		strings.Contains(ast.Label, "StarExpr") || strings.Contains(ast.Label, "ParenExpr") {
+		return findRootLabel(ast.Children[0])
+	}
+	return nil
+}
+
+// @title:	findStubName
+//
+// @description:	This is used to find the parameter of type `shim.ChaincodeStubInterface` of a function.
+//
+// @param: 	ast *Ast	The `FuncDecl` node.
+//
+// @return:	string		The name of the parameter, or an empty string if there is none.
+//
+func findStubName(ast *Ast) string {
+	for _, field := range findParameterFields(ast) {
+		names, kind := findChild(field, "Names"), findChild(field, "Type")
+		if names != nil && len(names.Children) != 0 && kind != nil && strings.Contains(kind.Label, "SelectorExpr") &&
+			findChild(kind, "Sel").Attrs["Name"] == "ChaincodeStubInterface" {
+			return names.Children[0].Attrs["Name"]
+		}
+	}
+	return ""
+}
+
+// @title:	findLoader
+//
+// @description:	This is used to find the statement which loads a variable from the ledger, by `GetState` itself or
+//through a function in `GetStateMap`.
+//
+// @param: 	ast *Ast	The node which needs to be searched.
+//
+// @param: 	root *Ast	The variable which is loaded.
+//
+// @param: 	GetStateMap map[string][]int	Map of `GetState` expressions in the function.
+//
+// @return:	*Ast		The `AssignStmt` which loads the variable, or nil if there is none.
+//
+func findLoader(ast *Ast, root *Ast, GetStateMap map[string][]int) *Ast {
+	for x := range ast.Children {
+		child := ast.Children[x]
+		if strings.Contains(child.Label, "AssignStmt") && strings.Contains(child.Children[1].Children[0].Label, "CallExpr") {
+			for y := range child.Children[0].Children {
+				if !astNodeEqual(child.Children[0].Children[y], root) {
+					continue
+				}
+				fun := child.Children[1].Children[0].Children[0]
+				if strings.Contains(fun.Label, "SelectorExpr") && fun.Children[1].Attrs["Name"] == "GetState" ||
+					len(GetStateMap[fun.Attrs["Name"]]) != 0 {
+					return child
+				}
+			}
+		}
+		if loader := findLoader(child, root, GetStateMap); loader != nil {
+			return loader
+		}
+	}
+	return nil
+}
+
+// @title:	findJSONFieldName
+//
+// @description:	This is used to find the name a field of a struct declared in the file has in its JSON encoding,
+//which is the name in its `json` tag or the name of the field.
+//
+// @param: 	ast *Ast	The root node of the file.
+//
+// @param: 	field string	The name of the field.
+//
+// @return:	name string	The name in the JSON encoding.
+//
+// @return:	ok bool		If the field is left out of the JSON encoding, return false, otherwise return true.
+//
+func findJSONFieldName(ast *Ast, field string) (name string, ok bool) {
+	if fields := findChild(ast, "Fields"); strings.Contains(ast.Label, "*ast.StructType") && fields != nil {
+		for _, declaration := range findChild(fields, "List").Children {
+			names := findChild(declaration, "Names")
+			for x := 0; names != nil && x < len(names.Children); x++ {
+				if names.Children[x].Attrs["Name"] != field {
+					continue
+				}
+				name = field
+				if tag := findChild(declaration, "Tag"); tag != nil {
+					unquoted, _ := strconv.Unquote(tag.Attrs["Value"])
+					if option := strings.Split(reflect.StructTag(unquoted).Get("json"), ",")[0]; option == "-" {
+						return "", false
+					} else if option != "" {
+						name = option
+					}
+				}
+				return name, true
+			}
+		}
+	}
+	for x := range ast.Children {
+		if name, ok = findJSONFieldName(ast.Children[x], field); name != "" || !ok {
+			return name, ok
+		}
+	}
+	return "", true
+}
+
+// @title:	deltaKeyExpression
+//
+// @description:	This is used to write the template of a key as an expression which evaluates to the key in the
+//function accessing it. Every hole must be an expression of the parameters of the function and the functions of the
+//file, a key made by `CreateCompositeKey` is not written.
+//
+// @param: 	template *KeyTemplate	The template of the key.
+//
+// @param: 	names map[string]bool	The names which the holes may use.
+//
+// @return:	string		The expression, or an empty string if it cannot be written.
+//
+func deltaKeyExpression(template *KeyTemplate, names map[string]bool) string {
+	if template.ObjectType != nil || len(template.Segments) == 0 {
+		return ""
+	}
+	parts := []string{}
+	for _, segment := range template.Segments {
+		if segment.Hole == "" {
+			parts = append(parts, strconv.Quote(segment.Constant))
+			continue
+		}
+		expression, err := parser.ParseExpr(segment.Hole)
+		if err != nil {
+			return ""
+		}
+		known := true
+		ast.Inspect(expression, func(node ast.Node) bool {
+			switch node := node.(type) {
+			case *ast.SelectorExpr:
+				ast.Inspect(node.X, func(inner ast.Node) bool {
+					if ident, isIdent := inner.(*ast.Ident); isIdent && !names[ident.Name] {
+						known = false
+					}
+					return true
+				})
+				return false
+			case *ast.Ident:
+				known = known && names[node.Name]
+			}
+			return true
+		})
+		if !known {
+			return ""
+		}
+		if _, binary := expression.(*ast.BinaryExpr); binary {
+			parts = append(parts, "("+segment.Hole+")")
+		} else {
+			parts = append(parts, segment.Hole)
+		}
+	}
+	return strings.Join(parts, " + ")
+}
+
+// @title:	isStateWritingCall
+//
+// @description:	This is used to determine if a call writes to the ledger, either by `PutState`, `DelState` or their
+//private data counterparts itself or through a function in `PutStateMap`.
+//
+// @param: 	ast *Ast	The `CallExpr` node.
+//
+// @param: 	PutStateMap map[string][]int	Map of `PutState` expressions in the function.
+//
+// @param: 	spec *APISpec	The APIs added by a spec file, or nil.
+//
+// @return:	bool		If the call writes to the ledger, return true, otherwise return false.
+//
+func isStateWritingCall(ast *Ast, PutStateMap map[string][]int, spec *APISpec) bool {
+	if strings.Contains(ast.Children[0].Label, "SelectorExpr") {
+		return spec.writes(ast.Children[0].Children[1].Attrs["Name"])
+	}
+	return len(PutStateMap[ast.Children[0].Attrs["Name"]]) != 0
+}
+
+// @title:	countLabelUses
+//
+// @description:	This is used to count how many times a variable is used in a node, skipping the excluded statements.
+//
+// @param: 	ast *Ast	The node which needs to be searched.
+//
+// @param: 	label *Ast	The variable.
+//
+// @param: 	excluded []*Ast	List of statements which are not counted.
+//
+// @return:	count int	The number of uses.
+//
+func countLabelUses(ast *Ast, label *Ast, excluded []*Ast) (count int) {
+	for x := range excluded {
+		if excluded[x] == ast {
+			return 0
+		}
+	}
+	if strings.Contains(ast.Label, "*ast.Ident") && !strings.Contains(ast.Label, "Sel") && astNodeEqual(ast, label) {
+		return 1
+	}
+	for x := range ast.Children {
+		count += countLabelUses(ast.Children[x], label, excluded)
+	}
+	return count
+}
+
+// @title:	findModifications
+//
+// @description:	This is used to find the statements which modify a variable or one of its fields.
+//
+// @param: 	ast *Ast	The node which needs to be searched.
+//
+// @param: 	root *Ast	The variable.
+//
+// @return:	statements []*Ast	List of `AssignStmt` and `IncDecStmt` nodes modifying the variable.
+//
+func findModifications(ast *Ast, root *Ast) (statements []*Ast) {
+	statements = []*Ast{}
+	for x := range ast.Children {
+		child := ast.Children[x]
+		if strings.Contains(child.Label, "AssignStmt") || strings.Contains(child.Label, "IncDecStmt") {
+			targets := child.Children[0].Children
+			if strings.Contains(child.Label, "IncDecStmt") {
+				targets = child.Children[:1]
+			}
+			for y := range targets {
+				if r := findRootLabel(targets[y]); r != nil && astNodeEqual(r, root) {
+					statements = append(statements, child)
+					break
+				}
+			}
+		}
+		statements = append(statements, findModifications(child, root)...)
+	}
+	return statements
+}
+
+// @title:	findCommutativeUpdates
+//
+// @description:	This is used to find the exchangeable sentences of a function which update a field of a value
+//loaded from the ledger by `+=`, `-=`, `++` or `--`.
+//
+// @param: 	ast *Ast	The `FuncDecl` node.
+//
+// @param: 	GetStateMap map[string][]int	Map of `GetState` expressions in the function.
+//
+// @param: 	fileSet *token.FileSet	The file set which the source code is parsed with.
+//
+// @param: 	source string	The source code.
+//
+// @return:	rewrites []*DeltaRewrite	List of updates which can be rewritten.
+//
+func findCommutativeUpdates(ast *Ast, GetStateMap map[string][]int, fileSet *token.FileSet, source string) (rewrites []*DeltaRewrite) {
+	rewrites = []*DeltaRewrite{}
+	kernels := findExchangeableSentences(ast, findFunctionArguments(ast), nil)
+	for x := range kernels {
+		var target *Ast
+		delta := ""
+		if strings.Contains(kernels[x].Label, "IncDecStmt") {
+			target = kernels[x].Children[0]
+			delta = "1"
+			if kernels[x].Attrs["Tok"] == "--" {
+				delta = "-1"
+			}
+		} else if (kernels[x].Attrs["Tok"] == "+=" || kernels[x].Attrs["Tok"] == "-=") &&
+			len(kernels[x].Children[0].Children) == 1 && len(kernels[x].Children[1].Children) == 1 {
+			target = kernels[x].Children[0].Children[0]
+			value := kernels[x].Children[1].Children[0]
+			delta = sourceText(fileSet, source, value)
+			if kernels[x].Attrs["Tok"] == "-=" {
+				if isBasicLabel(value) || strings.Contains(value.Label, "BasicLit") {
+					delta = "-" + delta
+				} else {
+					delta = "-(" + delta + ")"
+				}
+			}
+		} else {
+			continue
+		}
+		// Only fields of a loaded value can be moved to their own records.
+		if !strings.Contains(target.Label, "SelectorExpr") {
+			continue
+		}
+		root := findRootLabel(target)
+		if root == nil {
+			continue
+		}
+		loader := findLoader(findFunctionBody(ast), root, GetStateMap)
+		if loader == nil {
+			continue
+		}
+		rewrites = append(rewrites, &DeltaRewrite{
+			Function:  findFunctionName(ast),
+			Statement: kernels[x],
+			Target:    target,
+			Field:     target.Children[1].Attrs["Name"],
+			Loader:    loader,
+			Delta:     delta,
+		})
+	}
+	return rewrites
+}
+
+// @title:	findStatementList
+//
+// @description:	This is used to find the list of statements a statement is in and its index in it.
+//
+// @param: 	ast *Ast	The node which needs to be searched.
+//
+// @param: 	statement *Ast	The statement.
+//
+// @return:	list *Ast	The `List` node of the block holding the statement, or nil if it is not found.
+//
+// @return:	index int	The index of the statement in the list.
+//
+func findStatementList(ast *Ast, statement *Ast) (list *Ast, index int) {
+	for x := range ast.Children {
+		if ast.Children[x] == statement && strings.HasPrefix(ast.Label, "List :") {
+			return ast, x
+		}
+		if list, index = findStatementList(ast.Children[x], statement); list != nil {
+			return list, index
+		}
+	}
+	return nil, -1
+}
+
+// @title:	findDeltaSave
+//
+// @description:	This is used to check that an update is a single read-add-write of its value, and to find the save
+//of the value. The value must only be modified by the update, the first statement using it after the update must be
+//the save, either an assignment of one variable like `err = saveAccount(stub, account)` or a bare call, and nothing
+//else may use the value. The delta is written by the save, so the statements in between must not modify its operands.
+//
+// @param: 	body *Ast	The body of the function.
+//
+// @param: 	rewrite *DeltaRewrite	The update.
+//
+// @param: 	updates []*DeltaRewrite	List of the updates of the function.
+//
+// @param: 	PutStateMap map[string][]int	Map of `PutState` expressions in the function.
+//
+// @param: 	spec *APISpec	The APIs added by a spec file, or nil.
+//
+// @param: 	fileSet *token.FileSet	The file set which the source code is parsed with.
+//
+// @return:	save *Ast	The save, or nil if the update is not a single read-add-write.
+//
+// @return:	reason string	Why the update is not a single read-add-write, empty if it is.
+//
+func findDeltaSave(body *Ast, rewrite *DeltaRewrite, updates []*DeltaRewrite, PutStateMap map[string][]int,
+	spec *APISpec, fileSet *token.FileSet) (save *Ast, reason string) {
+	root := findRootLabel(rewrite.Target)
+	for x := range updates {
+		if updates[x] != rewrite && updates[x].Loader == rewrite.Loader {
+			return nil, fmt.Sprintf("`%s` is updated more than once", root.Attrs["Name"])
+		}
+	}
+	for _, modification := range findModifications(body, root) {
+		if modification != rewrite.Loader && modification != rewrite.Statement {
+			return nil, fmt.Sprintf("`%s` is also modified at line %d", root.Attrs["Name"],
+				lineOf(fileSet, modification.Pos))
+		}
+	}
+	operands := []*Ast{}
+	if strings.Contains(rewrite.Statement.Label, "AssignStmt") {
+		labels := findLabelsInHalfStatements(rewrite.Statement.Children[1])
+		for x := labels.Front(); x != nil; x = x.Next() {
+			if operand := findRootLabel(x.Value.(*Ast)); operand != nil {
+				operands = append(operands, operand)
+			}
+		}
+	}
+	notSaved := fmt.Sprintf("the update is not followed by the save of `%s`", root.Attrs["Name"])
+	list, index := findStatementList(body, rewrite.Statement)
+	if list == nil {
+		return nil, notSaved
+	}
+	for x := index + 1; x < len(list.Children); x++ {
+		if countLabelUses(list.Children[x], root, nil) != 0 {
+			save = list.Children[x]
+			break
+		}
+		// The statement itself is searched too.
+		statement := &Ast{Children: []*Ast{list.Children[x]}}
+		for _, operand := range operands {
+			if modifications := findModifications(statement, operand); len(modifications) != 0 {
+				return nil, fmt.Sprintf("`%s` is modified at line %d before the save", operand.Attrs["Name"],
+					lineOf(fileSet, modifications[0].Pos))
+			}
+		}
+	}
+	if save == nil {
+		return nil, notSaved
+	}
+	call := findChild(save, "X")
+	if strings.Contains(save.Label, "AssignStmt") && save.Attrs["Tok"] == "=" &&
+		len(save.Children[0].Children) == 1 && len(save.Children[1].Children) == 1 {
+		call = save.Children[1].Children[0]
+	} else if !strings.Contains(save.Label, "ExprStmt") {
+		return nil, notSaved
+	}
+	if call == nil || !strings.Contains(call.Label, "CallExpr") || !isStateWritingCall(call, PutStateMap, spec) {
+		return nil, notSaved
+	}
+	saved := false
+	for _, argument := range findChild(call, "Args").Children {
+		saved = saved || astNodeEqual(argument, root)
+	}
+	if !saved {
+		return nil, notSaved
+	}
+	if countLabelUses(body, root, []*Ast{rewrite.Loader, rewrite.Statement, save}) != 0 {
+		return nil, fmt.Sprintf("`%s` is used by other statements", root.Attrs["Name"])
+	}
+	return save, ""
+}
+
+// @title:	callsQueryAPI
+//
+// @description:	This is used to determine if a node calls a rich query of the ledger, which may return any key,
+//the delta records as well.
+//
+// @param: 	ast *Ast	The node which needs to be searched.
+//
+// @return:	api string	The name of the first API called, or an empty string if there is none.
+//
+func callsQueryAPI(ast *Ast) (api string) {
+	if strings.Contains(ast.Label, "SelectorExpr") {
+		if name := findChild(ast, "Sel").Attrs["Name"]; strings.Contains(name, "QueryResult") {
+			return name
+		}
+	}
+	for x := range ast.Children {
+		if api = callsQueryAPI(ast.Children[x]); api != "" {
+			return api
+		}
+	}
+	return ""
+}
+
+// @title:	checkDeltaAccess
+//
+// @description:	This is used to determine if another access of a key with delta records can be rewritten, which is a
+//`GetState` or a `PutState` of the world state of this chaincode, called by the method itself or through a function
+//of the file which calls the API itself.
+//
+// @param: 	access *KeyAccess	The access.
+//
+// @param: 	functions map[string]*Ast	Map of the `FuncDecl` nodes of the file by name.
+//
+// @return:	bool		If the access can be rewritten, return true, otherwise return false.
+//
+func checkDeltaAccess(access *KeyAccess, functions map[string]*Ast) bool {
+	if access.API != "GetState" && access.API != "PutState" || access.Collection != nil || access.Chaincode != "" {
+		return false
+	} else if len(access.Via) == 0 {
+		return strings.Contains(access.Site.Children[0].Label, "SelectorExpr")
+	}
+	function := functions[access.Via[0]]
+	return len(access.Via) == 1 && function != nil && !isMethodDeclaration(function) &&
+		strings.Contains(access.Site.Children[0].Label, "*ast.Ident")
+}
+
+// @title:	planDeltaAccesses
+//
+// @description:	This is used to find the key of each update and the other accesses of the keys, which add the delta
+//records to the value they read or delete them when they write a value. An update is kept if its key cannot be written
+//in the function, or if another access cannot be rewritten. Only the accesses of the methods are checked, the other
+//functions are reached through them. A range read which may return the delta records keeps the update too. Keeping an
+//update turns its load and its save into other accesses, so it is repeated until nothing changes.
+//
+// @param: 	ast *Ast	The root node of the file.
+//
+// @param: 	rewrites []*DeltaRewrite	List of the updates, the kept ones have their reason set.
+//
+// @param: 	accesses []*KeyAccess	List of accesses of every function.
+//
+// @param: 	fileSet *token.FileSet	The file set which the source code is parsed with.
+//
+// @return:	planned []*DeltaAccess	List of the other accesses of the keys with delta records.
+//
+func planDeltaAccesses(ast *Ast, rewrites []*DeltaRewrite, accesses []*KeyAccess, fileSet *token.FileSet) (
+	planned []*DeltaAccess) {
+	planned = []*DeltaAccess{}
+	if api := callsQueryAPI(ast); api != "" {
+		for _, rewrite := range rewrites {
+			if !rewrite.Kept {
+				rewrite.Kept, rewrite.Reason = true, fmt.Sprintf("`%s` may return the delta records", api)
+			}
+		}
+		return planned
+	}
+	functions := map[string]*Ast{}
+	for _, function := range findFunctionDeclarations(ast) {
+		functions[findFunctionName(function)] = function
+	}
+	within := func(access *KeyAccess, function string, statement *Ast) bool {
+		return access.Function == function && access.Site.Pos >= statement.Pos && access.Site.End <= statement.End
+	}
+	for changed := true; changed; {
+		changed = false
+		planned = []*DeltaAccess{}
+		found := map[*KeyAccess]*DeltaAccess{}
+		for _, rewrite := range rewrites {
+			if rewrite.Kept {
+				continue
+			}
+			// The holes of the key may use the parameters of the function and the functions of the file.
+			names := map[string]bool{}
+			for name, function := range functions {
+				names[name] = !isMethodDeclaration(function)
+			}
+			for _, argument := range findFunctionArguments(functions[rewrite.Function]) {
+				names[argument.Attrs["Name"]] = true
+			}
+			loads := []*KeyAccess{}
+			rewrite.Key = ""
+			for _, access := range accesses {
+				if !within(access, rewrite.Function, rewrite.Loader) || access.Write {
+					continue
+				}
+				key := ""
+				if access.API == "GetState" && sameKeyNamespace(access, &KeyAccess{}) && access.End == nil &&
+					!access.Partial {
+					key = deltaKeyExpression(access.Key, names)
+				}
+				if key == "" || rewrite.Key != "" && key != rewrite.Key {
+					loads = nil
+					break
+				}
+				loads, rewrite.Key = append(loads, access), key
+			}
+			if len(loads) == 0 {
+				rewrite.Kept, rewrite.Reason, changed = true, "the key of the value is unknown", true
+				continue
+			}
+			delta := &KeyAccess{API: "PutState", Write: true, Key: newCompositeTemplate(newConstantTemplate("delta"),
+				[]*KeyTemplate{newConstantTemplate(rewrite.Field), newHoleTemplate("key", -1),
+					newHoleTemplate("txID", -1)})}
+			for _, access := range accesses {
+				if !isMethodDeclaration(functions[access.Function]) {
+					continue
+				}
+				shared := false
+				for _, other := range rewrites {
+					if !other.Kept && (within(access, other.Function, other.Loader) ||
+						within(access, other.Function, other.Save)) {
+						shared = true
+					}
+				}
+				if shared {
+					continue
+				}
+				if (access.End != nil || access.Partial) && mayAccessSameKey(access, delta) {
+					rewrite.Kept, rewrite.Reason = true, fmt.Sprintf("the delta records may be read by %s in %s "+
+						"at line %d", access.API, access.Function, lineOf(fileSet, access.Site.Pos))
+				}
+				for x := 0; x < len(loads) && !rewrite.Kept; x++ {
+					if !mayAccessSameKey(access, loads[x]) {
+						continue
+					} else if !checkDeltaAccess(access, functions) {
+						rewrite.Kept, rewrite.Reason = true, fmt.Sprintf("the key may also be accessed by %s in %s "+
+							"at line %d, which cannot be rewritten", access.API, access.Function,
+							lineOf(fileSet, access.Site.Pos))
+					} else if found[access] == nil {
+						found[access] = &DeltaAccess{Access: access, Fields: []string{rewrite.Field}}
+						planned = append(planned, found[access])
+					} else if !containsString(found[access].Fields, rewrite.Field) {
+						found[access].Fields = append(found[access].Fields, rewrite.Field)
+					}
+				}
+				if rewrite.Kept {
+					changed = true
+					break
+				}
+			}
+		}
+	}
+	sort.Slice(planned, func(i, j int) bool {
+		return planned[i].Access.Site.Pos < planned[j].Access.Site.Pos
+	})
+	for _, access := range planned {
+		sort.Strings(access.Fields)
+	}
+	return planned
+}
+
+// @title:	rewriteCommutativeUpdates
+//
+// @description:	This is used to rewrite the commutative updates found in Phase 1 into delta records, so that the
+//read-modify-write of a hot key becomes a blind write of a key owned by the transaction. Only a single read-add-write
+//is rewritten: the save of the value follows the update, and nothing else uses the value. The other updates are kept
+//with the reason.
+// Step 1: drop each update.
+// Step 2: replace the save of the value by a `putDelta` call keyed by the key its loader reads, so the error the save
+//returned is now the one of `putDelta`.
+// Step 3: replace the value by `_` in its loader, which still reads the key and checks that it exists.
+// Step 4: make every other access of the keys add the delta records to the value it reads, and delete them when it
+//writes a value. A call of the API itself is replaced by `getStateWithDeltas` or `putStateWithoutDeltas`, a call of a
+//function of the file by a call of its copy with these helpers.
+// Step 5: append the copies and the helpers, and import the packages they use.
+//
+// @param: 	ast *Ast	The root node of the file.
+//
+// @param: 	GetStateMap map[string][]int	Map of `GetState` expressions in the function.
+//
+// @param: 	PutStateMap map[string][]int	Map of `PutState` expressions in the function.
+//
+// @param: 	spec *APISpec	The APIs added by a spec file, or nil.
+//
+// @param: 	accesses []*KeyAccess	List of accesses of every function.
+//
+// @param: 	fileSet *token.FileSet	The file set which the source code is parsed with.
+//
+// @param: 	source string	The source code.
+//
+// @param: 	failures *list.List	List which the diagnostics of the functions failing to be analyzed are appended to, or
+//nil.
+//
+// @return:	rewritten string	The rewritten source code.
+//
+// @return:	rewrites []*DeltaRewrite	List of updates, the ones which are not rewritten are kept.
+//
+// @return:	planned []*DeltaAccess	List of the other accesses of the keys with delta records.
+//
+// @return:	err error	The error formatting the rewritten source code.
+//
+func rewriteCommutativeUpdates(ast *Ast, GetStateMap map[string][]int, PutStateMap map[string][]int, spec *APISpec,
+	accesses []*KeyAccess, fileSet *token.FileSet, source string, failures *list.List) (rewritten string,
+	rewrites []*DeltaRewrite, planned []*DeltaAccess, err error) {
+	rewrites = []*DeltaRewrite{}
+	offset := func(pos int) int {
+		return fileSet.Position(token.Pos(pos)).Offset
+	}
+	functions := findFunctionDeclarations(ast)
+	for x := range functions {
+		stub := findStubName(functions[x])
+		body := findFunctionBody(functions[x])
+		if stub == "" || body == nil {
+			continue
+		}
+		// The updates of a function are kept only if it does not fail.
+		functionRewrites := []*DeltaRewrite{}
+		isolateFunction(functions[x], "delta rewrite", failures, func() {
+			updates := findCommutativeUpdates(functions[x], GetStateMap, fileSet, source)
+			for y := range updates {
+				updates[y].Stub = stub
+				updates[y].Save, updates[y].Reason = findDeltaSave(body, updates[y], updates, PutStateMap, spec,
+					fileSet)
+				updates[y].Kept = updates[y].Save == nil
+			}
+			functionRewrites = updates
+		})
+		rewrites = append(rewrites, functionRewrites...)
+	}
+	for _, rewrite := range rewrites {
+		field, stored := findJSONFieldName(ast, rewrite.Field)
+		if !rewrite.Kept && !stored {
+			rewrite.Kept, rewrite.Reason = true, fmt.Sprintf("`%s` is not stored in JSON", rewrite.Field)
+		} else if !rewrite.Kept && field != "" {
+			rewrite.Field = field
+		}
+	}
+	planned = planDeltaAccesses(ast, rewrites, accesses, fileSet)
+	edits := []deltaEdit{}
+	for _, rewrite := range rewrites {
+		if rewrite.Kept {
+			continue
+		}
+		// Step 1: drop the update.
+		edits = append(edits, deltaEdit{offset(rewrite.Statement.Pos), offset(rewrite.Statement.End), ""})
+		// Step 2: write the delta instead of the value.
+		text := fmt.Sprintf("putDelta(%s, %q, %s, %s)", rewrite.Stub, rewrite.Field, rewrite.Key, rewrite.Delta)
+		if strings.Contains(rewrite.Save.Label, "AssignStmt") {
+			text = sourceText(fileSet, source, rewrite.Save.Children[0].Children[0]) + " = " + text
+		}
+		edits = append(edits, deltaEdit{offset(rewrite.Save.Pos), offset(rewrite.Save.End), text})
+		// Step 3: the loaded value is no longer used.
+		root := findRootLabel(rewrite.Target)
+		names := rewrite.Loader.Children[0].Children
+		for y := range names {
+			if astNodeEqual(names[y], root) {
+				edits = append(edits, deltaEdit{offset(names[y].Pos), offset(names[y].End), "_"})
+			}
+		}
+		if len(names) == 1 && rewrite.Loader.Attrs["Tok"] == ":=" {
+			var tokPos int
+			fmt.Sscan(rewrite.Loader.Attrs["TokPos"], &tokPos)
+			edits = append(edits, deltaEdit{offset(tokPos), offset(tokPos) + 2, "="})
+		}
+		rewrite.Reason = fmt.Sprintf("delta on `%s` keyed by `%s`, save at line %d replaced", rewrite.Field,
+			rewrite.Key, lineOf(fileSet, rewrite.Save.Pos))
+	}
+	if len(edits) == 0 {
+		return source, rewrites, planned, nil
+	}
+	// Step 4: the other accesses add the delta records. A function is copied once, with the fields of every call.
+	copied := map[string][]string{}
+	renamed := map[*Ast]bool{}
+	for _, access := range planned {
+		site := access.Access.Site
+		if len(access.Access.Via) == 0 {
+			edits = append(edits, deltaEdit{offset(site.Pos), offset(site.End), deltaAccessText(site, access.Access.API,
+				access.Fields, fileSet, source)})
+			continue
+		}
+		name := access.Access.Via[0]
+		for _, field := range access.Fields {
+			if !containsString(copied[name], field) {
+				copied[name] = append(copied[name], field)
+			}
+		}
+		if !renamed[site] {
+			renamed[site] = true
+			edits = append(edits, deltaEdit{offset(site.Children[0].Pos), offset(site.Children[0].End),
+				name + "WithDeltas"})
+		}
+	}
+	copies := ""
+	for _, function := range functions {
+		name := findFunctionName(function)
+		if _, ok := copied[name]; !ok || isMethodDeclaration(function) {
+			continue
+		}
+		sort.Strings(copied[name])
+		start := offset(function.Pos)
+		copyEdits := []deltaEdit{{offset(findChild(function, "Name").Pos) - start,
+			offset(findChild(function, "Name").End) - start, name + "WithDeltas"}}
+		for _, access := range accesses {
+			if access.Function == name && len(access.Via) == 0 && (access.API == "GetState" ||
+				access.API == "PutState") && strings.Contains(access.Site.Children[0].Label, "SelectorExpr") {
+				copyEdits = append(copyEdits, deltaEdit{offset(access.Site.Pos) - start, offset(access.Site.End) - start,
+					deltaAccessText(access.Site, access.API, copied[name], fileSet, source)})
+			}
+		}
+		copies += fmt.Sprintf("\n// %sWithDeltas is %s with the delta records of %s.\n", name, name,
+			strings.Join(copied[name], ", ")) + applyDeltaEdits(source[start:offset(function.End)], copyEdits) + "\n"
+	}
+	// Step 5: import the packages the helpers use after the last import, or after the package clause.
+	imported := map[string]bool{}
+	if imports := findChild(ast, "Imports"); imports != nil {
+		for _, spec := range imports.Children {
+			if path, err := strconv.Unquote(findChild(spec, "Path").Attrs["Value"]); err == nil {
+				imported[path] = true
+			}
+		}
+	}
+	anchor := findChild(ast, "Name")
+	for _, declaration := range findChild(ast, "Decls").Children {
+		if declaration.Attrs["Tok"] == "import" {
+			anchor = declaration
+		}
+	}
+	text := ""
+	for _, path := range deltaImports {
+		if !imported[path] {
+			text += fmt.Sprintf("\nimport %q", path)
+		}
+	}
+	if text != "" {
+		edits = append(edits, deltaEdit{offset(anchor.End), offset(anchor.End), "\n" + text})
+	}
+	rewritten = applyDeltaEdits(source, edits) + copies + deltaHelpers
+	formatted, err := format.Source([]byte(rewritten))
+	if err != nil {
+		return "", rewrites, planned, err
+	}
+	return string(formatted), rewrites, planned, nil
+}
+
+// @title:	deltaAccessText
+//
+// @description:	This is used to write the call of `getStateWithDeltas` or `putStateWithoutDeltas` replacing a call
+//of `GetState` or `PutState`.
+//
+// @param: 	ast *Ast	The `CallExpr` node of the API.
+//
+// @param: 	api string	The name of the API.
+//
+// @param: 	fields []string	List of the fields with delta records.
+//
+// @param: 	fileSet *token.FileSet	The file set which the source code is parsed with.
+//
+// @param: 	source string	The source code.
+//
+// @return:	string		The call of the helper.
+//
+func deltaAccessText(ast *Ast, api string, fields []string, fileSet *token.FileSet, source string) string {
+	arguments := []string{sourceText(fileSet, source, ast.Children[0].Children[0])}
+	for _, argument := range findChild(ast, "Args").Children {
+		arguments = append(arguments, sourceText(fileSet, source, argument))
+	}
+	for _, field := range fields {
+		arguments = append(arguments, strconv.Quote(field))
+	}
+	helper := "getStateWithDeltas"
+	if api == "PutState" {
+		helper = "putStateWithoutDeltas"
+	}
+	return helper + "(" + strings.Join(arguments, ", ") + ")"
+}
+
+// @title:	applyDeltaEdits
+//
+// @description:	This is used to apply edits to a text, from the last one so that the offsets of the others hold.
+//
+// @param: 	text string	The text.
+//
+// @param: 	edits []deltaEdit	List of edits, which do not overlap.
+//
+// @return:	string		The edited text.
+//
+func applyDeltaEdits(text string, edits []deltaEdit) string {
+	sort.Slice(edits, func(i, j int) bool {
+		return edits[i].start > edits[j].start
+	})
+	for x := range edits {
+		text = text[:edits[x].start] + edits[x].text + text[edits[x].end:]
+	}
+	return text
+}
+
+// @title:	containsString
+//
+// @description:	This is used to determine if a list of strings holds a string.
+//
+// @param: 	list []string	The list.
+//
+// @param: 	s string	The string.
+//
+// @return:	bool		If the list holds the string, return true, otherwise return false.
+//
+func containsString(list []string, s string) bool {
+	for x := range list {
+		if list[x] == s {
+			return true
+		}
+	}
+	return false
+}
+
+// @title:	printDeltaRewrites
+//
+// @description:	This is used to print the rewritten updates and why the others are kept, then the other accesses
+//of the keys with delta records.
+//
+// @param: 	rewrites []*DeltaRewrite	List of updates.
+//
+// @param: 	planned []*DeltaAccess	List of the other accesses of the keys with delta records.
+//
+// @param: 	fileSet *token.FileSet	The file set which the source code is parsed with.
+//
+// @param: 	source string	The source code.
+//
+func printDeltaRewrites(rewrites []*DeltaRewrite, planned []*DeltaAccess, fileSet *token.FileSet, source string) {
+	fmt.Print("\n\nDelta rewrite:\n")
+	for x := range rewrites {
+		reason := "-> " + rewrites[x].Reason
+		if rewrites[x].Kept {
+			reason = "kept, " + rewrites[x].Reason
+		}
+		fmt.Printf("%s line %d: `%s` %s\n", rewrites[x].Function, lineOf(fileSet, rewrites[x].Statement.Pos),
+			sourceText(fileSet, source, rewrites[x].Statement), reason)
+	}
+	for _, access := range planned {
+		helper := "getStateWithDeltas"
+		if access.Access.API == "PutState" {
+			helper = "putStateWithoutDeltas"
+		}
+		if len(access.Access.Via) != 0 {
+			helper = access.Access.Via[0] + "WithDeltas"
+		}
+		fmt.Printf("%s line %d: %s -> %s with the deltas of %s\n", access.Access.Function,
+			lineOf(fileSet, access.Access.Site.Pos), access.Access.API, helper, strings.Join(access.Fields, ", "))
+	}
+}
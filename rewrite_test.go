@@ -0,0 +1,231 @@
+package stcpsce
+
+import (
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+const counterSource = `package main
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+type SmartContract struct{}
+
+type Counter struct {
+	Name  string
+	Value int ` + "`json:\"value\"`" + `
+}
+
+func loadCounter(stub shim.ChaincodeStubInterface, name string) (*Counter, error) {
+	bytes, err := stub.GetState(name)
+	if err != nil {
+		return nil, err
+	}
+	counter := &Counter{}
+	err = json.Unmarshal(bytes, counter)
+	return counter, err
+}
+
+func saveCounter(stub shim.ChaincodeStubInterface, counter *Counter) error {
+	bytes, _ := json.Marshal(counter)
+	return stub.PutState(counter.Name, bytes)
+}
+
+func (s *SmartContract) Add(stub shim.ChaincodeStubInterface, args []string) error {
+	counter, err := loadCounter(stub, args[1])
+	if err != nil {
+		return err
+	}
+	amount, _ := strconv.Atoi(args[0])
+	%s
+	return err
+}
+%s`
+
+// @title:	rewriteTestCounter
+//
+// @description:	This is used to rewrite the counter contract with the given update of `Add` and other methods.
+//
+// @param: 	t *testing.T	The test.
+//
+// @param: 	update string	The statements of `Add` updating and saving the counter.
+//
+// @param: 	methods string	The other methods.
+//
+// @return:	rewritten string	The rewritten source code, which is checked to parse.
+//
+// @return:	rewrites []*DeltaRewrite	List of updates.
+//
+func rewriteTestCounter(t *testing.T, update string, methods string) (rewritten string, rewrites []*DeltaRewrite) {
+	t.Helper()
+	analysis := analyzeTestSource(t, strings.Replace(strings.Replace(counterSource, "%s", update, 1), "%s",
+		methods, 1))
+	rewritten, rewrites, _, err := rewriteCommutativeUpdates(analysis.Ast, analysis.GetStateMap,
+		analysis.PutStateMap, nil, analysis.Accesses, analysis.FileSet, analysis.Source, nil)
+	if err != nil {
+		t.Fatalf("rewriteCommutativeUpdates: %v", err)
+	}
+	if len(rewrites) != 1 {
+		t.Fatalf("updates = %d, want 1", len(rewrites))
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "delta.go", rewritten, 0); err != nil {
+		t.Fatalf("the rewritten source does not parse: %v\n%s", err, rewritten)
+	}
+	return rewritten, rewrites
+}
+
+func TestDeltaRewrite(t *testing.T) {
+	rewritten, rewrites := rewriteTestCounter(t, "counter.Value += amount\n\terr = saveCounter(stub, counter)", "")
+	if rewrites[0].Kept {
+		t.Fatalf("the update is kept: %s", rewrites[0].Reason)
+	}
+	for _, want := range []string{
+		"_, err := loadCounter(stub, args[1])",
+		`err = putDelta(stub, "value", args[1], amount)`,
+	} {
+		if !strings.Contains(rewritten, want) {
+			t.Errorf("the rewritten source lacks %q:\n%s", want, rewritten)
+		}
+	}
+	if strings.Contains(rewritten, "counter.Value += amount") || strings.Contains(rewritten, "saveCounter(stub, counter)") {
+		t.Errorf("the update or its save is left:\n%s", rewritten)
+	}
+}
+
+func TestDeltaRewriteAccesses(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		methods string
+		want    []string
+	}{
+		{"through a function", `
+func (s *SmartContract) Query(stub shim.ChaincodeStubInterface, args []string) (int, error) {
+	counter, err := loadCounter(stub, args[0])
+	return counter.Value, err
+}
+`, []string{"counter, err := loadCounterWithDeltas(stub, args[0])", "func loadCounterWithDeltas(",
+			`bytes, err := getStateWithDeltas(stub, name, "value")`}},
+		{"directly", `
+func (s *SmartContract) Reset(stub shim.ChaincodeStubInterface, args []string) error {
+	return stub.PutState(args[0], []byte("{}"))
+}
+`, []string{`return putStateWithoutDeltas(stub, args[0], []byte("{}"), "value")`}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			rewritten, rewrites := rewriteTestCounter(t, "counter.Value += amount\n\terr = saveCounter(stub, counter)",
+				test.methods)
+			if rewrites[0].Kept {
+				t.Fatalf("the update is kept: %s", rewrites[0].Reason)
+			}
+			for _, want := range test.want {
+				if !strings.Contains(rewritten, want) {
+					t.Errorf("the rewritten source lacks %q:\n%s", want, rewritten)
+				}
+			}
+		})
+	}
+}
+
+func TestDeltaRewriteImports(t *testing.T) {
+	source := strings.Replace(strings.Replace(strings.Replace(counterSource, "package main",
+		"// Package main counts.\npackage main", 1), "\t\"strconv\"\n", "", 1), "strconv.Atoi(args[0])", "len(args), 0", 1)
+	analysis := analyzeTestSource(t, strings.Replace(strings.Replace(source, "%s",
+		"counter.Value += amount\n\terr = saveCounter(stub, counter)", 1), "%s", "", 1))
+	rewritten, _, _, err := rewriteCommutativeUpdates(analysis.Ast, analysis.GetStateMap, analysis.PutStateMap,
+		nil, analysis.Accesses, analysis.FileSet, analysis.Source, nil)
+	if err != nil {
+		t.Fatalf("rewriteCommutativeUpdates: %v", err)
+	}
+	file, err := parser.ParseFile(token.NewFileSet(), "delta.go", rewritten, parser.ParseComments)
+	if err != nil {
+		t.Fatalf("the rewritten source does not parse: %v\n%s", err, rewritten)
+	}
+	imports := []string{}
+	for _, spec := range file.Imports {
+		imports = append(imports, spec.Path.Value)
+	}
+	if want := `"encoding/json" "github.com/hyperledger/fabric/core/chaincode/shim" "strconv"`; strings.Join(imports,
+		" ") != want || file.Doc == nil {
+		t.Errorf("imports = %v, doc = %v, want %s after the package doc:\n%s", imports, file.Doc, want, rewritten)
+	}
+}
+
+func TestDeltaRewriteInput(t *testing.T) {
+	source, err := ioutil.ReadFile("input.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	analysis := analyzeTestSource(t, string(source))
+	rewritten, rewrites, planned, err := rewriteCommutativeUpdates(analysis.Ast, analysis.GetStateMap,
+		analysis.PutStateMap, nil, analysis.Accesses, analysis.FileSet, analysis.Source, nil)
+	if err != nil {
+		t.Fatalf("rewriteCommutativeUpdates: %v", err)
+	}
+	lines := []int{}
+	for _, rewrite := range rewrites {
+		if !rewrite.Kept {
+			lines = append(lines, lineOf(analysis.FileSet, rewrite.Statement.Pos))
+		}
+	}
+	if len(lines) != 3 || lines[0] != 154 || lines[1] != 172 || lines[2] != 219 {
+		t.Errorf("rewritten updates at lines %v, want [154 172 219]", lines)
+	}
+	if len(planned) != 13 {
+		t.Errorf("other accesses = %d, want 13", len(planned))
+	}
+	for _, want := range []string{
+		`err2 = putDelta(stub, "CheckingBalance", "332514"+hexdigest(args[0])[:64], amount)`,
+		"sourceAccount, err2 := loadAccountWithDeltas(stub, args[1])",
+		"err1 = saveAccountWithDeltas(stub, sourceAccount)",
+		`accountBytes, err := getStateWithDeltas(stub, key, "CheckingBalance")`,
+		`return putStateWithoutDeltas(stub, key, accountBytes, "CheckingBalance")`,
+	} {
+		if !strings.Contains(rewritten, want) {
+			t.Errorf("the rewritten source lacks %q", want)
+		}
+	}
+}
+
+func TestDeltaRewriteKept(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		update  string
+		methods string
+		reason  string
+	}{
+		{"deleted", "counter.Value += amount\n\terr = saveCounter(stub, counter)", `
+func (s *SmartContract) Delete(stub shim.ChaincodeStubInterface, args []string) error {
+	return stub.DelState(args[0])
+}
+`, "may also be accessed by DelState in Delete at line 44, which cannot be rewritten"},
+		{"not saved", "counter.Value += amount", "", "not followed by the save"},
+		{"operand modified", "counter.Value += amount\n\tamount++\n\terr = saveCounter(stub, counter)", "",
+			"`amount` is modified at line 39 before the save"},
+		{"used", "counter.Value += amount\n\terr = saveCounter(stub, counter)\n\t_ = counter.Name", "",
+			"used by other statements"},
+		{"query", "counter.Value += amount\n\terr = saveCounter(stub, counter)", `
+func (s *SmartContract) Find(stub shim.ChaincodeStubInterface, args []string) error {
+	_, err := stub.GetQueryResult(args[0])
+	return err
+}
+`, "GetQueryResult"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			rewritten, rewrites := rewriteTestCounter(t, test.update, test.methods)
+			if !rewrites[0].Kept || !strings.Contains(rewrites[0].Reason, test.reason) {
+				t.Errorf("kept = %v, reason = %q, want %q", rewrites[0].Kept, rewrites[0].Reason, test.reason)
+			}
+			if strings.Contains(rewritten, "putDelta") {
+				t.Errorf("the source is rewritten")
+			}
+		})
+	}
+}
@@ -0,0 +1,279 @@
+package stcpsce
+
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"io/ioutil"
+	"path/filepath"
+)
+
+// sarifRules describes the rules of the findings written to SARIF, in the order they are listed.
+var sarifRules = []struct {
+	id          string
+	description string
+}{
+	{"parallelizable-chain", "Statements which can be parallelized, with the statements they derive from"},
+	{"rejected-candidate", "Candidate statement of Phase 1 which cannot be parallelized"},
+	{"nondeterminism-random", "Call of a random number generator"},
+	{"nondeterminism-time", "Read of the clock"},
+	{"nondeterminism-io", "Input or output outside of the ledger"},
+	{"nondeterminism-call", "Call of a function which is nondeterministic"},
+	{"nondeterminism-map-range", "Iteration over a map, which runs in random order"},
+	{"nondeterminism-goroutine", "Goroutine, which is scheduled in random order"},
+	{"nondeterminism-global", "Package-level variable mutated at runtime"},
+	{"conflict-write-write", "Two transactions may write the same key"},
+	{"conflict-read-write", "A transaction may write a key another one reads"},
+	{"conflict-partial-read-write", "A transaction may write a key in the prefix another one reads"},
+	{"conflict-phantom", "A transaction may write a key in the range another one reads"},
+	{"analysis-failed", "Function which cannot be analyzed, its findings are missing"},
+}
+
+// SarifLog
+//
+// @description:	This is used to hold a SARIF 2.1.0 log, with the subset of its properties the findings need.
+//
+type SarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []SarifRun `json:"runs"`
+}
+
+// SarifRun holds the tool and the results of a run.
+type SarifRun struct {
+	Tool      SarifTool       `json:"tool"`
+	Artifacts []SarifArtifact `json:"artifacts"`
+	Results   []SarifResult   `json:"results"`
+}
+
+// SarifTool holds the description of the tool and its rules.
+type SarifTool struct {
+	Driver SarifDriver `json:"driver"`
+}
+
+// SarifDriver describes the tool.
+type SarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []SarifRule `json:"rules"`
+}
+
+// SarifRule describes a rule.
+type SarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription SarifMessage `json:"shortDescription"`
+}
+
+// SarifMessage holds a text.
+type SarifMessage struct {
+	Text string `json:"text"`
+}
+
+// SarifArtifact describes an analyzed file.
+type SarifArtifact struct {
+	Location SarifArtifactLocation `json:"location"`
+}
+
+// SarifArtifactLocation holds the URI of a file.
+type SarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+// SarifResult describes a finding.
+type SarifResult struct {
+	RuleID           string          `json:"ruleId"`
+	RuleIndex        int             `json:"ruleIndex"`
+	Level            string          `json:"level"`
+	Message          SarifMessage    `json:"message"`
+	Locations        []SarifLocation `json:"locations"`
+	RelatedLocations []SarifLocation `json:"relatedLocations,omitempty"`
+	CodeFlows        []SarifCodeFlow `json:"codeFlows,omitempty"`
+}
+
+// SarifLocation holds a region of a file.
+type SarifLocation struct {
+	ID               *int                  `json:"id,omitempty"`
+	PhysicalLocation SarifPhysicalLocation `json:"physicalLocation"`
+	Message          *SarifMessage         `json:"message,omitempty"`
+}
+
+// SarifPhysicalLocation holds a file and a region of it.
+type SarifPhysicalLocation struct {
+	ArtifactLocation SarifArtifactLocation `json:"artifactLocation"`
+	Region           SarifRegion           `json:"region"`
+}
+
+// SarifRegion holds the lines and columns of a region, counting from 1. The end column is exclusive.
+type SarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn"`
+	EndLine     int `json:"endLine"`
+	EndColumn   int `json:"endColumn"`
+}
+
+// SarifCodeFlow holds the steps of a finding.
+type SarifCodeFlow struct {
+	ThreadFlows []SarifThreadFlow `json:"threadFlows"`
+}
+
+// SarifThreadFlow holds the steps of a finding in order.
+type SarifThreadFlow struct {
+	Locations []SarifThreadFlowLocation `json:"locations"`
+}
+
+// SarifThreadFlowLocation holds a step.
+type SarifThreadFlowLocation struct {
+	Location SarifLocation `json:"location"`
+}
+
+// @title:	newSarifLocation
+//
+// @description:	This is used to create the location of a node from its positions.
+//
+// @param: 	fileSet *token.FileSet	The file set which the source code is parsed with.
+//
+// @param: 	uri string	The URI of the file.
+//
+// @param: 	ast *Ast	The node.
+//
+// @param: 	message string	The message of the location, or an empty string.
+//
+// @return:	SarifLocation	The location.
+//
+func newSarifLocation(fileSet *token.FileSet, uri string, ast *Ast, message string) SarifLocation {
+	start, end := fileSet.Position(token.Pos(ast.Pos)), fileSet.Position(token.Pos(ast.End))
+	location := SarifLocation{PhysicalLocation: SarifPhysicalLocation{ArtifactLocation: SarifArtifactLocation{URI: uri},
+		Region: SarifRegion{StartLine: start.Line, StartColumn: start.Column, EndLine: end.Line, EndColumn: end.Column}}}
+	if message != "" {
+		location.Message = &SarifMessage{Text: message}
+	}
+	return location
+}
+
+// @title:	newSarifResult
+//
+// @description:	This is used to create a finding of a rule at a node.
+//
+// @param: 	rule string	The ID of the rule.
+//
+// @param: 	level string	The level of the finding, `note` or `warning`.
+//
+// @param: 	message string	The message of the finding.
+//
+// @param: 	location SarifLocation	The location of the finding.
+//
+// @return:	SarifResult	The finding.
+//
+func newSarifResult(rule string, level string, message string, location SarifLocation) SarifResult {
+	index := -1
+	for x := range sarifRules {
+		if sarifRules[x].id == rule {
+			index = x
+		}
+	}
+	return SarifResult{RuleID: rule, RuleIndex: index, Level: level, Message: SarifMessage{Text: message},
+		Locations: []SarifLocation{location}}
+}
+
+// @title:	buildSarifLog
+//
+// @description:	This is used to collect the findings as a SARIF log: the parallelizable chains of Phase 1 with the
+//statements they derive from as a code flow, from the first definition to the parallelizable statement, the rejected
+//candidates, the nondeterminism and the conflicting accesses.
+//
+// @param: 	filename string	The name of the file.
+//
+// @param: 	fileSet *token.FileSet	The file set which the source code is parsed with.
+//
+// @param: 	source string	The source code.
+//
+// @param: 	posList *list.List	List of the chains of Phase 1.
+//
+// @param: 	verdicts *list.List	List of the verdicts of Phase 1.
+//
+// @param: 	nondeterminism []*Diagnostic	List of the nondeterminism found and of the functions failing to be
+//analyzed.
+//
+// @param: 	edges []*ConflictEdge	List of the edges of the conflict graph.
+//
+// @return:	log *SarifLog	The log.
+//
+func buildSarifLog(filename string, fileSet *token.FileSet, source string, posList *list.List, verdicts *list.List,
+	nondeterminism []*Diagnostic, edges []*ConflictEdge) (log *SarifLog) {
+	uri := filepath.ToSlash(filename)
+	run := SarifRun{Tool: SarifTool{Driver: SarifDriver{Name: "STCPSCE",
+		InformationURI: "https://github.com/gsxgoldenlegendary/STCPSCE", Rules: []SarifRule{}}},
+		Artifacts: []SarifArtifact{{Location: SarifArtifactLocation{URI: uri}}}, Results: []SarifResult{}}
+	for x := range sarifRules {
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, SarifRule{ID: sarifRules[x].id,
+			ShortDescription: SarifMessage{Text: sarifRules[x].description}})
+	}
+	for pos := posList.Front(); pos != nil; pos = pos.Next() {
+		chain := pos.Value.([]*Ast)
+		if len(chain) == 0 {
+			continue
+		}
+		result := newSarifResult("parallelizable-chain", "note", fmt.Sprintf("Line %d can be parallelized",
+			lineOf(fileSet, chain[0].Pos)), newSarifLocation(fileSet, uri, chain[0], ""))
+		flow := SarifThreadFlow{Locations: []SarifThreadFlowLocation{}}
+		for x := len(chain) - 1; x >= 0; x-- {
+			flow.Locations = append(flow.Locations, SarifThreadFlowLocation{Location: newSarifLocation(fileSet, uri,
+				chain[x], sourceText(fileSet, source, chain[x]))})
+		}
+		result.CodeFlows = []SarifCodeFlow{{ThreadFlows: []SarifThreadFlow{flow}}}
+		run.Results = append(run.Results, result)
+	}
+	for e := verdicts.Front(); e != nil; e = e.Next() {
+		verdict := e.Value.(*Verdict)
+		if verdict.Accepted || verdict.Kind == verdictDefinition {
+			continue
+		}
+		run.Results = append(run.Results, newSarifResult("rejected-candidate", "note",
+			fmt.Sprintf("%s: %s", verdict.Function, explainVerdict(verdict, fileSet, source)),
+			newSarifLocation(fileSet, uri, verdict.Statement, "")))
+	}
+	for x := range nondeterminism {
+		run.Results = append(run.Results, newSarifResult(nondeterminism[x].Rule, "warning",
+			fmt.Sprintf("%s: %s", nondeterminism[x].Function, nondeterminism[x].Message),
+			newSarifLocation(fileSet, uri, &Ast{Pos: nondeterminism[x].Pos, End: nondeterminism[x].End}, "")))
+	}
+	for x := range edges {
+		for y := range edges[x].Kinds {
+			from, to := edges[x].Evidence[y][0], edges[x].Evidence[y][1]
+			// A conflict coming only from may-writes is a note.
+			level := "warning"
+			if edges[x].May[y] {
+				level = "note"
+			}
+			result := newSarifResult("conflict-"+edges[x].Kinds[y], level, fmt.Sprintf(
+				"%s and %s may conflict: %s %s and %s %s", edges[x].From, edges[x].To, from.API,
+				formatKeyAccess(from, formatKeyTemplate), to.API, formatKeyAccess(to, formatKeyTemplate)),
+				newSarifLocation(fileSet, uri, from.Site, ""))
+			result.RelatedLocations = []SarifLocation{newSarifLocation(fileSet, uri, to.Site,
+				fmt.Sprintf("%s in %s", to.API, to.Function))}
+			id := 1
+			result.RelatedLocations[0].ID = &id
+			run.Results = append(run.Results, result)
+		}
+	}
+	return &SarifLog{Version: "2.1.0", Schema: "https://json.schemastore.org/sarif-2.1.0.json", Runs: []SarifRun{run}}
+}
+
+// @title:	writeSarifLog
+//
+// @description:	This is used to write a SARIF log to a file.
+//
+// @param: 	log *SarifLog	The log.
+//
+// @param: 	output string	The name of the file.
+//
+// @return:	err error	If the file can be written, return nil, otherwise return an error.
+//
+func writeSarifLog(log *SarifLog, output string) (err error) {
+	body, err := json.MarshalIndent(log, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(output, append(body, '\n'), 0666)
+}
@@ -0,0 +1,81 @@
+package stcpsce
+
+import (
+	"container/list"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteSarifLog(t *testing.T) {
+	analysis := analyzeTestSource(t, `package main
+
+import (
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+type SmartContract struct{}
+
+func (s *SmartContract) Pay(stub shim.ChaincodeStubInterface, id string, note string) {
+	memo := ""
+	memo = note
+	stub.PutState(id, []byte(memo))
+}
+
+func (s *SmartContract) Stamp(stub shim.ChaincodeStubInterface, args []string) {
+	stub.PutState(args[0], []byte(time.Now().String()))
+}
+`)
+	posList := list.New()
+	for _, chain := range analysis.Chains {
+		posList.PushBack(chain)
+	}
+	directory, err := ioutil.TempDir("", "sarif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+	output := filepath.Join(directory, "log.sarif")
+	log := buildSarifLog("test.go", analysis.FileSet, analysis.Source, posList, list.New(), analysis.Nondeterminism,
+		analysis.Conflicts)
+	if err = writeSarifLog(log, output); err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := &SarifLog{}
+	if err = json.Unmarshal(body, read); err != nil {
+		t.Fatalf("the log is not JSON: %v", err)
+	}
+	if read.Version != "2.1.0" || len(read.Runs) != 1 {
+		t.Fatalf("version = %s, runs = %d", read.Version, len(read.Runs))
+	}
+	run := read.Runs[0]
+	found := map[string]*SarifResult{}
+	for x := range run.Results {
+		result := &run.Results[x]
+		if run.Tool.Driver.Rules[result.RuleIndex].ID != result.RuleID {
+			t.Errorf("rule index %d of %s is %s", result.RuleIndex, result.RuleID,
+				run.Tool.Driver.Rules[result.RuleIndex].ID)
+		}
+		found[result.RuleID] = result
+	}
+	chain := found["parallelizable-chain"]
+	if chain == nil || len(chain.CodeFlows) != 1 || len(chain.CodeFlows[0].ThreadFlows[0].Locations) == 0 ||
+		chain.Locations[0].PhysicalLocation.Region.StartLine != 13 {
+		t.Errorf("chain = %+v, want the flow of line 13", chain)
+	}
+	if found["nondeterminism-time"] == nil {
+		t.Errorf("the time is not reported")
+	}
+	conflict := found["conflict-write-write"]
+	if conflict == nil || len(conflict.RelatedLocations) != 1 {
+		t.Errorf("conflict = %+v, want the write of Pay with itself", conflict)
+	}
+}
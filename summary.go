@@ -0,0 +1,228 @@
+package stcpsce
+
+import (
+	"container/list"
+	"fmt"
+	"go/token"
+	"sort"
+	"strings"
+)
+
+// The kinds of keys in an access summary.
+const (
+	// summaryReadModifyWrite is a key read, then written, by the function.
+	summaryReadModifyWrite = "read-modify-write"
+	// summaryBlindWrite is a key written without being read before.
+	summaryBlindWrite = "blind-write"
+	// summaryReadOnly is a key read and not written after.
+	summaryReadOnly = "read-only"
+)
+
+// AccessSummary
+//
+// @description:	This is used to summarize the accesses of a function: the keys it accesses, whether each of them is
+//read then written, written blindly or only read, and the order of the accesses.
+//
+type AccessSummary struct {
+	Function string
+	// Keys holds the first access of every key template in the order they are accessed.
+	Keys []*KeyAccess
+	// Kinds holds the kind of every key.
+	Kinds []string
+	// Trace holds the accesses in order, Steps the index in Keys of each of them.
+	Trace []*KeyAccess
+	Steps []int
+}
+
+// @title:	mayAccessSameKey
+//
+// @description:	This is used to determine if two accesses may touch the same key, a range or a prefix read covering
+//the key of the other one.
+//
+// @param: 	a *KeyAccess	An access.
+//
+// @param: 	b *KeyAccess	Another access.
+//
+// @return:	bool		If it is not proven that the accesses touch different keys, return true, otherwise return false.
+//
+func mayAccessSameKey(a *KeyAccess, b *KeyAccess) bool {
+	if !sameKeyNamespace(a, b) {
+		return false
+	} else if a.End != nil || a.Partial {
+		a, b = b, a
+	}
+	if b.End != nil {
+		return a.End != nil || a.Partial || keyTemplateInRange(a.Key, b.Key, b.End)
+	} else if b.Partial {
+		return a.Partial || keyTemplateHasPrefix(a.Key, b.Key)
+	}
+	return !keyTemplatesDisjoint(a.Key, b.Key)
+}
+
+// @title:	findStatementAccesses
+//
+// @description:	This is used to find the accesses of a statement from the arguments Phase 2 finds for its `GetState`
+//and `PutState` expressions. The access of an argument is the one of the innermost call holding it, and the accesses
+//are ordered by the end of their calls, because the calls in the arguments of another one are evaluated first.
+//
+// @param: 	statement *Ast	The statement.
+//
+// @param: 	GetStateMap map[string][]int	Map of `GetState` expressions in the function.
+//
+// @param: 	PutStateMap map[string][]int	Map of `PutState` expressions in the function.
+//
+// @param: 	spec *APISpec	The APIs added by a spec file, or nil.
+//
+// @param: 	accesses []*KeyAccess	List of accesses of the function.
+//
+// @return:	found []*KeyAccess	List of accesses of the statement.
+//
+func findStatementAccesses(statement *Ast, GetStateMap map[string][]int, PutStateMap map[string][]int, spec *APISpec,
+	accesses []*KeyAccess) (found []*KeyAccess) {
+	found = []*KeyAccess{}
+	seen := map[*KeyAccess]bool{}
+	for _, isGet := range []bool{true, false} {
+		stateMap := GetStateMap
+		if !isGet {
+			stateMap = PutStateMap
+		}
+		for _, argument := range findGetOrPutStateArguments(statement, stateMap, isGet, spec) {
+			var site *Ast
+			for _, access := range accesses {
+				if access.Site.Pos <= argument.Pos && argument.End <= access.Site.End &&
+					(site == nil || access.Site.End-access.Site.Pos < site.End-site.Pos) {
+					site = access.Site
+				}
+			}
+			// A helper may both read and write, so every access of the call with the kind of the argument is kept.
+			for _, access := range accesses {
+				if access.Site == site && access.Write != isGet && !seen[access] {
+					seen[access] = true
+					found = append(found, access)
+				}
+			}
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool {
+		return found[i].Site.End < found[j].Site.End
+	})
+	return found
+}
+
+// @title:	summarizeAccesses
+//
+// @description:	This is used to build the access summary of every function by the same traversal of its statements
+//as Phase 2, the accesses of every statement are taken from `accesses`. Accesses with the same template are the same
+//key. A key written after a read which may touch it is read-modify-write, and so is the key read, which needs a read of
+//the key itself, not of a range or a prefix holding it. A key written without such a read is blind, and a key only
+//read is read-only.
+//
+// @param: 	ast *Ast	The root node of the file.
+//
+// @param: 	GetStateMap map[string][]int	Map of `GetState` expressions in the function.
+//
+// @param: 	PutStateMap map[string][]int	Map of `PutState` expressions in the function.
+//
+// @param: 	spec *APISpec	The APIs added by a spec file, or nil.
+//
+// @param: 	accesses []*KeyAccess	List of accesses of every function.
+//
+// @param: 	failures *list.List	List which the diagnostics of the functions failing to be analyzed are appended to, or
+//nil.
+//
+// @return:	summaries []*AccessSummary	List of summaries of the functions accessing the ledger.
+//
+func summarizeAccesses(ast *Ast, GetStateMap map[string][]int, PutStateMap map[string][]int, spec *APISpec,
+	accesses []*KeyAccess, failures *list.List) (summaries []*AccessSummary) {
+	summaries = []*AccessSummary{}
+	for _, function := range findFunctionDeclarations(ast) {
+		statements := findChild(findFunctionBody(function), "List")
+		if statements == nil {
+			continue
+		}
+		name := findFunctionName(function)
+		functionAccesses := []*KeyAccess{}
+		for _, access := range accesses {
+			if access.Function == name {
+				functionAccesses = append(functionAccesses, access)
+			}
+		}
+		summary := &AccessSummary{Function: name, Keys: []*KeyAccess{}, Kinds: []string{}, Trace: []*KeyAccess{},
+			Steps: []int{}}
+		// The summary of a function is kept only if it does not fail.
+		isolateFunction(function, "summary", failures, func() {
+			for _, statement := range statements.Children {
+				summary.Trace = append(summary.Trace, findStatementAccesses(statement, GetStateMap, PutStateMap, spec,
+					functionAccesses)...)
+			}
+			for x := range summary.Trace {
+				step := -1
+				for y := range summary.Keys {
+					if summary.Keys[y].Partial == summary.Trace[x].Partial &&
+						formatKeyAccess(summary.Keys[y], formatKeyTemplate) ==
+							formatKeyAccess(summary.Trace[x], formatKeyTemplate) {
+						step = y
+					}
+				}
+				if step < 0 {
+					step = len(summary.Keys)
+					summary.Keys = append(summary.Keys, summary.Trace[x])
+					summary.Kinds = append(summary.Kinds, "")
+				}
+				summary.Steps = append(summary.Steps, step)
+			}
+			for x, access := range summary.Trace {
+				step := summary.Steps[x]
+				if !access.Write {
+					if summary.Kinds[step] == "" {
+						summary.Kinds[step] = summaryReadOnly
+					}
+					continue
+				}
+				// The write and every earlier read of a key it may touch are a read-modify-write.
+				for y := 0; y < x; y++ {
+					if read := summary.Trace[y]; !read.Write && read.End == nil && !read.Partial &&
+						mayAccessSameKey(read, access) {
+						summary.Kinds[summary.Steps[y]] = summaryReadModifyWrite
+						summary.Kinds[step] = summaryReadModifyWrite
+					}
+				}
+				if summary.Kinds[step] != summaryReadModifyWrite {
+					summary.Kinds[step] = summaryBlindWrite
+				}
+			}
+			if len(summary.Trace) != 0 {
+				summaries = append(summaries, summary)
+			}
+		})
+	}
+	return summaries
+}
+
+// @title:	printAccessSummaries
+//
+// @description:	This is used to print the keys of every summary with their kinds, then the trace of the accesses.
+//
+// @param: 	summaries []*AccessSummary	List of summaries.
+//
+// @param: 	fileSet *token.FileSet	The file set which the source code is parsed with.
+//
+func printAccessSummaries(summaries []*AccessSummary, fileSet *token.FileSet) {
+	fmt.Print("\n\nAccess summaries:\n")
+	for _, summary := range summaries {
+		fmt.Printf("%s:\n", summary.Function)
+		for x := range summary.Keys {
+			fmt.Printf("\tK%d %s %s\n", x+1, summary.Kinds[x], formatKeyAccess(summary.Keys[x], formatKeyTemplate))
+		}
+		steps := []string{}
+		for x := range summary.Trace {
+			operation := "R"
+			if summary.Trace[x].Write {
+				operation = "W"
+			}
+			steps = append(steps, fmt.Sprintf("%s K%d (line %d)", operation, summary.Steps[x]+1,
+				lineOf(fileSet, summary.Trace[x].Site.Pos)))
+		}
+		fmt.Printf("\ttrace: %s\n", strings.Join(steps, ", "))
+	}
+}
@@ -0,0 +1,82 @@
+package stcpsce
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSummarizeAccesses(t *testing.T) {
+	analysis := analyzeTestSource(t, `package main
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+type SmartContract struct{}
+
+type Account struct {
+	ID      string
+	Balance int
+}
+
+func (s *SmartContract) Transfer(stub shim.ChaincodeStubInterface, args []string) {
+	value, _ := stub.GetState("account_" + args[0])
+	other, _ := stub.GetState("user_" + args[1])
+	if len(other) == 0 {
+		stub.PutState("account_"+args[0], value)
+	}
+	stub.PutState("log_"+args[2], other)
+}
+
+func (s *SmartContract) Scan(stub shim.ChaincodeStubInterface, args []string) {
+	iterator, _ := stub.GetStateByRange("a", "b")
+	iterator.Close()
+	stub.PutState("a", []byte("1"))
+}
+
+func loadAccount(stub shim.ChaincodeStubInterface, id string) (*Account, error) {
+	key := "account_" + id
+	bytes, err := stub.GetState(key)
+	account := &Account{}
+	json.Unmarshal(bytes, account)
+	return account, err
+}
+
+func saveAccount(stub shim.ChaincodeStubInterface, account *Account) error {
+	bytes, _ := json.Marshal(account)
+	key := "account_" + account.ID
+	return stub.PutState(key, bytes)
+}
+
+func (s *SmartContract) Deposit(stub shim.ChaincodeStubInterface, args []string) error {
+	account, err := loadAccount(stub, args[0])
+	account.Balance++
+	err = saveAccount(stub, account)
+	return err
+}
+`)
+	summaries, traces := map[string]string{}, map[string][]int{}
+	for _, summary := range analysis.Summaries {
+		traces[summary.Function] = summary.Steps
+		kinds := []string{}
+		for x := range summary.Keys {
+			kinds = append(kinds, formatKeyAccess(summary.Keys[x], formatKeyTemplate)+" "+summary.Kinds[x])
+		}
+		summaries[summary.Function] = strings.Join(kinds, ", ")
+	}
+	want := map[string]string{
+		"Transfer": `"account_" + {args[0]} read-modify-write, "user_" + {args[1]} read-only, "log_" + {args[2]} blind-write`,
+		"Scan":     `"a" blind-write`,
+		"Deposit":  `"account_" + {args[0]} read-modify-write, "account_" + {account.ID} read-modify-write`,
+	}
+	for function := range want {
+		if summaries[function] != want[function] {
+			t.Errorf("summary of %s = %q, want %q", function, summaries[function], want[function])
+		}
+	}
+	if got := traces["Transfer"]; len(got) != 4 || got[0] != 0 || got[1] != 1 || got[2] != 0 || got[3] != 2 {
+		t.Errorf("trace of Transfer = %v, want the keys in the order of the source code", got)
+	}
+}
@@ -0,0 +1,188 @@
+package stcpsce
+
+import (
+	"fmt"
+	"go/ast"
+	"go/scanner"
+	"go/token"
+	"io"
+)
+
+// SkippedDeclaration
+//
+// @description:	This is used to describe a declaration left out of the analysis, like a function with a syntax
+//error.
+//
+type SkippedDeclaration struct {
+	// Name is the name of a function, or the keyword and the first name of another declaration, like `type Account`.
+	Name   string
+	Pos    int
+	End    int
+	Reason string
+}
+
+// @title:	declarationName
+//
+// @description:	This is used to name a declaration of the file.
+//
+// @param: 	declaration ast.Decl	The declaration.
+//
+// @return:	string		The name of the declaration.
+//
+func declarationName(declaration ast.Decl) string {
+	switch d := declaration.(type) {
+	case *ast.FuncDecl:
+		if d.Name != nil {
+			return d.Name.Name
+		}
+	case *ast.GenDecl:
+		for _, spec := range d.Specs {
+			switch s := spec.(type) {
+			case *ast.TypeSpec:
+				return d.Tok.String() + " " + s.Name.Name
+			case *ast.ValueSpec:
+				if len(s.Names) != 0 {
+					return d.Tok.String() + " " + s.Names[0].Name
+				}
+			case *ast.ImportSpec:
+				if s.Path != nil {
+					return d.Tok.String() + " " + s.Path.Value
+				}
+			}
+		}
+		return d.Tok.String()
+	}
+	return "declaration"
+}
+
+// @title:	isMalformedDeclaration
+//
+// @description:	This is used to determine if the parser recovered from a syntax error in a declaration, which is when
+//an error is in its range or it holds a node standing for source code which cannot be parsed.
+//
+// @param: 	declaration ast.Decl	The declaration.
+//
+// @param: 	errors scanner.ErrorList	List of the syntax errors.
+//
+// @param: 	file *token.File	The file of the declaration.
+//
+// @return:	bool		If the declaration is malformed, return true, otherwise return false.
+//
+func isMalformedDeclaration(declaration ast.Decl, errors scanner.ErrorList, file *token.File) bool {
+	if _, ok := declaration.(*ast.BadDecl); ok {
+		return true
+	}
+	start, end := file.Offset(declaration.Pos()), file.Offset(declaration.End())
+	for _, e := range errors {
+		if e.Pos.Offset >= start && e.Pos.Offset <= end {
+			return true
+		}
+	}
+	malformed := false
+	ast.Inspect(declaration, func(node ast.Node) bool {
+		switch node.(type) {
+		case *ast.BadExpr, *ast.BadStmt, *ast.BadDecl:
+			malformed = true
+		}
+		return !malformed
+	})
+	return malformed
+}
+
+// @title:	pruneMalformedDeclarations
+//
+// @description:	This is used to remove the malformed declarations of a file recovered by the parser from its syntax
+//errors, so the well-formed functions can still be analyzed.
+//
+// @param: 	f *ast.File	The file, whose declarations are replaced.
+//
+// @param: 	fileSet *token.FileSet	The file set which the source code is parsed with.
+//
+// @param: 	err error	The error of the parser.
+//
+// @return:	skipped []*SkippedDeclaration	List of the removed declarations.
+//
+func pruneMalformedDeclarations(f *ast.File, fileSet *token.FileSet, err error) (skipped []*SkippedDeclaration) {
+	skipped = []*SkippedDeclaration{}
+	errors, ok := err.(scanner.ErrorList)
+	file := fileSet.File(f.Pos())
+	if !ok || file == nil {
+		return skipped
+	}
+	declarations := []ast.Decl{}
+	for _, declaration := range f.Decls {
+		if isMalformedDeclaration(declaration, errors, file) {
+			// A declaration cut short by the end of the file may end before it starts or after the file.
+			end := declaration.End()
+			if end < declaration.Pos() || int(end) > file.Base()+file.Size() {
+				end = token.Pos(file.Base() + file.Size())
+			}
+			skipped = append(skipped, &SkippedDeclaration{Name: declarationName(declaration),
+				Pos: int(declaration.Pos()), End: int(end), Reason: "syntax error"})
+		} else {
+			declarations = append(declarations, declaration)
+		}
+	}
+	f.Decls = declarations
+	return skipped
+}
+
+// @title:	removeDuplicateErrors
+//
+// @description:	This is used to remove the syntax errors reported twice at the same position, which the parser does
+//when it reports all of them.
+//
+// @param: 	err error	The error of the parser.
+//
+// @return:	error		The error without the duplicates.
+//
+func removeDuplicateErrors(err error) error {
+	errors, ok := err.(scanner.ErrorList)
+	if !ok {
+		return err
+	}
+	unique := scanner.ErrorList{}
+	for x := range errors {
+		if x == 0 || errors[x].Pos != errors[x-1].Pos || errors[x].Msg != errors[x-1].Msg {
+			unique = append(unique, errors[x])
+		}
+	}
+	return unique
+}
+
+// @title:	printSyntaxErrors
+//
+// @description:	This is used to print every syntax error with its position, or the error itself if it is not a list
+//of syntax errors.
+//
+// @param: 	err error	The error.
+//
+// @param: 	output io.Writer	The output.
+//
+func printSyntaxErrors(err error, output io.Writer) {
+	errors, ok := err.(scanner.ErrorList)
+	if !ok {
+		fmt.Fprintln(output, "Error", err)
+		return
+	}
+	for _, e := range errors {
+		fmt.Fprintln(output, e)
+	}
+}
+
+// @title:	printSkippedDeclarations
+//
+// @description:	This is used to print the declarations left out of the analysis with the reasons.
+//
+// @param: 	skipped []*SkippedDeclaration	List of the skipped declarations.
+//
+// @param: 	fileSet *token.FileSet	The file set which the source code is parsed with.
+//
+// @param: 	output io.Writer	The output.
+//
+func printSkippedDeclarations(skipped []*SkippedDeclaration, fileSet *token.FileSet, output io.Writer) {
+	for x := range skipped {
+		fmt.Fprintf(output, "%s line %d: skipped, %s\n", skipped[x].Name, lineOf(fileSet, skipped[x].Pos),
+			skipped[x].Reason)
+	}
+}
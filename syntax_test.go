@@ -0,0 +1,78 @@
+package stcpsce
+
+import (
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"testing"
+)
+
+func TestPartialAst(t *testing.T) {
+	source := `package main
+
+type Account struct {
+	Balance int
+}
+
+func Cut(note string) {
+	memo := (note
+}
+
+func Pay(note string, total string) {
+	memo := note
+	total = memo
+}
+
+var Broken = )
+`
+	analysis, err := analyzeSource("partial.go", source, nil, nil)
+	errors, ok := err.(scanner.ErrorList)
+	if !ok || len(errors) == 0 {
+		t.Fatalf("err = %v, want the syntax errors", err)
+	}
+	for x := 1; x < len(errors); x++ {
+		if errors[x].Pos == errors[x-1].Pos && errors[x].Msg == errors[x-1].Msg {
+			t.Errorf("the syntax error %v is reported twice", errors[x])
+		}
+	}
+	if analysis == nil {
+		t.Fatal("the partial AST is not analyzed")
+	}
+	names := []string{}
+	for _, skipped := range analysis.Skipped {
+		names = append(names, skipped.Name)
+		if skipped.End < skipped.Pos {
+			t.Errorf("%s ends at %d before it starts at %d", skipped.Name, skipped.End, skipped.Pos)
+		}
+		if skipped.Reason != "syntax error" {
+			t.Errorf("%s is skipped because of %q", skipped.Name, skipped.Reason)
+		}
+	}
+	if got := fmt.Sprint(names); got != "[Cut var Broken]" {
+		t.Errorf("skipped = %s, want [Cut var Broken]", got)
+	}
+	if len(analysis.Chains) != 1 || findEnclosingFunction(analysis.Ast, analysis.Chains[0][0]) != "Pay" {
+		t.Errorf("the chain of Pay is not found in %d chains", len(analysis.Chains))
+	}
+}
+
+func TestUnparsableSource(t *testing.T) {
+	analysis, err := analyzeSource("broken.go", "func Pay() {}\n", nil, nil)
+	if analysis != nil || err == nil {
+		t.Errorf("a file without a package clause is analyzed, err = %v", err)
+	}
+}
+
+func TestCutDeclaration(t *testing.T) {
+	source := "package main\n\nfunc Pay( {\n"
+	analysis, _ := analyzeSource("cut.go", source, nil, nil)
+	if analysis == nil || len(analysis.Skipped) != 1 {
+		t.Fatal("the cut declaration is not skipped")
+	}
+	skipped := analysis.Skipped[0]
+	file := analysis.FileSet.File(token.Pos(skipped.Pos))
+	if skipped.Name != "Pay" || skipped.Pos != file.Base()+14 || skipped.End != file.Base()+file.Size() {
+		t.Errorf("skipped %s from %d to %d, want Pay from %d to %d", skipped.Name, skipped.Pos, skipped.End,
+			file.Base()+14, file.Base()+file.Size())
+	}
+}
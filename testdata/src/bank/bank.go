@@ -0,0 +1,14 @@
+package bank
+
+import (
+	"ledger"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func Pay(stub shim.ChaincodeStubInterface, id string, note string) { // want Pay:`GetState\[1\] PutState\[1\]`
+	balance := ledger.Load(stub, id)
+	memo := ""
+	memo = note
+	ledger.Save(stub, id, append(balance, memo...))
+}
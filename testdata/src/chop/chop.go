@@ -0,0 +1,18 @@
+package chop
+
+import "github.com/hyperledger/fabric/core/chaincode/shim"
+
+func Pay(stub shim.ChaincodeStubInterface, id string, note string) {
+	memo := ""
+	if id == "" {
+		return
+	}
+	memo = note // want `parallelizable statement`
+	stub.PutState(id, []byte(memo))
+}
+
+func Spawn(stub shim.ChaincodeStubInterface, id string, note string) {
+	memo := ""
+	memo = note
+	go stub.PutState(id, []byte(memo))
+}
@@ -0,0 +1,7 @@
+// Package shim stubs the interface of the chaincodes the analyzers are tested with.
+package shim
+
+type ChaincodeStubInterface interface {
+	GetState(key string) ([]byte, error)
+	PutState(key string, value []byte) error
+}
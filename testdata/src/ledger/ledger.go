@@ -0,0 +1,12 @@
+package ledger
+
+import "github.com/hyperledger/fabric/core/chaincode/shim"
+
+func Load(stub shim.ChaincodeStubInterface, key string) []byte { // want Load:`GetState\[1\] PutState\[\]`
+	value, _ := stub.GetState(key)
+	return value
+}
+
+func Save(stub shim.ChaincodeStubInterface, key string, value []byte) { // want Save:`GetState\[\] PutState\[1\]`
+	stub.PutState(key, value)
+}